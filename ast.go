@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math"
 )
 
 /*** interface definitioins ***/
@@ -12,14 +13,67 @@ type Ast interface {
 	Debuggable
 }
 
-type LeftValue interface {
+type Expression interface {
 	Ast
+	getTok() *Token
+	getType() Type
+	setType(gtype Type)
+	getConstant() Constant
+	setConstant(constant Constant)
+}
+
+type LeftValue interface {
+	Expression
 	emitLeft()
 }
 
+// a boolean expression which branches on its value without pushing it
+type Condition interface {
+	Expression
+	emitJump(label string, jumpIf bool)
+}
+
 /*** registers for function arguments ***/
 var regs = []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
 
+/*** registers for function results ***/
+var retRegs = []string{"rax", "rdx", "rcx", "rsi", "rdi", "r8", "r9", "r10", "r11"}
+
+// the registers of the values of the types. a float is in the next vector register from %xmm0,
+// like the System V ABI, and any other value in the next of the registers given.
+// a receiver is always in %rdi, where the method wrappers put it
+func assignRegisters(types []Type, intRegs []string, receiver bool) []string {
+	var assigned []string
+	ints, floats := 0, 0
+	for i, t := range types {
+		if isFloat(t) && !(receiver && i == 0) {
+			assigned = append(assigned, fmt.Sprintf("xmm%d", floats))
+			floats++
+		} else {
+			assigned = append(assigned, intRegs[ints])
+			ints++
+		}
+	}
+	return assigned
+}
+
+// the values fit in the registers of assignRegisters, the six integer registers and the eight
+// vector registers of the System V ABI
+func fitsRegisters(types []Type, receiver bool) bool {
+	ints, floats := 0, 0
+	if receiver {
+		ints++
+	}
+	for _, t := range types {
+		if isFloat(t) {
+			floats++
+		} else {
+			ints++
+		}
+	}
+	return ints <= len(regs) && floats <= 8
+}
+
 /*** default functions ***/
 func printSpace(n int) string {
 	return fmt.Sprintf("%*s", n, "")
@@ -31,6 +85,79 @@ func showAst(ast Ast, depth int) {
 
 /* ================================================================ */
 
+/* ================================
+ * ExpressionBase
+ *     type annotated by the type checker
+ * ================================ */
+type ExpressionBase struct {
+	tok      *Token
+	gtype    Type
+	constant Constant // of a constant expression, set by the checker but for literals
+}
+
+func (eb *ExpressionBase) getTok() *Token {
+	return eb.tok
+}
+
+func (eb *ExpressionBase) getType() Type {
+	return eb.gtype
+}
+
+func (eb *ExpressionBase) setType(gtype Type) {
+	eb.gtype = gtype
+}
+
+func (eb *ExpressionBase) getConstant() Constant {
+	return eb.constant
+}
+
+func (eb *ExpressionBase) setConstant(constant Constant) {
+	eb.constant = constant
+}
+
+// a constant expression is emitted as its value
+func (eb *ExpressionBase) emitFolded() bool {
+	if eb.constant == nil {
+		return false
+	}
+	eb.constant.emitConstant(eb.gtype)
+	return true
+}
+
+// jump to the label if the boolean value of the expression is jumpIf,
+// a constant one jumps always or never
+func emitBranch(ast Ast, label string, jumpIf bool) {
+	if bc, ok := ast.(Expression).getConstant().(*BoolConstant); ok {
+		if bc.value == jumpIf {
+			emitCode("\tjmp\t%s", label)
+		}
+		return
+	}
+	if cond, ok := ast.(Condition); ok {
+		cond.emitJump(label, jumpIf)
+		return
+	}
+	ast.emit()
+	if jumpIf {
+		emitJumpIfNotZero(label)
+	} else {
+		emitJumpIfZero(label)
+	}
+}
+
+// push 1 or 0 by the branches of a condition
+func emitConditionValue(cond Condition) {
+	falseLabel := makeLabel()
+	endLabel := makeLabel()
+	cond.emitJump(falseLabel, false)
+	emitCode("\tpushq\t$1")
+	emitCode("\tjmp\t%s", endLabel)
+	emitLabel(falseLabel)
+	emitCode("\tpushq\t$0")
+	emitLabel(endLabel)
+	frameHeight += 8
+}
+
 /* ================================
  * TranslationUnit
  *     implements Ast and Debuggale
@@ -46,8 +173,13 @@ type TranslationUnit struct {
 func (tu *TranslationUnit) emit() {
 	for _, sym := range tu.globalvars {
 		emitCode(".global\t_%s", sym.name)
+		emitCode(".balign\t%d", sym.gtype.align())
 		emitCode("_%s:", sym.name)
-		emitCode(".long\t%s", sym.initval.toStringValue())
+		if sym.initval == nil {
+			emitCode(".zero\t%d", sym.gtype.size())
+			continue
+		}
+		emitCode("%s\t%s", dataDirective(sym.gtype), sym.initval.toStringValue(sym.gtype))
 	}
 	for _, child := range tu.childs {
 		child.emit()
@@ -81,7 +213,7 @@ func (tu *TranslationUnit) debug() {
  *     implements Ast
  * ================================ */
 type GlobalDeclaration struct {
-	sym *GlobalVariable
+	syms []*GlobalVariable
 }
 
 // implements Ast
@@ -93,6 +225,10 @@ func (gd *GlobalDeclaration) emit() {
 func (gd *GlobalDeclaration) show(depth int) {
 	str := printSpace(depth)
 	str += fmt.Sprintf("GlobalDeclaration")
+	for _, sym := range gd.syms {
+		str += fmt.Sprintf(" %s", sym.name)
+	}
+	str += "\n"
 	debugPrint(str)
 }
 
@@ -105,23 +241,32 @@ func (gd *GlobalDeclaration) debug() {
  * Function Definition
  *     implements Ast
  * ================================ */
+// a func literal is called with its closure in %r10, which is saved in the context
 type FunctionDefinition struct {
-	fname   string
-	rettype string
-	params  []*LocalVariable
-	ast     Ast
-	space   int
+	fname        string
+	sig          *FunctionSignature
+	params       []*LocalVariable
+	namedResults []*LocalVariable
+	ast          Ast
+	space        int
+	returnLabel  string
+	outer        *FunctionDefinition // of a func literal
+	literals     int                 // the number of the func literals in it
+	captures     []*CapturedVariable
+	context      *LocalVariable
 }
 
 // implements Ast
 func (fd *FunctionDefinition) emit() {
 	emitFuncPrologue(fd.fname)
 	var stacksize int = 0
+	var types []Type
 	for _, v := range fd.params {
-		stacksize += v.size
+		types = append(types, v.gtype)
 	}
-	for i, _ := range fd.params {
-		emitCode("\tpushq\t%%%s", regs[i])
+	for _, reg := range assignRegisters(types, regs, fd.sig.receiver != nil) {
+		stacksize += 8
+		emitPushRegister(reg)
 		frameHeight += 8
 	}
 	if fd.space > 0 {
@@ -130,13 +275,25 @@ func (fd *FunctionDefinition) emit() {
 		frameHeight += fd.space
 		stacksize += fd.space
 	}
+	if fd.context != nil {
+		emitCode("\tmovq\t%%r10, -%d(%%rbp)", fd.context.offset)
+	}
+	for _, v := range fd.params {
+		if v.escapes {
+			v.emitMoveToHeap()
+		}
+	}
+	for _, v := range fd.namedResults {
+		v.emitZero()
+	}
 	fd.ast.emit()
+	emitCode("\tmovl\t$0, %%eax") // return 0
+	emitLabel(fd.returnLabel)
 	if stacksize > 0 {
 		emitCode("# free function argument and local variable area")
 		emitCode("\taddq\t$%d,\t%%rsp", stacksize)
 		frameHeight -= stacksize
 	}
-	emitCode("\tmovl\t$0, %%eax") // return 0
 	emitFuncEpilogue()
 }
 
@@ -160,14 +317,11 @@ func (fd *FunctionDefinition) debug() {
  * ================================ */
 type CompoundStatement struct {
 	statements []Ast
-	localvars  []*LocalVariable
+	end        *Token // the closing brace
 }
 
 // implements Ast
 func (cs *CompoundStatement) emit() {
-	for _, v := range cs.localvars {
-		emitCode ("\tmovq\t$0,\t-%d(%%rbp)", v.offset)
-	}
 	for _, statement := range cs.statements {
 		statement.emit()
 	}
@@ -204,290 +358,2969 @@ func (s *Statement) emit() {
 	s.ast.emit()
 }
 
+/* ================================
+ * ExpressionStatement
+ *     implements Ast
+ * ================================ */
+type ExpressionStatement struct {
+	expr Ast
+}
+
 // implements Ast
-func (s *Statement) debug() {
-	debugPrintln("ast.statement")
-	s.ast.debug()
+func (es *ExpressionStatement) emit() {
+	es.expr.emit()
+	for i := 0; i < valueCount(es.expr); i++ {
+		emitDiscard()
+	}
 }
 
 // implements Ast
-func (s *Statement) show(depth int) {
+func (es *ExpressionStatement) debug() {
+	debugPrintln("ast.expression_statement")
+	es.expr.debug()
+}
+
+// implements Ast
+func (es *ExpressionStatement) show(depth int) {
 	str := printSpace(depth)
-	str += fmt.Sprintf("Statement\n")
+	str += fmt.Sprintf("ExpressionStatement\n")
 	debugPrint(str)
-	s.ast.show(depth + 1)
+	es.expr.show(depth + 1)
 }
 
 /* ================================
- * DeclarationStatement
+ * ReturnStatement
  *     implements Ast
  * ================================ */
-type DeclarationStatement struct {
-	sym    *LocalVariable
-	assign Ast
+type ReturnStatement struct {
+	tok         *Token
+	exprs       []Ast
+	sig         *FunctionSignature
+	returnLabel string
 }
 
 // implements Ast
-func (ds *DeclarationStatement) emit() {
-	if ds.assign != nil {
-		ds.assign.emit()
+func (rs *ReturnStatement) emit() {
+	count := 0
+	for _, expr := range rs.exprs {
+		expr.emit()
+		count += valueCount(expr)
 	}
+	results := rs.sig.funcType().results
+	if area := resultAreaOf(results); area != nil {
+		// an aggregate may be in this frame, and is copied to the area of the caller
+		fields := area.fields
+		for i, gtype := range results {
+			if !isAggregate(gtype) {
+				continue
+			}
+			slot := 8 * (count - 1 - i)
+			emitCode("\tmovq\t%d(%%rsp), %%rcx", slot)
+			emitCode("\tmovq\t16(%%rbp), %%rax")
+			emitCode("\taddq\t$%d, %%rax", fields[0].offset)
+			emitStore(gtype)
+			emitCode("\tmovq\t%%rax, %d(%%rsp)", slot)
+			fields = fields[1:]
+		}
+	}
+	registers := assignRegisters(results, retRegs, false)
+	for i := count - 1; i >= 0; i-- {
+		emitPopRegister(registers[i])
+		frameHeight -= 8
+	}
+	emitCode("\tjmp\t%s\t# return", rs.returnLabel)
 }
 
 // implements Ast
-func (ds *DeclarationStatement) debug() {
-	debugPrintln("ast.declaration_statement")
-	if ds.assign != nil {
-		ds.assign.debug()
+func (rs *ReturnStatement) debug() {
+	debugPrintln("ast.return_statement")
+	for _, expr := range rs.exprs {
+		expr.debug()
 	}
 }
 
 // implements Ast
-func (ds *DeclarationStatement) show(depth int) {
+func (rs *ReturnStatement) show(depth int) {
 	str := printSpace(depth)
-	str += fmt.Sprintf("DeclarationStatement(%s)\n", ds.sym.name)
+	str += fmt.Sprintf("ReturnStatement\n")
 	debugPrint(str)
-	if ds.assign != nil {
-		ds.assign.show(depth + 1)
+	for _, expr := range rs.exprs {
+		expr.show(depth + 1)
 	}
 }
 
+// implements Ast
+func (s *Statement) debug() {
+	debugPrintln("ast.statement")
+	s.ast.debug()
+}
+
+// implements Ast
+func (s *Statement) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("Statement\n")
+	debugPrint(str)
+	s.ast.show(depth + 1)
+}
+
 /* ================================
- * Assignment Expression
+ * ConstDeclaration
  *     implements Ast
  * ================================ */
-type AssignmentExpression struct {
-	left  LeftValue
-	right Ast
+type ConstDeclaration struct {
+	syms []*NamedConstant
 }
 
 // implements Ast
-func (ae *AssignmentExpression) emit() {
-	ae.right.emit()
-	ae.left.emitLeft()
-
-	emitCode("\tpopq\t%%rax")
-	emitCode("\tmovq\t0(%%rsp), %%rcx")
-	emitCode("\tmovq\t%%rcx, 0(%%rax)")
-	frameHeight -= 8
+func (cd *ConstDeclaration) emit() {
+	// no code for constants
 }
 
 // implements Ast
-func (ae *AssignmentExpression) debug() {
-	debugPrintln("ast.assignment_expression")
-	ae.left.debug()
-	ae.right.debug()
+func (cd *ConstDeclaration) debug() {
+	debugPrintln("ast.const_declaration")
 }
 
-//implements Ast
-func (ae *AssignmentExpression) show(depth int) {
+// implements Ast
+func (cd *ConstDeclaration) show(depth int) {
 	str := printSpace(depth)
-	str += fmt.Sprintf("AssignmentExpression\n")
+	str += fmt.Sprintf("ConstDeclaration(")
+	for i, nc := range cd.syms {
+		if i > 0 {
+			str += ", "
+		}
+		str += nc.name
+	}
+	str += ")\n"
 	debugPrint(str)
-	ae.left.show(depth + 1)
-	ae.right.show(depth + 1)
 }
 
 /* ================================
- * Arithmetic Expression
+ * TypeDeclaration
  *     implements Ast
  * ================================ */
-type ArithmeticExpression struct {
-	operator ArithmeticOperator
-	left     Ast
-	right    Ast
+type TypeDeclaration struct {
+	types []*NamedType
 }
 
 // implements Ast
-func (ae *ArithmeticExpression) emit() {
-	// emitCode (fmt.Sprintf ("\tmovl\t$%d, %%ebx\n", ae.right.operand.ival))
-	ae.left.emit()
-	ae.right.emit()
-	emitCode("\tpopq\t%%rbx")
-	emitCode("\tpopq\t%%rax")
-	frameHeight -= 16
-	ae.operator.emitOperator()
-	emitCode("\tpushq\t%%rax")
-	frameHeight += 8
+func (td *TypeDeclaration) emit() {
+	// no code for types
 }
 
 // implements Ast
-func (ae *ArithmeticExpression) debug() {
-	debugPrintln("ast.arithmetic_expression")
-	ae.left.debug()
-	ae.right.debug()
+func (td *TypeDeclaration) debug() {
+	debugPrintln("ast.type_declaration")
 }
 
 // implements Ast
-func (ae *ArithmeticExpression) show(depth int) {
+func (td *TypeDeclaration) show(depth int) {
 	str := printSpace(depth)
-	str += fmt.Sprintf("ArithemeticExpression\n")
-	ae.left.show(depth + 1)
-	ae.right.show(depth + 1)
+	str += fmt.Sprintf("TypeDeclaration(")
+	for i, nt := range td.types {
+		if i > 0 {
+			str += ", "
+		}
+		str += nt.name
+	}
+	str += ")\n"
+	debugPrint(str)
 }
 
 /* ================================
- * Unary Expression
+ * DeclarationStatement
  *     implements Ast
  * ================================ */
-type UnaryExpression struct {
-	//	operand *PrimaryExpression
-	operand Ast
+type DeclarationStatement struct {
+	syms    []*LocalVariable
+	assigns []Ast
 }
 
 // implements Ast
-func (ue *UnaryExpression) emit() {
-	ue.operand.emit()
+func (ds *DeclarationStatement) emit() {
+	// the slot may have been used by a variable of an earlier statement,
+	// and an escaping variable gets new storage
+	for _, sym := range ds.syms {
+		sym.emitZero()
+	}
+	for _, assign := range ds.assigns {
+		assign.emit()
+	}
 }
 
 // implements Ast
-func (ue *UnaryExpression) debug() {
-	debugPrintln("ast.unary_expression")
-	ue.operand.debug()
+func (ds *DeclarationStatement) debug() {
+	debugPrintln("ast.declaration_statement")
+	for _, assign := range ds.assigns {
+		assign.debug()
+	}
 }
 
 // implements Ast
-func (ue *UnaryExpression) show(depth int) {
+func (ds *DeclarationStatement) show(depth int) {
 	str := printSpace(depth)
-	str += fmt.Sprintf("UnaryExpression\n")
+	str += fmt.Sprintf("DeclarationStatement(")
+	for i, sym := range ds.syms {
+		if i > 0 {
+			str += ", "
+		}
+		str += sym.name
+	}
+	str += ")\n"
 	debugPrint(str)
-	ue.operand.show(depth + 1)
+	for _, assign := range ds.assigns {
+		assign.show(depth + 1)
+	}
 }
 
 /* ================================
- * Primary Expression
+ * IfStatement
  *     implements Ast
  * ================================ */
-type PrimaryExpression struct {
-	child Ast
+type IfStatement struct {
+	init Ast
+	cond Ast
+	then Ast
+	els  Ast
 }
 
 // implements Ast
-func (pe *PrimaryExpression) emit() {
-	pe.child.emit()
+func (is *IfStatement) emit() {
+	elseLabel := makeLabel()
+	endLabel := makeLabel()
+	if is.init != nil {
+		is.init.emit()
+	}
+	emitBranch(is.cond, elseLabel, false)
+	is.then.emit()
+	emitCode("\tjmp\t%s", endLabel)
+	emitLabel(elseLabel)
+	if is.els != nil {
+		is.els.emit()
+	}
+	emitLabel(endLabel)
 }
 
 // implements Ast
-func (pe *PrimaryExpression) debug() {
-	debugPrintln("ast.primary_expression")
-	pe.child.debug()
+func (is *IfStatement) debug() {
+	debugPrintln("ast.if_statement")
+	if is.init != nil {
+		is.init.debug()
+	}
+	is.cond.debug()
+	is.then.debug()
+	if is.els != nil {
+		is.els.debug()
+	}
 }
 
 // implements Ast
-func (pe *PrimaryExpression) show(depth int) {
+func (is *IfStatement) show(depth int) {
 	str := printSpace(depth)
-	str += fmt.Sprintf("PrimaryExpression\n")
+	str += fmt.Sprintf("IfStatement\n")
 	debugPrint(str)
-	pe.child.show(depth + 1)
+	if is.init != nil {
+		is.init.show(depth + 1)
+	}
+	is.cond.show(depth + 1)
+	is.then.show(depth + 1)
+	if is.els != nil {
+		is.els.show(depth + 1)
+	}
 }
 
 /* ================================
- * AstConstant
+ * ForStatement
  *     implements Ast
  * ================================ */
-type AstConstant struct {
-	constant Constant
+type ForStatement struct {
+	init          Ast
+	cond          Ast
+	post          Ast
+	body          Ast
+	breakLabel    string
+	continueLabel string
 }
 
 // implements Ast
-func (ac *AstConstant) emit() {
-	ac.constant.emitConstant()
+func (fs *ForStatement) emit() {
+	beginLabel := makeLabel()
+	if fs.init != nil {
+		fs.init.emit()
+	}
+	emitLabel(beginLabel)
+	if fs.cond != nil {
+		emitBranch(fs.cond, fs.breakLabel, false)
+	}
+	fs.body.emit()
+	emitLabel(fs.continueLabel)
+	// each iteration has its own copy of the variables declared in init
+	if ds, ok := fs.init.(*DeclarationStatement); ok {
+		for _, sym := range ds.syms {
+			if sym.escapes {
+				sym.emitRenew()
+			}
+		}
+	}
+	if fs.post != nil {
+		fs.post.emit()
+	}
+	emitCode("\tjmp\t%s", beginLabel)
+	emitLabel(fs.breakLabel)
 }
 
 // implements Ast
-func (ac *AstConstant) debug() {
-	debugPrintlnWithVariable("ast.constant", ac.constant)
+func (fs *ForStatement) debug() {
+	debugPrintln("ast.for_statement")
+	if fs.init != nil {
+		fs.init.debug()
+	}
+	if fs.cond != nil {
+		fs.cond.debug()
+	}
+	if fs.post != nil {
+		fs.post.debug()
+	}
+	fs.body.debug()
 }
 
 // implements Ast
-func (ac *AstConstant) show(depth int) {
+func (fs *ForStatement) show(depth int) {
 	str := printSpace(depth)
-	str += fmt.Sprintf("AstConstant (%s)\n", ac.constant.toStringValue())
+	str += fmt.Sprintf("ForStatement\n")
 	debugPrint(str)
+	if fs.init != nil {
+		fs.init.show(depth + 1)
+	}
+	if fs.cond != nil {
+		fs.cond.show(depth + 1)
+	}
+	if fs.post != nil {
+		fs.post.show(depth + 1)
+	}
+	fs.body.show(depth + 1)
 }
 
 /* ================================
- * Identifier
- *     implements Ast and LeftValue
+ * ForRangeStatement
+ *     implements Ast
  * ================================ */
-type Identifier struct {
-	symbol Symbol
+// the hidden variables hold the elements, the index and the length,
+// and the width of the rune at the index of a string.
+// the elements of a map are the entries it has at the beginning of the loop
+type ForRangeStatement struct {
+	tok           *Token
+	key           LeftValue // nil if absent or blank
+	value         LeftValue // nil if absent or blank
+	decls         []*LocalVariable
+	expr          Ast // an array, a pointer to an array, a slice, a string or a map
+	body          Ast
+	base          *LocalVariable
+	index         *LocalVariable
+	length        *LocalVariable
+	width         *LocalVariable // only for a string
+	breakLabel    string
+	continueLabel string
 }
 
-// implements LeftValue
-func (id *Identifier) emitLeft() {
-	id.symbol.emitLeftValue()
+// implements Ast
+func (frs *ForRangeStatement) emit() {
+	beginLabel := makeLabel()
+	t := frs.expr.(Expression).getType()
+	mt := mapOf(t)
+	frs.expr.emit()
+	if _, ok := t.underlying().(*ArrayType); ok && frs.value != nil {
+		// the elements of an array are those at the beginning of the loop
+		emitCopyToHeap(t)
+	}
+	if mt != nil {
+		emitCode("\tpopq\t%%rdi")
+		frameHeight -= 8
+		emitRuntimeCall("_runtime_mapiterinit")
+		emitCode("\tmovq\t%%rdx, %%rcx")
+	} else {
+		emitCode("\tpopq\t%%rax")
+		frameHeight -= 8
+		if isSlice(t) || isString(t) {
+			emitCode("\tmovq\t8(%%rax), %%rcx")
+			emitCode("\tmovq\t0(%%rax), %%rax")
+		} else {
+			emitCode("\tmovq\t$%d, %%rcx", arrayOf(t).length)
+		}
+	}
+	emitCode("\tmovq\t%%rax, -%d(%%rbp)", frs.base.offset)
+	emitCode("\tmovq\t%%rcx, -%d(%%rbp)", frs.length.offset)
+	emitCode("\tmovq\t$0, -%d(%%rbp)", frs.index.offset)
+	emitLabel(beginLabel)
+	emitCode("\tmovq\t-%d(%%rbp), %%rcx", frs.index.offset)
+	emitCode("\tcmpq\t-%d(%%rbp), %%rcx", frs.length.offset)
+	emitCode("\tjge\t%s", frs.breakLabel)
+	if mt != nil {
+		// an entry deleted during the loop is skipped
+		frs.emitEntry()
+		emitCode("\tcmpq\t$0, 16(%%rax)")
+		emitCode("\tjne\t%s", frs.continueLabel)
+	}
+	// each iteration has its own variables
+	for _, decl := range frs.decls {
+		if decl.escapes {
+			decl.emitZero()
+		}
+	}
+	if isString(t) {
+		frs.emitDecodeRune()
+	}
+	if frs.key != nil {
+		if mt != nil {
+			frs.emitEntry()
+			emitLoad(mt.key, fmt.Sprintf("%d(%%rax)", mapEntryKey))
+		} else {
+			emitCode("\tpushq\t-%d(%%rbp)", frs.index.offset)
+			frameHeight += 8
+		}
+		emitAssignment(frs.key)
+	}
+	switch {
+	case frs.value == nil:
+	case isString(t):
+		emitAssignment(frs.value)
+	case mt != nil:
+		frs.emitEntry()
+		emitLoad(mt.elem, fmt.Sprintf("%d(%%rax)", mapValueOffset(mt)))
+		emitAssignment(frs.value)
+	default:
+		elem := elementOf(t)
+		emitCode("\tmovq\t-%d(%%rbp), %%rax", frs.index.offset)
+		emitCode("\timulq\t$%d, %%rax", elem.size())
+		emitCode("\taddq\t-%d(%%rbp), %%rax", frs.base.offset)
+		emitLoad(elem, "0(%rax)")
+		emitAssignment(frs.value)
+	}
+	frs.body.emit()
+	emitLabel(frs.continueLabel)
+	if isString(t) {
+		emitCode("\tmovq\t-%d(%%rbp), %%rax", frs.width.offset)
+		emitCode("\taddq\t%%rax, -%d(%%rbp)", frs.index.offset)
+	} else {
+		emitCode("\tincq\t-%d(%%rbp)", frs.index.offset)
+	}
+	emitCode("\tjmp\t%s", beginLabel)
+	emitLabel(frs.breakLabel)
 }
 
-// implements Ast
-func (id *Identifier) emit() {
-	id.symbol.emitRightValue()
+// load the map entry at the index into %rax
+func (frs *ForRangeStatement) emitEntry() {
+	emitCode("\tmovq\t-%d(%%rbp), %%rax", frs.base.offset)
+	emitCode("\tmovq\t-%d(%%rbp), %%rcx", frs.index.offset)
+	emitCode("\tmovq\t(%%rax,%%rcx,8), %%rax")
+}
+
+// decode the rune at the index of a string, it is pushed for the value
+func (frs *ForRangeStatement) emitDecodeRune() {
+	emitCode("\tmovq\t-%d(%%rbp), %%rdi", frs.base.offset)
+	emitCode("\taddq\t-%d(%%rbp), %%rdi", frs.index.offset)
+	emitCode("\tmovq\t-%d(%%rbp), %%rsi", frs.length.offset)
+	emitCode("\tsubq\t-%d(%%rbp), %%rsi", frs.index.offset)
+	emitRuntimeCall("_runtime_decoderune")
+	emitCode("\tmovq\t%%rdx, -%d(%%rbp)", frs.width.offset)
+	if frs.value != nil {
+		emitCode("\tpushq\t%%rax")
+		frameHeight += 8
+	}
 }
 
 // implements Ast
-func (id *Identifier) debug() {
-	debugPrintlnWithVariable("ast.identifier", id.symbol.getName())
+func (frs *ForRangeStatement) debug() {
+	debugPrintln("ast.for_range_statement")
+	frs.expr.debug()
+	frs.body.debug()
 }
 
-// implemebts Ast
-func (id *Identifier) show(depth int) {
+// implements Ast
+func (frs *ForRangeStatement) show(depth int) {
 	str := printSpace(depth)
-	str += fmt.Sprintf("Identifier(%s)\n", id.symbol.getName())
+	str += fmt.Sprintf("ForRangeStatement\n")
 	debugPrint(str)
+	if frs.key != nil {
+		frs.key.show(depth + 1)
+	}
+	if frs.value != nil {
+		frs.value.show(depth + 1)
+	}
+	frs.expr.show(depth + 1)
+	frs.body.show(depth + 1)
 }
 
 /* ================================
- * FunCall
+ * ExpressionSwitchStatement
  *     implements Ast
  * ================================ */
-type FunCall struct {
-	fname string
-	args  []Ast
+// the tag is copied to a hidden variable, which the values of the cases are compared with
+// in order, or which indexes a jump table when the values are dense integer constants
+type ExpressionSwitchStatement struct {
+	tok        *Token
+	init       Ast
+	tag        Ast // nil for switch {}
+	clauses    []*SwitchClause
+	value      *LocalVariable // set by the checker
+	breakLabel string
+}
+
+// a condition is the comparison of the tag with a value, or the value of a tagless switch
+type SwitchClause struct {
+	tok          *Token
+	isDefault    bool
+	exprs        []Ast
+	conds        []Ast // set by the checker
+	statements   []Ast
+	fallsThrough bool
 }
 
+// a jump table has at least this many entries, and at most twice as many as the cases
+const jumpTableMinimum = 4
+
 // implements Ast
-func (fc *FunCall) emit() {
-	for i, _ := range fc.args {
-		emitCode("\tpushq\t%%%s", regs[i])
-		frameHeight += 8
+func (ss *ExpressionSwitchStatement) emit() {
+	if ss.init != nil {
+		ss.init.emit()
 	}
-
-	// stacking paddings
-	var fh int
-	// emitCode("# frame height %d before arguments", frameHeight)
-	// fh = (frameHeight + 8*len(fc.args)) % 16   // for argument
-	fh = frameHeight % 16
-	if fh != 0 {
-		padding := 16 - fh
-		emitCode("\tsubq\t$%d, %%rsp  # stack padding", padding)
-		frameHeight += padding
+	if ss.tag != nil {
+		ss.tag.emit()
+		emitAssignment(ss.hiddenValue())
+	}
+	labels := make([]string, len(ss.clauses))
+	defaultLabel := ss.breakLabel
+	for i, clause := range ss.clauses {
+		labels[i] = makeLabel()
+		if clause.isDefault {
+			defaultLabel = labels[i]
+		}
+	}
+	if minimum, table := ss.jumpTable(); table != nil {
+		ss.emitJumpTable(minimum, table, labels, defaultLabel)
+	} else {
+		for i, clause := range ss.clauses {
+			for _, cond := range clause.conds {
+				emitBranch(cond, labels[i], true)
+			}
+		}
+		emitCode("\tjmp\t%s", defaultLabel)
 	}
+	for i, clause := range ss.clauses {
+		emitLabel(labels[i])
+		for _, statement := range clause.statements {
+			statement.emit()
+		}
+		if !clause.fallsThrough {
+			// the next clause follows otherwise
+			emitCode("\tjmp\t%s", ss.breakLabel)
+		}
+	}
+	emitLabel(ss.breakLabel)
+}
 
-	for _, arg := range fc.args {
-		arg.emit()
+func (ss *ExpressionSwitchStatement) hiddenValue() LeftValue {
+	return &Identifier{
+		ExpressionBase: ExpressionBase{tok: ss.tok, gtype: ss.value.gtype},
+		symbol:         ss.value,
 	}
+}
 
-	for i, _ := range fc.args {
-		j := len(fc.args) - 1 - i
-		emitCode("\tpopq\t%%%s", regs[j])
-		frameHeight -= 8
+// the smallest value of the cases, and the index of the clause of each value from it,
+// or -1 for a value of no case. nil unless the values are dense integer constants
+func (ss *ExpressionSwitchStatement) jumpTable() (int, []int) {
+	if ss.tag == nil || !isInteger(ss.value.gtype) {
+		return 0, nil
 	}
-	// emitCode("# frame height %d after arguments", frameHeight)
-	emitCode("\tmovq\t$0, %%rax")
-	emitCode("\tcallq\t_%s\t# frame height %d", fc.fname, frameHeight)
+	clauses := make(map[int]int)
+	minimum, maximum := math.MaxInt, math.MinInt
+	for i, clause := range ss.clauses {
+		for _, expr := range clause.exprs {
+			value, ok := constantIndexOf(expr)
+			if !ok {
+				return 0, nil
+			}
+			clauses[value] = i
+			minimum = min(minimum, value)
+			maximum = max(maximum, value)
+		}
+	}
+	if len(clauses) < jumpTableMinimum || minimum < math.MinInt32 || maximum > math.MaxInt32 ||
+		maximum-minimum >= 2*len(clauses) {
+		return 0, nil
+	}
+	table := make([]int, maximum-minimum+1)
+	for i := range table {
+		index, ok := clauses[minimum+i]
+		if !ok {
+			index = -1
+		}
+		table[i] = index
+	}
+	return minimum, table
+}
 
-	if fh != 0 {
-		padding := 16 - fh
-		emitCode("\taddq\t$%d, %%rsp  # pop padding", padding)
-		frameHeight -= padding
+// the table holds the offsets of the clauses from itself
+func (ss *ExpressionSwitchStatement) emitJumpTable(minimum int, table []int, labels []string, defaultLabel string) {
+	tableLabel := makeLabel()
+	ss.hiddenValue().emit()
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 8
+	if minimum != 0 {
+		emitCode("\tsubq\t$%d, %%rax", minimum)
 	}
+	// a value below the minimum wraps around above the maximum
+	emitCode("\tcmpq\t$%d, %%rax", len(table)-1)
+	emitCode("\tja\t%s", defaultLabel)
+	emitCode("\tleaq\t%s(%%rip), %%rcx", tableLabel)
+	emitCode("\tmovslq\t0(%%rcx,%%rax,4), %%rax")
+	emitCode("\taddq\t%%rcx, %%rax")
+	emitCode("\tjmp\t*%%rax")
+	emitLabel(tableLabel)
+	for _, index := range table {
+		label := defaultLabel
+		if index >= 0 {
+			label = labels[index]
+		}
+		emitCode("\t.long\t%s - %s", label, tableLabel)
+	}
+}
 
-	for i, _ := range fc.args {
-		j := len(fc.args) - 1 - i
-		emitCode("\tpopq\t%%%s", regs[j])
+// implements Ast
+func (ss *ExpressionSwitchStatement) debug() {
+	debugPrintln("ast.expression_switch_statement")
+	if ss.tag != nil {
+		ss.tag.debug()
+	}
+	for _, clause := range ss.clauses {
+		for _, statement := range clause.statements {
+			statement.debug()
+		}
 	}
 }
 
+// implements Ast
+func (ss *ExpressionSwitchStatement) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("ExpressionSwitchStatement\n")
+	debugPrint(str)
+	if ss.init != nil {
+		ss.init.show(depth + 1)
+	}
+	if ss.tag != nil {
+		ss.tag.show(depth + 1)
+	}
+	for _, clause := range ss.clauses {
+		for _, expr := range clause.exprs {
+			expr.show(depth + 1)
+		}
+		for _, statement := range clause.statements {
+			statement.show(depth + 1)
+		}
+	}
+}
+
+/* ================================
+ * TypeSwitchStatement
+ *     implements Ast
+ * ================================ */
+// the subject is copied to a hidden variable, and its dynamic type to another,
+// which the types of the cases are compared with in order
+type TypeSwitchStatement struct {
+	tok         *Token
+	init        Ast
+	subject     Ast
+	clauses     []*TypeSwitchClause
+	value       *LocalVariable // set by the checker
+	dynamicType *LocalVariable
+	breakLabel  string
+}
+
+// the symbol has the type of the single type of the case, or the type of the subject
+type TypeSwitchClause struct {
+	tok        *Token
+	isDefault  bool
+	types      []Type // nil for the case of nil
+	symbol     *LocalVariable
+	statements []Ast
+}
+
+// implements Ast
+func (ts *TypeSwitchStatement) emit() {
+	if ts.init != nil {
+		ts.init.emit()
+	}
+	subjectType := ts.subject.(Expression).getType()
+	ts.subject.emit()
+	emitAssignment(ts.hiddenValue())
+	emitCode("\tleaq\t-%d(%%rbp), %%rax", ts.value.offset)
+	emitDynamicType(subjectType)
+	emitCode("\tmovq\t%%rcx, -%d(%%rbp)", ts.dynamicType.offset)
+	labels := make([]string, len(ts.clauses))
+	defaultLabel := ts.breakLabel
+	for i, clause := range ts.clauses {
+		labels[i] = makeLabel()
+		if clause.isDefault {
+			defaultLabel = labels[i]
+		}
+		for _, t := range clause.types {
+			ts.emitCaseMatch(t, labels[i])
+		}
+	}
+	emitCode("\tjmp\t%s", defaultLabel)
+	for i, clause := range ts.clauses {
+		emitLabel(labels[i])
+		if clause.symbol != nil {
+			ts.emitClauseSymbol(clause.symbol)
+		}
+		for _, statement := range clause.statements {
+			statement.emit()
+		}
+		emitCode("\tjmp\t%s", ts.breakLabel)
+	}
+	emitLabel(ts.breakLabel)
+}
+
+func (ts *TypeSwitchStatement) hiddenValue() LeftValue {
+	return &Identifier{
+		ExpressionBase: ExpressionBase{tok: ts.tok, gtype: ts.value.gtype},
+		symbol:         ts.value,
+	}
+}
+
+// jump to the label if the dynamic type matches the type of a case
+func (ts *TypeSwitchStatement) emitCaseMatch(t Type, label string) {
+	dynamicType := fmt.Sprintf("-%d(%%rbp)", ts.dynamicType.offset)
+	switch {
+	case t == nil:
+		emitCode("\tcmpq\t$0, %s", dynamicType)
+		emitCode("\tje\t%s", label)
+	case isInterface(t) && (isEmptyInterface(t) || implements(ts.value.gtype, t.underlying().(*InterfaceType))):
+		// any dynamic type implements it
+		emitCode("\tcmpq\t$0, %s", dynamicType)
+		emitCode("\tjne\t%s", label)
+	case isInterface(t):
+		isNil := makeLabel()
+		emitCode("\tmovq\t%s, %%rsi", dynamicType)
+		emitCode("\ttestq\t%%rsi, %%rsi")
+		emitCode("\tje\t%s", isNil)
+		emitCode("\tleaq\t%s(%%rip), %%rdi", interfaceDescriptorOf(t).label())
+		emitRuntimeCall("_runtime_lookupitab")
+		emitCode("\ttestq\t%%rax, %%rax")
+		emitCode("\tjne\t%s", label)
+		emitLabel(isNil)
+	default:
+		emitCode("\tleaq\t%s(%%rip), %%rax", descriptorOf(t).label())
+		emitCode("\tcmpq\t%%rax, %s", dynamicType)
+		emitCode("\tje\t%s", label)
+	}
+}
+
+// assign the value of the subject to the symbol of a clause, as the type of the symbol
+func (ts *TypeSwitchStatement) emitClauseSymbol(sym *LocalVariable) {
+	if sym.escapes {
+		sym.emitZero()
+	}
+	emitCode("\tleaq\t-%d(%%rbp), %%rax", ts.value.offset)
+	if isInterface(sym.gtype) {
+		emitCode("\tpushq\t%%rax")
+		frameHeight += 8
+		emitInterfaceConversion(ts.value.gtype, sym.gtype)
+	} else {
+		emitCode("\tmovq\t8(%%rax), %%rax")
+		emitUnbox(sym.gtype)
+	}
+	emitAssignment(&Identifier{
+		ExpressionBase: ExpressionBase{tok: ts.tok, gtype: sym.gtype},
+		symbol:         sym,
+	})
+}
+
+// implements Ast
+func (ts *TypeSwitchStatement) debug() {
+	debugPrintln("ast.type_switch_statement")
+	ts.subject.debug()
+	for _, clause := range ts.clauses {
+		for _, statement := range clause.statements {
+			statement.debug()
+		}
+	}
+}
+
+// implements Ast
+func (ts *TypeSwitchStatement) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("TypeSwitchStatement\n")
+	debugPrint(str)
+	if ts.init != nil {
+		ts.init.show(depth + 1)
+	}
+	ts.subject.show(depth + 1)
+	for _, clause := range ts.clauses {
+		for _, statement := range clause.statements {
+			statement.show(depth + 1)
+		}
+	}
+}
+
+/* ================================
+ * JumpStatement
+ *     implements Ast
+ * ================================ */
+type JumpStatement struct {
+	keyword string
+	label   string
+}
+
+// implements Ast
+func (js *JumpStatement) emit() {
+	emitCode("\tjmp\t%s\t# %s", js.label, js.keyword)
+}
+
+// implements Ast
+func (js *JumpStatement) debug() {
+	debugPrintlnWithVariable("ast.jump_statement", js.keyword)
+}
+
+// implements Ast
+func (js *JumpStatement) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("JumpStatement(%s)\n", js.keyword)
+	debugPrint(str)
+}
+
+/* ================================
+ * Assignment Expression
+ *     implements Ast
+ * ================================ */
+// the operator is set for the compound assignments like +=
+type AssignmentExpression struct {
+	operator ArithmeticOperator
+	left     LeftValue
+	right    Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (ae *AssignmentExpression) emit() {
+	if ae.operator != nil {
+		ae.emitCompound()
+		return
+	}
+	if ie, ok := ae.left.(*IndexExpression); ok && mapOf(ie.array.(Expression).getType()) != nil {
+		ie.emitMapAssignment(ae.right)
+	} else {
+		// the operands of the left side are evaluated first
+		ae.left.emitLeft()
+		ae.right.emit()
+		emitCode("\tpopq\t%%rcx")
+		emitCode("\tpopq\t%%rax")
+		emitCode("\tpushq\t%%rcx")
+		emitCode("\tpushq\t%%rax")
+	}
+
+	emitCode("\tpopq\t%%rax")
+	emitCode("\tmovq\t0(%%rsp), %%rcx")
+	emitStore(ae.left.getType())
+	frameHeight -= 8
+}
+
+// the address of the left side is evaluated once, for both the load and the store
+func (ae *AssignmentExpression) emitCompound() {
+	gtype := ae.left.getType()
+	ae.left.emitLeft()
+	emitCode("\tmovq\t0(%%rsp), %%rax")
+	emitLoad(gtype, "0(%rax)")
+	ae.right.emit()
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 16
+	ae.operator.emitOperator(gtype)
+	emitExtend(gtype)
+	emitCode("\tmovq\t%%rax, %%rcx")
+	emitCode("\tpopq\t%%rax")
+	// the store of an aggregate value clobbers %rcx
+	emitCode("\tpushq\t%%rcx")
+	emitStore(gtype)
+}
+
+// implements Ast
+func (ae *AssignmentExpression) debug() {
+	debugPrintln("ast.assignment_expression")
+	ae.left.debug()
+	ae.right.debug()
+}
+
+// implements Ast
+func (ae *AssignmentExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("AssignmentExpression\n")
+	debugPrint(str)
+	ae.left.show(depth + 1)
+	ae.right.show(depth + 1)
+}
+
+/* ================================
+ * Multiple Assignment Statement
+ *     implements Ast
+ * ================================ */
+type MultipleAssignmentStatement struct {
+	lefts       []LeftValue // nil for the blank identifier
+	rights      []Ast
+	temporaries []*LocalVariable // of the aggregate values, set by the checker
+}
+
+// implements Ast
+func (mas *MultipleAssignmentStatement) emit() {
+	for i, right := range mas.rights {
+		right.emit()
+		if i < len(mas.temporaries) && mas.temporaries[i] != nil {
+			// the value may be one of the variables assigned before
+			emitCopyToTemporary(mas.temporaries[i])
+		}
+	}
+	for i := len(mas.lefts) - 1; i >= 0; i-- {
+		left := mas.lefts[i]
+		if left == nil {
+			emitDiscard()
+			continue
+		}
+		emitAssignment(left)
+	}
+}
+
+// pop the value on the stack and store it to the left value
+func emitAssignment(left LeftValue) {
+	left.emitLeft()
+	emitCode("\tpopq\t%%rax")
+	emitCode("\tpopq\t%%rcx")
+	emitStore(left.getType())
+	frameHeight -= 16
+}
+
+// implements Ast
+func (mas *MultipleAssignmentStatement) debug() {
+	debugPrintln("ast.multiple_assignment_statement")
+	for _, left := range mas.lefts {
+		if left != nil {
+			left.debug()
+		}
+	}
+	for _, right := range mas.rights {
+		right.debug()
+	}
+}
+
+// implements Ast
+func (mas *MultipleAssignmentStatement) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("MultipleAssignmentStatement\n")
+	debugPrint(str)
+	for _, left := range mas.lefts {
+		if left != nil {
+			left.show(depth + 1)
+		}
+	}
+	for _, right := range mas.rights {
+		right.show(depth + 1)
+	}
+}
+
+/* ================================
+ * Arithmetic Expression
+ *     implements Ast
+ * ================================ */
+type ArithmeticExpression struct {
+	operator ArithmeticOperator
+	left     Ast
+	right    Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (ae *ArithmeticExpression) emit() {
+	if ae.emitFolded() {
+		return
+	}
+	ae.left.emit()
+	ae.right.emit()
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 16
+	ae.operator.emitOperator(ae.gtype)
+	emitExtend(ae.gtype)
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// implements Ast
+func (ae *ArithmeticExpression) debug() {
+	debugPrintln("ast.arithmetic_expression")
+	ae.left.debug()
+	ae.right.debug()
+}
+
+// implements Ast
+func (ae *ArithmeticExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("ArithemeticExpression\n")
+	ae.left.show(depth + 1)
+	ae.right.show(depth + 1)
+}
+
+/* ================================
+ * Relational Expression
+ *     implements Ast
+ * ================================ */
+type RelationalExpression struct {
+	operator RelationalOperator
+	left     Ast
+	right    Ast
+	position *AstString // of a comparison which may panic, set by the checker
+	ExpressionBase
+}
+
+// implements Ast
+func (re *RelationalExpression) emit() {
+	if re.emitFolded() {
+		return
+	}
+	gtype := re.emitOperands()
+	emitSetCondition(re.operator.emitCompare(gtype), gtype)
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// implements Condition
+func (re *RelationalExpression) emitJump(label string, jumpIf bool) {
+	gtype := re.emitOperands()
+	emitJumpCondition(re.operator.emitCompare(gtype), gtype, label, jumpIf)
+}
+
+// pop the operands into %rax and %rbx as the values to compare,
+// strings and aggregates are compared by the integers in them
+func (re *RelationalExpression) emitOperands() Type {
+	re.left.emit()
+	re.right.emit()
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 16
+	if isSlice(re.left.(Expression).getType()) {
+		// a slice is compared with nil by its array
+		emitCode("\tmovq\t0(%%rax), %%rax")
+		emitCode("\tmovq\t0(%%rbx), %%rbx")
+	}
+	gtype := re.left.(Expression).getType()
+	if isString(gtype) {
+		// the strings are compared by the sign of their difference
+		emitCode("\tmovq\t%%rax, %%rdi")
+		emitCode("\tmovq\t%%rbx, %%rsi")
+		emitRuntimeCall("_runtime_cmpstring")
+		emitCode("\txorl\t%%ebx, %%ebx")
+		gtype = tInt
+	} else if isAggregate(gtype) && !isSlice(gtype) {
+		// arrays, structs and interfaces are compared with being equal
+		emitCode("\tleaq\t.%s(%%rip), %%rcx", re.position.slabel)
+		emitEquality(gtype)
+		emitCode("\tmovl\t$1, %%ebx")
+		gtype = tInt
+	}
+	return gtype
+}
+
+// compare the values at %rax and %rbx, %rax is set to 1 if they are equal.
+// %rcx is the position where comparing the interface values in them may panic
+func emitEquality(gtype Type) {
+	if isInterface(gtype) {
+		emitCode("\tmovq\t%%rax, %%rdi")
+		emitCode("\tmovq\t%%rbx, %%rsi")
+		emitInterfaceEquality(gtype, "%rcx")
+		return
+	}
+	if isBytewiseComparable(gtype) {
+		emitCode("\tmovq\t%%rax, %%rdi")
+		emitCode("\tmovq\t%%rbx, %%rsi")
+		emitCode("\tmovq\t$%d, %%rdx", gtype.size())
+		emitRuntimeCall("_memcmp")
+		emitCode("\ttestl\t%%eax, %%eax")
+		emitCode("\tsete\t%%al")
+		emitCode("\tmovzbl\t%%al, %%eax")
+		return
+	}
+	// the strings in the values are compared by their bytes
+	notEqual := makeLabel()
+	done := makeLabel()
+	emitCode("\tpushq\t%%rax")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%rcx")
+	frameHeight += 24
+	emitPartEquality(gtype, 0, notEqual)
+	emitCode("\tmovl\t$1, %%eax")
+	emitCode("\tjmp\t%s", done)
+	emitLabel(notEqual)
+	emitCode("\txorl\t%%eax, %%eax")
+	emitLabel(done)
+	emitCode("\taddq\t$24, %%rsp")
+	frameHeight -= 24
+}
+
+// jump to the label unless the parts at the offset of the values on the stack are equal,
+// which are under the position
+func emitPartEquality(gtype Type, offset int, notEqual string) {
+	if isFloat(gtype) {
+		emitCode("\tmovq\t16(%%rsp), %%rdi")
+		emitCode("\tmovq\t8(%%rsp), %%rsi")
+		emitCode("\tmovs%s\t%d(%%rdi), %%xmm0", floatSuffix(gtype)[1:], offset)
+		emitCode("\tucomi%s\t%d(%%rsi), %%xmm0", floatSuffix(gtype), offset)
+		// unordered with a NaN
+		emitCode("\tjp\t%s", notEqual)
+		emitCode("\tjne\t%s", notEqual)
+		return
+	}
+	if !isBytewiseComparable(gtype) && !isString(gtype) && !isInterface(gtype) {
+		switch u := gtype.underlying().(type) {
+		case *ArrayType:
+			for i := 0; i < u.length; i++ {
+				emitPartEquality(u.elem, offset+i*u.elem.size(), notEqual)
+			}
+		case *StructType:
+			for _, field := range u.fields {
+				emitPartEquality(field.gtype, offset+field.offset, notEqual)
+			}
+		}
+		return
+	}
+	emitCode("\tmovq\t16(%%rsp), %%rdi")
+	emitCode("\taddq\t$%d, %%rdi", offset)
+	emitCode("\tmovq\t8(%%rsp), %%rsi")
+	emitCode("\taddq\t$%d, %%rsi", offset)
+	if isString(gtype) {
+		emitRuntimeCall("_runtime_cmpstring")
+		emitCode("\ttestq\t%%rax, %%rax")
+	} else if isInterface(gtype) {
+		emitInterfaceEquality(gtype, "0(%rsp)")
+		emitCode("\ttestq\t%%rax, %%rax")
+		emitCode("\tje\t%s", notEqual)
+		return
+	} else {
+		emitCode("\tmovq\t$%d, %%rdx", gtype.size())
+		emitRuntimeCall("_memcmp")
+		emitCode("\ttestl\t%%eax, %%eax")
+	}
+	emitCode("\tjne\t%s", notEqual)
+}
+
+// compare the interface values at %rdi and %rsi by their dynamic types and values
+func emitInterfaceEquality(gtype Type, position string) {
+	emitCode("\tmovq\t%s, %%rcx", position)
+	if isEmptyInterface(gtype) {
+		emitCode("\txorl\t%%edx, %%edx")
+	} else {
+		emitCode("\tmovl\t$1, %%edx")
+	}
+	emitRuntimeCall("_runtime_ifaceeq")
+}
+
+// implements Ast
+func (re *RelationalExpression) debug() {
+	debugPrintln("ast.relational_expression")
+	re.left.debug()
+	re.right.debug()
+}
+
+// implements Ast
+func (re *RelationalExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("RelationalExpression\n")
+	debugPrint(str)
+	re.left.show(depth + 1)
+	re.right.show(depth + 1)
+}
+
+/* ================================
+ * Logical And Expression
+ *     implements Ast
+ * ================================ */
+type LogicalAndExpression struct {
+	left  Ast
+	right Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (lae *LogicalAndExpression) emit() {
+	if lae.emitFolded() {
+		return
+	}
+	emitConditionValue(lae)
+}
+
+// implements Condition
+func (lae *LogicalAndExpression) emitJump(label string, jumpIf bool) {
+	if !jumpIf {
+		emitBranch(lae.left, label, false)
+		emitBranch(lae.right, label, false)
+		return
+	}
+	falseLabel := makeLabel()
+	emitBranch(lae.left, falseLabel, false)
+	emitBranch(lae.right, label, true)
+	emitLabel(falseLabel)
+}
+
+// implements Ast
+func (lae *LogicalAndExpression) debug() {
+	debugPrintln("ast.logical_and_expression")
+	lae.left.debug()
+	lae.right.debug()
+}
+
+// implements Ast
+func (lae *LogicalAndExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("LogicalAndExpression\n")
+	debugPrint(str)
+	lae.left.show(depth + 1)
+	lae.right.show(depth + 1)
+}
+
+/* ================================
+ * Logical Or Expression
+ *     implements Ast
+ * ================================ */
+type LogicalOrExpression struct {
+	left  Ast
+	right Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (loe *LogicalOrExpression) emit() {
+	if loe.emitFolded() {
+		return
+	}
+	emitConditionValue(loe)
+}
+
+// implements Condition
+func (loe *LogicalOrExpression) emitJump(label string, jumpIf bool) {
+	if jumpIf {
+		emitBranch(loe.left, label, true)
+		emitBranch(loe.right, label, true)
+		return
+	}
+	trueLabel := makeLabel()
+	emitBranch(loe.left, trueLabel, true)
+	emitBranch(loe.right, label, false)
+	emitLabel(trueLabel)
+}
+
+// implements Ast
+func (loe *LogicalOrExpression) debug() {
+	debugPrintln("ast.logical_or_expression")
+	loe.left.debug()
+	loe.right.debug()
+}
+
+// implements Ast
+func (loe *LogicalOrExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("LogicalOrExpression\n")
+	debugPrint(str)
+	loe.left.show(depth + 1)
+	loe.right.show(depth + 1)
+}
+
+/* ================================
+ * Logical Not Expression
+ *     implements Ast
+ * ================================ */
+type LogicalNotExpression struct {
+	operand Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (lne *LogicalNotExpression) emit() {
+	if lne.emitFolded() {
+		return
+	}
+	lne.operand.emit()
+	emitCode("\tpopq\t%%rax")
+	emitCode("\tcmpq\t$0, %%rax")
+	emitCode("\tsete\t%%al")
+	emitCode("\tmovzbl\t%%al, %%eax")
+	emitCode("\tpushq\t%%rax")
+}
+
+// implements Condition
+func (lne *LogicalNotExpression) emitJump(label string, jumpIf bool) {
+	emitBranch(lne.operand, label, !jumpIf)
+}
+
+// implements Ast
+func (lne *LogicalNotExpression) debug() {
+	debugPrintln("ast.logical_not_expression")
+	lne.operand.debug()
+}
+
+// implements Ast
+func (lne *LogicalNotExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("LogicalNotExpression\n")
+	debugPrint(str)
+	lne.operand.show(depth + 1)
+}
+
+/* ================================
+ * Shift Expression
+ *     implements Ast
+ * ================================ */
+type ShiftExpression struct {
+	operator ArithmeticOperator
+	left     Ast
+	right    Ast // the count
+	ExpressionBase
+}
+
+// implements Ast
+func (se *ShiftExpression) emit() {
+	if se.emitFolded() {
+		return
+	}
+	se.left.emit()
+	se.right.emit()
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 16
+	se.operator.emitOperator(se.gtype)
+	emitExtend(se.gtype)
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// implements Ast
+func (se *ShiftExpression) debug() {
+	debugPrintln("ast.shift_expression")
+	se.left.debug()
+	se.right.debug()
+}
+
+// implements Ast
+func (se *ShiftExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("ShiftExpression\n")
+	debugPrint(str)
+	se.left.show(depth + 1)
+	se.right.show(depth + 1)
+}
+
+/* ================================
+ * Unary Expression
+ *     implements Ast
+ * ================================ */
+type UnaryExpression struct {
+	operator UnaryOperator
+	operand  Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (ue *UnaryExpression) emit() {
+	if ue.emitFolded() {
+		return
+	}
+	ue.operand.emit()
+	emitCode("\tpopq\t%%rax")
+	ue.operator.emitOperator(ue.gtype)
+	emitExtend(ue.gtype)
+	emitCode("\tpushq\t%%rax")
+}
+
+// implements Ast
+func (ue *UnaryExpression) debug() {
+	debugPrintln("ast.unary_expression")
+	ue.operand.debug()
+}
+
+// implements Ast
+func (ue *UnaryExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("UnaryExpression\n")
+	debugPrint(str)
+	ue.operand.show(depth + 1)
+}
+
+/* ================================
+ * Address Expression
+ *     implements Ast
+ * ================================ */
+type AddressExpression struct {
+	operand LeftValue
+	ExpressionBase
+}
+
+// implements Ast
+func (ae *AddressExpression) emit() {
+	ae.operand.emitLeft()
+}
+
+// implements Ast
+func (ae *AddressExpression) debug() {
+	debugPrintln("ast.address_expression")
+	ae.operand.debug()
+}
+
+// implements Ast
+func (ae *AddressExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("AddressExpression\n")
+	debugPrint(str)
+	ae.operand.show(depth + 1)
+}
+
+/* ================================
+ * Dereference Expression
+ *     implements LeftValue
+ * ================================ */
+type DereferenceExpression struct {
+	operand Ast
+	ExpressionBase
+}
+
+// implements LeftValue
+func (de *DereferenceExpression) emitLeft() {
+	de.operand.emit()
+}
+
+// implements Ast
+func (de *DereferenceExpression) emit() {
+	de.operand.emit()
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 8
+	emitLoad(de.gtype, "0(%rax)")
+}
+
+// implements Ast
+func (de *DereferenceExpression) debug() {
+	debugPrintln("ast.dereference_expression")
+	de.operand.debug()
+}
+
+// implements Ast
+func (de *DereferenceExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("DereferenceExpression\n")
+	debugPrint(str)
+	de.operand.show(depth + 1)
+}
+
+/* ================================
+ * Index Expression
+ *     implements LeftValue
+ * ================================ */
+// the bytes of a string are indexed, but not assigned.
+// the element of a map is assigned, but not addressed, as its entry is made by the assignment
+type IndexExpression struct {
+	array    Ast // an array, a pointer to an array, a slice, a string or a map
+	index    Ast
+	commaOk  bool       // v, ok := m[k]
+	position *AstString // reported by the runtime panic
+	ExpressionBase
+}
+
+// implements LeftValue
+func (ie *IndexExpression) emitLeft() {
+	ie.array.emit()
+	ie.index.emit()
+	t := ie.array.(Expression).getType()
+	if mt := mapOf(t); mt != nil {
+		emitCode("\tleaq\t.%s(%%rip), %%rdx", ie.position.slabel)
+		emitMapCall(mt, "_runtime_mapassign")
+		emitCode("\tpushq\t%%rax")
+		frameHeight += 8
+		return
+	}
+	emitCode("\tpopq\t%%rcx")
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 16
+	if isSlice(t) || isString(t) {
+		emitBoundsCheck("8(%rax)", ie.position)
+		emitCode("\tmovq\t0(%%rax), %%rax")
+	} else {
+		emitBoundsCheck(fmt.Sprintf("$%d", arrayOf(t).length), ie.position)
+	}
+	emitCode("\timulq\t$%d, %%rcx", ie.gtype.size())
+	emitCode("\taddq\t%%rcx, %%rax")
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// push the value of the right side and then the address of the element to store it to.
+// the element is inserted after the value is evaluated, which may grow the map
+func (ie *IndexExpression) emitMapAssignment(right Ast) {
+	ie.array.emit()
+	ie.index.emit()
+	right.emit()
+	// the value goes under the map and the key
+	emitCode("\tmovq\t0(%%rsp), %%rax")
+	emitCode("\tmovq\t8(%%rsp), %%rcx")
+	emitCode("\tmovq\t16(%%rsp), %%rdx")
+	emitCode("\tmovq\t%%rax, 16(%%rsp)")
+	emitCode("\tmovq\t%%rdx, 8(%%rsp)")
+	emitCode("\tmovq\t%%rcx, 0(%%rsp)")
+	emitCode("\tleaq\t.%s(%%rip), %%rdx", ie.position.slabel)
+	emitMapCall(mapOf(ie.array.(Expression).getType()), "_runtime_mapassign")
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// implements Ast
+func (ie *IndexExpression) emit() {
+	if mt := mapOf(ie.array.(Expression).getType()); mt != nil {
+		ie.emitMapAccess(mt)
+		return
+	}
+	ie.emitLeft()
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 8
+	emitLoad(ie.gtype, "0(%rax)")
+}
+
+// the zero value is pushed for a key not in the map, followed by whether it is in the map for comma-ok
+func (ie *IndexExpression) emitMapAccess(mt *MapType) {
+	missing := makeLabel()
+	done := makeLabel()
+	ie.array.emit()
+	ie.index.emit()
+	emitMapCall(mt, "_runtime_mapaccess")
+	emitCode("\ttestq\t%%rax, %%rax")
+	emitCode("\tje\t%s", missing)
+	emitLoad(mt.elem, "0(%rax)")
+	if ie.commaOk {
+		emitCode("\tpushq\t$1")
+		frameHeight += 8
+	}
+	emitCode("\tjmp\t%s", done)
+	emitLabel(missing)
+	frameHeight -= 8 * valueCount(ie)
+	emitZeroValue(mt.elem)
+	if ie.commaOk {
+		emitCode("\tpushq\t$0")
+		frameHeight += 8
+	}
+	emitLabel(done)
+}
+
+// call the runtime routine with the map and its key on the stack, which are popped.
+// the key is passed by its address
+func emitMapCall(mt *MapType, routine string) {
+	if isAggregate(mt.key) {
+		emitCode("\tmovq\t0(%%rsp), %%rsi")
+	} else {
+		emitCode("\tmovq\t%%rsp, %%rsi")
+	}
+	emitCode("\tmovq\t8(%%rsp), %%rdi")
+	emitRuntimeCall(routine)
+	emitCode("\taddq\t$16, %%rsp")
+	frameHeight -= 16
+}
+
+// implements Ast
+func (ie *IndexExpression) debug() {
+	debugPrintln("ast.index_expression")
+	ie.array.debug()
+	ie.index.debug()
+}
+
+// implements Ast
+func (ie *IndexExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("IndexExpression\n")
+	debugPrint(str)
+	ie.array.show(depth + 1)
+	ie.index.show(depth + 1)
+}
+
+/* ================================
+ * Selector Expression
+ *     implements LeftValue
+ * ================================ */
+// the method of x.M has the receiver as it is passed, and its value is a closure of them.
+// the value of the method of an interface value is a closure of a copy of it
+type SelectorExpression struct {
+	operand  Ast
+	name     string
+	path     []*Field // through the embedded fields, set by the checker
+	method   *FunctionSignature
+	receiver Ast
+	imethod  *Method
+	itabSlot int
+	code     string // of the value of imethod
+	ExpressionBase
+}
+
+// a struct is pushed as its address, as is a pointer to it
+func (se *SelectorExpression) emitLeft() {
+	se.operand.emit()
+	emitCode("	popq	%%rax")
+	for i, field := range se.path {
+		emitCode("	addq	$%d, %%rax", field.offset)
+		if i < len(se.path)-1 && isPointer(field.gtype) {
+			// an embedded pointer
+			emitCode("	movq	0(%%rax), %%rax")
+		}
+	}
+	emitCode("	pushq	%%rax")
+}
+
+// implements Ast
+func (se *SelectorExpression) emit() {
+	if se.method != nil || se.imethod != nil {
+		se.emitMethodValue()
+		return
+	}
+	se.emitLeft()
+	emitCode("	popq	%%rax")
+	frameHeight -= 8
+	emitLoad(se.gtype, "0(%rax)")
+}
+
+// the receiver is evaluated and copied when the method value is
+func (se *SelectorExpression) emitMethodValue() {
+	code := se.code
+	if se.imethod != nil {
+		se.operand.emit()
+		emitCopyToHeap(se.operand.(Expression).getType())
+	} else {
+		se.receiver.emit()
+		if recvType := se.method.receiver.gtype; isAggregate(recvType) {
+			emitCopyToHeap(recvType)
+		}
+		code = "_" + se.method.label() + ".fm"
+	}
+	emitAllocate(16)
+	emitCode("\tpopq\t%%rcx")
+	emitCode("\tmovq\t%%rcx, 8(%%rax)")
+	emitCode("\tleaq\t%s(%%rip), %%rcx", code)
+	emitCode("\tmovq\t%%rcx, 0(%%rax)")
+	emitCode("\tpushq\t%%rax")
+}
+
+// implements Ast
+func (se *SelectorExpression) debug() {
+	debugPrintln("ast.selector_expression")
+	se.operand.debug()
+}
+
+// implements Ast
+func (se *SelectorExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("SelectorExpression(%s)\n", se.name)
+	debugPrint(str)
+	se.operand.show(depth + 1)
+}
+
+/* ================================
+ * Method Expression
+ *     implements Ast
+ * ================================ */
+type MethodExpression struct {
+	recvType Type
+	name     string
+	code     string // the label of the function, set by the checker
+	ExpressionBase
+}
+
+// implements Ast
+func (me *MethodExpression) emit() {
+	emitCode("\tleaq\t_%s.f(%%rip), %%rax", me.code)
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// implements Ast
+func (me *MethodExpression) debug() {
+	debugPrintln("ast.method_expression")
+}
+
+// implements Ast
+func (me *MethodExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("MethodExpression(%s.%s)\n", me.recvType, me.name)
+	debugPrint(str)
+}
+
+/* ================================
+ * Function Value
+ *     implements Ast
+ * ================================ */
+// a function used as a value has a closure without context
+type FunctionValue struct {
+	sig *FunctionSignature
+	ExpressionBase
+}
+
+// implements Ast
+func (fv *FunctionValue) emit() {
+	emitCode("\tleaq\t_%s.f(%%rip), %%rax", fv.sig.label())
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// implements Ast
+func (fv *FunctionValue) debug() {
+	debugPrintln("ast.function_value")
+}
+
+// implements Ast
+func (fv *FunctionValue) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("FunctionValue(%s)\n", fv.sig.label())
+	debugPrint(str)
+}
+
+/* ================================
+ * Func Literal
+ *     implements Ast
+ * ================================ */
+// the closure of a func literal holds the addresses of the variables it captures,
+// a func literal capturing nothing has a closure without context
+type FuncLiteral struct {
+	fd *FunctionDefinition
+	ExpressionBase
+}
+
+// implements Ast
+func (fl *FuncLiteral) emit() {
+	if len(fl.fd.captures) == 0 {
+		emitCode("\tleaq\t_%s.f(%%rip), %%rax", fl.fd.fname)
+		emitCode("\tpushq\t%%rax")
+		frameHeight += 8
+		return
+	}
+	emitAllocate(8 + 8*len(fl.fd.captures))
+	emitCode("\tleaq\t_%s(%%rip), %%rcx", fl.fd.fname)
+	emitCode("\tmovq\t%%rcx, 0(%%rax)")
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+	for i, cv := range fl.fd.captures {
+		cv.outer.emitLeftValue()
+		emitCode("\tpopq\t%%rcx")
+		frameHeight -= 8
+		emitCode("\tmovq\t0(%%rsp), %%rax")
+		emitCode("\tmovq\t%%rcx, %d(%%rax)", 8+8*i)
+	}
+}
+
+// implements Ast
+func (fl *FuncLiteral) debug() {
+	debugPrintln("ast.func_literal")
+	fl.fd.debug()
+}
+
+// implements Ast
+func (fl *FuncLiteral) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("FuncLiteral(%s)\n", fl.fd.fname)
+	debugPrint(str)
+	fl.fd.ast.show(depth + 1)
+}
+
+/* ================================
+ * Composite Literal
+ *     implements LeftValue
+ * ================================ */
+type CompositeLiteral struct {
+	literalType Type
+	keys        []string // the field names, empty when positional
+	mapKeys     []Ast    // the keys of the elements of a map
+	elems       []Ast
+	fields      []*Field       // of the elements of a struct, set by the checker
+	escapes     bool           // as the operand of &
+	temporary   *LocalVariable // of a struct or an array which does not escape, set by the checker
+	ExpressionBase
+}
+
+// the value of &T{...} is on the heap
+func (cl *CompositeLiteral) emitLeft() {
+	cl.emit()
+}
+
+// push the address of the zeroed storage of a struct or an array
+func (cl *CompositeLiteral) emitStorage() {
+	if cl.temporary != nil {
+		cl.temporary.emitZero()
+		cl.temporary.emitLeftValue()
+		return
+	}
+	emitAllocate(cl.literalType.size())
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// implements Ast
+func (cl *CompositeLiteral) emit() {
+	if _, ok := cl.literalType.underlying().(*StructType); ok {
+		cl.emitStruct()
+		return
+	}
+	if mt := mapOf(cl.literalType); mt != nil {
+		cl.emitMap(mt)
+		return
+	}
+	// the elements of a slice are on the heap
+	elemType := elementOf(cl.literalType)
+	if isSlice(cl.literalType) {
+		emitAllocate(len(cl.elems) * elemType.size())
+		emitCode("\tpushq\t%%rax")
+		frameHeight += 8
+	} else {
+		cl.emitStorage()
+	}
+	for i, elem := range cl.elems {
+		elem.emit()
+		emitCode("\tpopq\t%%rcx")
+		emitCode("\tmovq\t0(%%rsp), %%rax")
+		emitCode("\taddq\t$%d, %%rax", i*elemType.size())
+		emitStore(elemType)
+		frameHeight -= 8
+	}
+	if isSlice(cl.literalType) {
+		emitSliceHeader(len(cl.elems))
+	}
+}
+
+// the fields without elements are left zero
+func (cl *CompositeLiteral) emitStruct() {
+	cl.emitStorage()
+	for i, elem := range cl.elems {
+		field := cl.fields[i]
+		elem.emit()
+		emitCode("\tpopq\t%%rcx")
+		emitCode("\tmovq\t0(%%rsp), %%rax")
+		emitCode("\taddq\t$%d, %%rax", field.offset)
+		emitStore(field.gtype)
+		frameHeight -= 8
+	}
+}
+
+// the elements are assigned in order, so the last one of a key is left
+func (cl *CompositeLiteral) emitMap(mt *MapType) {
+	emitCode("\tleaq\t%s(%%rip), %%rdi", mapDescriptorOf(mt).label())
+	emitCode("\tmovq\t$%d, %%rsi", len(cl.elems))
+	emitRuntimeCall("_runtime_makemap")
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+	for i, elem := range cl.elems {
+		elem.emit()
+		emitCode("\tpushq\t8(%%rsp)")
+		frameHeight += 8
+		cl.mapKeys[i].emit()
+		emitMapCall(mt, "_runtime_mapassign")
+		emitCode("\tpopq\t%%rcx")
+		frameHeight -= 8
+		emitStore(mt.elem)
+	}
+}
+
+// replace the address of an array on the stack with a slice of its elements
+func emitSliceHeader(length int) {
+	emitAllocate(24)
+	emitCode("\tpopq\t%%rcx")
+	emitCode("\tmovq\t%%rcx, 0(%%rax)")
+	emitCode("\tmovq\t$%d, 8(%%rax)", length)
+	emitCode("\tmovq\t$%d, 16(%%rax)", length)
+	emitCode("\tpushq\t%%rax")
+}
+
+// implements Ast
+func (cl *CompositeLiteral) debug() {
+	debugPrintln("ast.composite_literal")
+	for i, elem := range cl.elems {
+		if cl.mapKeys != nil {
+			cl.mapKeys[i].debug()
+		}
+		elem.debug()
+	}
+}
+
+// implements Ast
+func (cl *CompositeLiteral) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("CompositeLiteral(%s)\n", cl.literalType)
+	debugPrint(str)
+	for i, elem := range cl.elems {
+		if cl.mapKeys != nil {
+			cl.mapKeys[i].show(depth + 1)
+		}
+		elem.show(depth + 1)
+	}
+}
+
+/* ================================
+ * Len Expression
+ *     implements Ast
+ * ================================ */
+type LenExpression struct {
+	operand Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (le *LenExpression) emit() {
+	if le.emitFolded() {
+		return
+	}
+	t := le.operand.(Expression).getType()
+	if isMap(t) {
+		// the length of a nil map is 0
+		done := makeLabel()
+		le.operand.emit()
+		emitCode("\tpopq\t%%rax")
+		emitCode("\txorl\t%%ecx, %%ecx")
+		emitCode("\ttestq\t%%rax, %%rax")
+		emitCode("\tje\t%s", done)
+		emitCode("\tmovq\t0(%%rax), %%rcx")
+		emitLabel(done)
+		emitCode("\tpushq\t%%rcx")
+		return
+	}
+	if !isSlice(t) && !isString(t) {
+		// the length of an array is a constant
+		emitCode("\tpushq\t$%d", arrayOf(t).length)
+		frameHeight += 8
+		return
+	}
+	le.operand.emit()
+	emitCode("\tpopq\t%%rax")
+	emitCode("\tpushq\t8(%%rax)")
+}
+
+// implements Ast
+func (le *LenExpression) debug() {
+	debugPrintln("ast.len_expression")
+	le.operand.debug()
+}
+
+// implements Ast
+func (le *LenExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("LenExpression\n")
+	debugPrint(str)
+	le.operand.show(depth + 1)
+}
+
+/* ================================
+ * Conversion Expression
+ *     implements Ast
+ * ================================ */
+type ConversionExpression struct {
+	toType  Type
+	operand Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (ce *ConversionExpression) emit() {
+	if ce.emitFolded() {
+		return
+	}
+	ce.operand.emit()
+	if isInterface(ce.toType) {
+		emitInterfaceConversion(ce.operand.(Expression).getType(), ce.toType)
+		return
+	}
+	if from := ce.operand.(Expression).getType(); isFloat(from) || isFloat(ce.toType) {
+		emitCode("\tpopq\t%%rax")
+		emitFloatConversion(from, ce.toType)
+		emitCode("\tpushq\t%%rax")
+		return
+	}
+	if isInteger(ce.toType) && ce.toType.size() < 8 {
+		// the low bits of the value are extended as the new type
+		emitCode("\tpopq\t%%rax")
+		emitExtend(ce.toType)
+		emitCode("\tpushq\t%%rax")
+		return
+	}
+	routine := conversionRoutine(ce.operand.(Expression).getType(), ce.toType)
+	if routine == "" {
+		// the value is the same
+		return
+	}
+	emitCode("\tpopq\t%%rdi")
+	frameHeight -= 8
+	emitRuntimeCall(routine)
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// convert the number in %rax from or to a float, a float is truncated toward zero to an integer
+func emitFloatConversion(from Type, to Type) {
+	switch {
+	case isFloat(from) && isFloat(to):
+		if from.size() != to.size() {
+			emitCode("\tmovq\t%%rax, %%xmm0")
+			emitCode("\tcvt%s2%s\t%%xmm0, %%xmm0", floatSuffix(from), floatSuffix(to))
+			emitCode("\tmovq\t%%xmm0, %%rax")
+		}
+	case isFloat(to):
+		if isUnsigned(from) && from.size() == 8 {
+			// the conversion takes a signed operand, a value with the top bit set is halved
+			// with the low bit kept for the rounding, and doubled after the conversion
+			large := makeLabel()
+			done := makeLabel()
+			emitCode("\ttestq\t%%rax, %%rax")
+			emitCode("\tjs\t%s", large)
+			emitCode("\tcvtsi2%sq\t%%rax, %%xmm0", floatSuffix(to))
+			emitCode("\tjmp\t%s", done)
+			emitLabel(large)
+			emitCode("\tmovq\t%%rax, %%rcx")
+			emitCode("\tshrq\t%%rcx")
+			emitCode("\tandl\t$1, %%eax")
+			emitCode("\torq\t%%rax, %%rcx")
+			emitCode("\tcvtsi2%sq\t%%rcx, %%xmm0", floatSuffix(to))
+			emitCode("\tadd%s\t%%xmm0, %%xmm0", floatSuffix(to))
+			emitLabel(done)
+		} else {
+			// a smaller integer is extended to 64 bits already
+			emitCode("\tcvtsi2%sq\t%%rax, %%xmm0", floatSuffix(to))
+		}
+		emitCode("\tmovq\t%%xmm0, %%rax")
+	default:
+		emitCode("\tmovq\t%%rax, %%xmm0")
+		if from.size() == 4 {
+			emitCode("\tcvtss2sd\t%%xmm0, %%xmm0")
+		}
+		if isUnsigned(to) && to.size() == 8 {
+			// cvttsd2si gives a signed result, a value from 2^63 is converted less 2^63
+			large := makeLabel()
+			done := makeLabel()
+			emitCode("\tmovabsq\t$0x%x, %%rcx", math.Float64bits(1<<63))
+			emitCode("\tmovq\t%%rcx, %%xmm1")
+			emitCode("\tucomisd\t%%xmm1, %%xmm0")
+			emitCode("\tjae\t%s", large)
+			emitCode("\tcvttsd2siq\t%%xmm0, %%rax")
+			emitCode("\tjmp\t%s", done)
+			emitLabel(large)
+			emitCode("\tsubsd\t%%xmm1, %%xmm0")
+			emitCode("\tcvttsd2siq\t%%xmm0, %%rax")
+			emitCode("\tbtcq\t$63, %%rax")
+			emitLabel(done)
+		} else {
+			emitCode("\tcvttsd2siq\t%%xmm0, %%rax")
+		}
+		emitExtend(to)
+	}
+}
+
+// the runtime routine of a conversion from or to a string, or ""
+func conversionRoutine(from Type, to Type) string {
+	switch {
+	case isString(to) && isInteger(from):
+		return "_runtime_intstring"
+	case isString(to) && isSlice(from):
+		if elementOf(from).size() == 1 {
+			return "_runtime_slicebytetostring"
+		}
+		return "_runtime_slicerunetostring"
+	case isSlice(to) && isString(from):
+		if elementOf(to).size() == 1 {
+			return "_runtime_stringtoslicebyte"
+		}
+		return "_runtime_stringtoslicerune"
+	}
+	return ""
+}
+
+// implements Ast
+func (ce *ConversionExpression) debug() {
+	debugPrintln("ast.conversion_expression")
+	ce.operand.debug()
+}
+
+// implements Ast
+func (ce *ConversionExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("ConversionExpression(%s)\n", ce.toType)
+	debugPrint(str)
+	ce.operand.show(depth + 1)
+}
+
+// replace the value on the stack with an interface value holding it,
+// an interface value is converted with its dynamic type and value
+func emitInterfaceConversion(from Type, to Type) {
+	if isInterface(from) {
+		if identical(from.underlying(), to.underlying()) || isEmptyInterface(from) && isEmptyInterface(to) {
+			// the words are the same
+			return
+		}
+		isNil := makeLabel()
+		done := makeLabel()
+		emitCode("\tpopq\t%%rax")
+		frameHeight -= 8
+		emitDynamicType(from)
+		emitCode("\ttestq\t%%rcx, %%rcx")
+		emitCode("\tje\t%s", isNil)
+		emitConvertDynamic(to, "")
+		emitCode("\tjmp\t%s", done)
+		emitLabel(isNil)
+		emitCode("\tleaq\t.runtime_zero(%%rip), %%rax")
+		emitCode("\tpushq\t%%rax")
+		emitLabel(done)
+		return
+	}
+	if !isPointerShaped(from) {
+		// the value is boxed, to be shared by the copies of the interface value
+		emitCopyToHeap(from)
+	}
+	emitCode("\tpopq\t%%rcx")
+	emitCode("\tleaq\t%s(%%rip), %%rax", typeWordOf(from, to))
+	emitCode("\tpushq\t%%rax")
+	emitCode("\tpushq\t%%rcx")
+	frameHeight += 8
+	emitInterfaceHeader()
+}
+
+// replace the first and the second words on the stack with an interface value of them
+func emitInterfaceHeader() {
+	emitAllocate(16)
+	emitCode("\tpopq\t%%rcx")
+	emitCode("\tmovq\t%%rcx, 8(%%rax)")
+	emitCode("\tpopq\t%%rcx")
+	emitCode("\tmovq\t%%rcx, 0(%%rax)")
+	emitCode("\tpushq\t%%rax")
+	frameHeight -= 8
+}
+
+// load the descriptor of the dynamic type of the interface value at %rax into %rcx,
+// which is 0 for nil
+func emitDynamicType(gtype Type) {
+	emitCode("\tmovq\t0(%%rax), %%rcx")
+	if !isEmptyInterface(gtype) {
+		isNil := makeLabel()
+		emitCode("\ttestq\t%%rcx, %%rcx")
+		emitCode("\tje\t%s", isNil)
+		emitCode("\tmovq\t0(%%rcx), %%rcx")
+		emitLabel(isNil)
+	}
+}
+
+// push an interface value with the dynamic value of the one at %rax, whose descriptor is in %rcx.
+// unless the dynamic type implements the interface, it jumps to the label
+// with the descriptor in %rcx and the name of the missing method in %rdx
+func emitConvertDynamic(to Type, fail string) {
+	emitCode("\tpushq\t%%rcx")
+	frameHeight += 8
+	if isEmptyInterface(to) {
+		emitCode("\tpushq\t8(%%rax)")
+		frameHeight += 8
+		emitInterfaceHeader()
+		return
+	}
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+	emitCode("\tleaq\t%s(%%rip), %%rdi", interfaceDescriptorOf(to).label())
+	emitCode("\tmovq\t%%rcx, %%rsi")
+	emitRuntimeCall("_runtime_lookupitab")
+	emitCode("\tpopq\t%%rcx")
+	frameHeight -= 8
+	if fail != "" {
+		found := makeLabel()
+		emitCode("\ttestq\t%%rax, %%rax")
+		emitCode("\tjne\t%s", found)
+		emitCode("\tpopq\t%%rcx")
+		emitCode("\tjmp\t%s", fail)
+		emitLabel(found)
+	}
+	// the itab replaces the descriptor
+	emitCode("\tmovq\t%%rax, 0(%%rsp)")
+	emitCode("\tpushq\t8(%%rcx)")
+	frameHeight += 8
+	emitInterfaceHeader()
+}
+
+/* ================================
+ * Type Assert Expression
+ *     implements Ast
+ * ================================ */
+// the comma-ok form pushes the value and whether the assertion holds,
+// instead of panicking with the names of the types
+type TypeAssertExpression struct {
+	operand    Ast
+	assertType Type // nil for x.(type) of a type switch
+	commaOk    bool
+	position   *AstString
+	staticName *AstString // set by the checker
+	assertName *AstString
+	ExpressionBase
+}
+
+// implements Ast
+func (ta *TypeAssertExpression) emit() {
+	fail := makeLabel()
+	done := makeLabel()
+	ta.operand.emit()
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 8
+	emitDynamicType(ta.operand.(Expression).getType())
+	// no method is missing but for an interface
+	emitCode("\txorl\t%%edx, %%edx")
+	if isInterface(ta.assertType) {
+		emitCode("\ttestq\t%%rcx, %%rcx")
+		emitCode("\tje\t%s", fail)
+		emitConvertDynamic(ta.assertType, fail)
+	} else {
+		emitCode("\tleaq\t%s(%%rip), %%r11", descriptorOf(ta.assertType).label())
+		emitCode("\tcmpq\t%%r11, %%rcx")
+		emitCode("\tjne\t%s", fail)
+		emitCode("\tmovq\t8(%%rax), %%rax")
+		emitUnbox(ta.assertType)
+	}
+	if ta.commaOk {
+		emitCode("\tpushq\t$1")
+		frameHeight += 8
+	}
+	emitCode("\tjmp\t%s", done)
+	emitLabel(fail)
+	frameHeight -= 8 * valueCount(ta)
+	if ta.commaOk {
+		emitZeroValue(ta.assertType)
+		emitCode("\tpushq\t$0")
+		frameHeight += 8
+	} else {
+		emitCode("\tmovq\t%%rdx, %%r8")
+		emitCode("\tleaq\t.%s(%%rip), %%rdi", ta.staticName.slabel)
+		emitCode("\tmovq\t%%rcx, %%rsi")
+		emitCode("\tleaq\t.%s(%%rip), %%rdx", ta.assertName.slabel)
+		emitCode("\tleaq\t.%s(%%rip), %%rcx", ta.position.slabel)
+		emitCode("\tcallq\t_runtime_panicassert")
+		frameHeight += 8
+	}
+	emitLabel(done)
+}
+
+// push the value of the type from the second word of an interface value in %rax
+func emitUnbox(gtype Type) {
+	if isPointerShaped(gtype) {
+		emitCode("\tpushq\t%%rax")
+		frameHeight += 8
+		return
+	}
+	emitLoad(gtype, "0(%rax)")
+}
+
+func emitZeroValue(gtype Type) {
+	if isAggregate(gtype) {
+		emitAllocate(gtype.size())
+		emitCode("\tpushq\t%%rax")
+	} else {
+		emitCode("\tpushq\t$0")
+	}
+	frameHeight += 8
+}
+
+// implements Ast
+func (ta *TypeAssertExpression) debug() {
+	debugPrintln("ast.type_assert_expression")
+	ta.operand.debug()
+}
+
+// implements Ast
+func (ta *TypeAssertExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("TypeAssertExpression(%s)\n", ta.assertType)
+	debugPrint(str)
+	ta.operand.show(depth + 1)
+}
+
+/* ================================
+ * Cap Expression
+ *     implements Ast
+ * ================================ */
+type CapExpression struct {
+	operand Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (ce *CapExpression) emit() {
+	t := ce.operand.(Expression).getType()
+	if !isSlice(t) {
+		emitCode("\tpushq\t$%d", arrayOf(t).length)
+		frameHeight += 8
+		return
+	}
+	ce.operand.emit()
+	emitCode("\tpopq\t%%rax")
+	emitCode("\tpushq\t16(%%rax)")
+}
+
+// implements Ast
+func (ce *CapExpression) debug() {
+	debugPrintln("ast.cap_expression")
+	ce.operand.debug()
+}
+
+// implements Ast
+func (ce *CapExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("CapExpression\n")
+	debugPrint(str)
+	ce.operand.show(depth + 1)
+}
+
+/* ================================
+ * Slice Expression
+ *     implements Ast
+ * ================================ */
+type SliceExpression struct {
+	operand  Ast // an array, a pointer to an array, a slice or a string
+	low      Ast // optional
+	high     Ast // optional
+	max      Ast // optional
+	position *AstString
+	ExpressionBase
+}
+
+// implements Ast
+func (se *SliceExpression) emit() {
+	t := se.operand.(Expression).getType()
+	se.operand.emit()
+	for _, index := range []Ast{se.low, se.high, se.max} {
+		if index != nil {
+			index.emit()
+		}
+	}
+	// %r8 is low, %r9 high, %r10 max, %r11 the capacity
+	if se.max != nil {
+		emitCode("\tpopq\t%%r10")
+		frameHeight -= 8
+	}
+	if se.high != nil {
+		emitCode("\tpopq\t%%r9")
+		frameHeight -= 8
+	}
+	if se.low != nil {
+		emitCode("\tpopq\t%%r8")
+		frameHeight -= 8
+	} else {
+		emitCode("\txorl\t%%r8d, %%r8d")
+	}
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 8
+	lengthFormat, slice3LengthFormat := runtimeErrorSliceLength, runtimeErrorSlice3Length
+	if isString(t) {
+		// the capacity of a string is its length
+		emitCode("\tmovq\t8(%%rax), %%r11")
+		if se.high == nil {
+			emitCode("\tmovq\t%%r11, %%r9")
+		}
+		emitCode("\tmovq\t0(%%rax), %%rax")
+	} else if isSlice(t) {
+		lengthFormat, slice3LengthFormat = runtimeErrorSliceCapacity, runtimeErrorSlice3Capacity
+		emitCode("\tmovq\t16(%%rax), %%r11")
+		if se.high == nil {
+			emitCode("\tmovq\t8(%%rax), %%r9")
+		}
+		emitCode("\tmovq\t0(%%rax), %%rax")
+	} else {
+		emitCode("\tmovq\t$%d, %%r11", arrayOf(t).length)
+		if se.high == nil {
+			emitCode("\tmovq\t%%r11, %%r9")
+		}
+	}
+	if se.max != nil {
+		emitRangeCheck("%r10", "%r11", "jbe", slice3LengthFormat, se.position)
+		emitRangeCheck("%r9", "%r10", "jbe", runtimeErrorSlice3OrderHigh, se.position)
+		emitRangeCheck("%r8", "%r9", "jbe", runtimeErrorSlice3OrderLow, se.position)
+	} else {
+		emitCode("\tmovq\t%%r11, %%r10")
+		emitRangeCheck("%r9", "%r11", "jbe", lengthFormat, se.position)
+		emitRangeCheck("%r8", "%r9", "jbe", runtimeErrorSliceOrder, se.position)
+	}
+	if isString(se.gtype) {
+		emitCode("\taddq\t%%r8, %%rax")
+	} else {
+		emitCode("\tmovq\t%%r8, %%rcx")
+		emitCode("\timulq\t$%d, %%rcx", elementOf(se.gtype).size())
+		emitCode("\taddq\t%%rcx, %%rax")
+	}
+	emitCode("\tsubq\t%%r8, %%r9")
+	emitCode("\tsubq\t%%r8, %%r10")
+	emitCode("\tpushq\t%%rax")
+	emitCode("\tpushq\t%%r9")
+	emitCode("\tpushq\t%%r10")
+	frameHeight += 24
+	emitAllocate(se.gtype.size())
+	emitCode("\tpopq\t%%rcx")
+	if !isString(se.gtype) {
+		emitCode("\tmovq\t%%rcx, 16(%%rax)")
+	}
+	emitCode("\tpopq\t%%rcx")
+	emitCode("\tmovq\t%%rcx, 8(%%rax)")
+	emitCode("\tpopq\t%%rcx")
+	emitCode("\tmovq\t%%rcx, 0(%%rax)")
+	emitCode("\tpushq\t%%rax")
+	frameHeight -= 16
+}
+
+// implements Ast
+func (se *SliceExpression) debug() {
+	debugPrintln("ast.slice_expression")
+	se.operand.debug()
+}
+
+// implements Ast
+func (se *SliceExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("SliceExpression\n")
+	debugPrint(str)
+	se.operand.show(depth + 1)
+	for _, index := range []Ast{se.low, se.high, se.max} {
+		if index != nil {
+			index.show(depth + 1)
+		}
+	}
+}
+
+/* ================================
+ * Make Expression
+ *     implements Ast
+ * ================================ */
+// the length of a map is the hint of its size, and optional
+type MakeExpression struct {
+	makeType Type
+	length   Ast
+	capacity Ast // optional
+	position *AstString
+	ExpressionBase
+}
+
+// implements Ast
+func (me *MakeExpression) emit() {
+	if isMap(me.makeType) {
+		me.emitMap()
+		return
+	}
+	me.length.emit()
+	if me.capacity != nil {
+		me.capacity.emit()
+		emitCode("\tpopq\t%%rsi")
+		emitCode("\tpopq\t%%rdi")
+		frameHeight -= 16
+	} else {
+		emitCode("\tpopq\t%%rdi")
+		emitCode("\tmovq\t%%rdi, %%rsi")
+		frameHeight -= 8
+	}
+	emitCode("\tmovq\t$%d, %%rdx", elementOf(me.makeType).size())
+	emitCode("\tleaq\t.%s(%%rip), %%rcx", me.position.slabel)
+	emitRuntimeCall("_runtime_makeslice")
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+func (me *MakeExpression) emitMap() {
+	if me.length != nil {
+		me.length.emit()
+		emitCode("\tpopq\t%%rsi")
+		frameHeight -= 8
+	} else {
+		emitCode("\txorl\t%%esi, %%esi")
+	}
+	emitCode("\tleaq\t%s(%%rip), %%rdi", mapDescriptorOf(me.makeType).label())
+	emitRuntimeCall("_runtime_makemap")
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// implements Ast
+func (me *MakeExpression) debug() {
+	debugPrintln("ast.make_expression")
+	if me.length != nil {
+		me.length.debug()
+	}
+}
+
+// implements Ast
+func (me *MakeExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("MakeExpression(%s)\n", me.makeType)
+	debugPrint(str)
+	if me.length != nil {
+		me.length.show(depth + 1)
+	}
+	if me.capacity != nil {
+		me.capacity.show(depth + 1)
+	}
+}
+
+/* ================================
+ * Append Expression
+ *     implements Ast
+ * ================================ */
+type AppendExpression struct {
+	slice  Ast
+	values []Ast
+	spread bool // append(s, t...)
+	ExpressionBase
+}
+
+// implements Ast
+func (ae *AppendExpression) emit() {
+	elemType := elementOf(ae.gtype)
+	// the result is a new header
+	ae.slice.emit()
+	emitCopyToHeap(ae.gtype)
+	if ae.spread {
+		ae.values[0].emit()
+		emitCode("\tpopq\t%%rsi")
+		frameHeight -= 8
+		emitCode("\tmovq\t0(%%rsp), %%rdi")
+		emitCode("\tmovq\t$%d, %%rdx", elemType.size())
+		emitRuntimeCall("_runtime_appendslice")
+		return
+	}
+	if len(ae.values) == 0 {
+		return
+	}
+	emitCode("\tmovq\t0(%%rsp), %%rdi")
+	emitCode("\tmovq\t$%d, %%rsi", len(ae.values))
+	emitCode("\tmovq\t$%d, %%rdx", elemType.size())
+	emitRuntimeCall("_runtime_growslice")
+	for i, value := range ae.values {
+		value.emit()
+		emitCode("\tpopq\t%%rcx")
+		frameHeight -= 8
+		// the address of the element len-n+i
+		emitCode("\tmovq\t0(%%rsp), %%rax")
+		emitCode("\tmovq\t8(%%rax), %%rdx")
+		emitCode("\tsubq\t$%d, %%rdx", len(ae.values)-i)
+		emitCode("\timulq\t$%d, %%rdx", elemType.size())
+		emitCode("\taddq\t0(%%rax), %%rdx")
+		emitCode("\tmovq\t%%rdx, %%rax")
+		emitStore(elemType)
+	}
+}
+
+// implements Ast
+func (ae *AppendExpression) debug() {
+	debugPrintln("ast.append_expression")
+	ae.slice.debug()
+	for _, value := range ae.values {
+		value.debug()
+	}
+}
+
+// implements Ast
+func (ae *AppendExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("AppendExpression\n")
+	debugPrint(str)
+	ae.slice.show(depth + 1)
+	for _, value := range ae.values {
+		value.show(depth + 1)
+	}
+}
+
+/* ================================
+ * Copy Expression
+ *     implements Ast
+ * ================================ */
+type CopyExpression struct {
+	dst Ast
+	src Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (ce *CopyExpression) emit() {
+	ce.dst.emit()
+	ce.src.emit()
+	emitCode("\tpopq\t%%rsi")
+	emitCode("\tpopq\t%%rdi")
+	frameHeight -= 16
+	emitCode("\tmovq\t$%d, %%rdx", elementOf(ce.dst.(Expression).getType()).size())
+	emitRuntimeCall("_runtime_slicecopy")
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// implements Ast
+func (ce *CopyExpression) debug() {
+	debugPrintln("ast.copy_expression")
+	ce.dst.debug()
+	ce.src.debug()
+}
+
+// implements Ast
+func (ce *CopyExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("CopyExpression\n")
+	debugPrint(str)
+	ce.dst.show(depth + 1)
+	ce.src.show(depth + 1)
+}
+
+/* ================================
+ * Delete Expression
+ *     implements Ast
+ * ================================ */
+// delete(m, k) has no value, so nothing is pushed
+type DeleteExpression struct {
+	m   Ast
+	key Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (de *DeleteExpression) emit() {
+	de.m.emit()
+	de.key.emit()
+	emitMapCall(mapOf(de.m.(Expression).getType()), "_runtime_mapdelete")
+}
+
+// implements Ast
+func (de *DeleteExpression) debug() {
+	debugPrintln("ast.delete_expression")
+	de.m.debug()
+	de.key.debug()
+}
+
+// implements Ast
+func (de *DeleteExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("DeleteExpression\n")
+	debugPrint(str)
+	de.m.show(depth + 1)
+	de.key.show(depth + 1)
+}
+
+/* ================================
+ * New Expression
+ *     implements Ast
+ * ================================ */
+type NewExpression struct {
+	elem Type
+	ExpressionBase
+}
+
+// implements Ast
+func (ne *NewExpression) emit() {
+	emitAllocate(ne.elem.size())
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// implements Ast
+func (ne *NewExpression) debug() {
+	debugPrintln("ast.new_expression")
+}
+
+// implements Ast
+func (ne *NewExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("NewExpression(%s)\n", ne.elem)
+	debugPrint(str)
+}
+
+/* ================================
+ * Primary Expression
+ *     implements Ast
+ * ================================ */
+type PrimaryExpression struct {
+	child Ast
+	ExpressionBase
+}
+
+// implements Ast
+func (pe *PrimaryExpression) emit() {
+	if pe.emitFolded() {
+		// converted to the type of the context
+		return
+	}
+	pe.child.emit()
+}
+
+// implements Condition
+func (pe *PrimaryExpression) emitJump(label string, jumpIf bool) {
+	emitBranch(pe.child, label, jumpIf)
+}
+
+// implements Ast
+func (pe *PrimaryExpression) debug() {
+	debugPrintln("ast.primary_expression")
+	pe.child.debug()
+}
+
+// implements Ast
+func (pe *PrimaryExpression) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("PrimaryExpression\n")
+	debugPrint(str)
+	pe.child.show(depth + 1)
+}
+
+/* ================================
+ * AstConstant
+ *     implements Ast
+ * ================================ */
+// the constant of a literal is set by the parser
+type AstConstant struct {
+	ExpressionBase
+}
+
+// implements Ast
+func (ac *AstConstant) emit() {
+	if isAggregate(ac.gtype) {
+		// a nil slice
+		emitCode("\tleaq\t.runtime_zero(%%rip), %%rax")
+		emitCode("\tpushq\t%%rax")
+		frameHeight += 8
+		return
+	}
+	ac.constant.emitConstant(ac.gtype)
+}
+
+// implements Ast
+func (ac *AstConstant) debug() {
+	debugPrintlnWithVariable("ast.constant", ac.constant)
+}
+
+// implements Ast
+func (ac *AstConstant) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("AstConstant (%s)\n", ac.constant.toStringValue(ac.gtype))
+	debugPrint(str)
+}
+
+/* ================================
+ * Identifier
+ *     implements Ast and LeftValue
+ * ================================ */
+type Identifier struct {
+	symbol Symbol
+	ExpressionBase
+}
+
+// implements LeftValue
+func (id *Identifier) emitLeft() {
+	id.symbol.emitLeftValue()
+}
+
+// implements Ast
+func (id *Identifier) emit() {
+	if id.emitFolded() {
+		// a named constant, as the type of the context
+		return
+	}
+	id.symbol.emitRightValue()
+}
+
+// implements Ast
+func (id *Identifier) debug() {
+	debugPrintlnWithVariable("ast.identifier", id.symbol.getName())
+}
+
+// implemebts Ast
+func (id *Identifier) show(depth int) {
+	str := printSpace(depth)
+	str += fmt.Sprintf("Identifier(%s)\n", id.symbol.getName())
+	debugPrint(str)
+}
+
+/* ================================
+ * FunCall
+ *     implements Ast
+ * ================================ */
+// a call of a func value has the function instead of the name,
+// and a method call has the receiver as the first argument.
+// the method of an interface value is called through the itab with the second word.
+// the aggregate results are copied by the callee to the result area of the caller,
+// whose address is pushed before the return address
+type FunCall struct {
+	fname      string
+	args       []Ast
+	function   Ast
+	receiver   Ast
+	sig        *FunctionSignature // set by the checker, nil for C functions and func values
+	imethod    *Method            // of an interface, set by the checker
+	itabSlot   int
+	resultArea *LocalVariable // set by the checker, nil without aggregate results
+	ExpressionBase
+}
+
+// the result area of the call is laid out as a struct of the aggregate results, or nil
+func resultAreaOf(results []Type) *StructType {
+	var fields []*Field
+	for _, t := range results {
+		if isAggregate(t) {
+			fields = append(fields, &Field{gtype: t})
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	st := newStructType(fields)
+	st.layout()
+	return st
+}
+
+// number of values pushed by the call
+func (fc *FunCall) resultCount() int {
+	return len(fc.resultTypes())
+}
+
+// the types of the values pushed by the call; C functions return a single int,
+// and a call without results pushes a value to be thrown away
+func (fc *FunCall) resultTypes() []Type {
+	var results []Type
+	if fc.function != nil {
+		results = fc.function.(Expression).getType().underlying().(*FuncType).results
+	} else if fc.sig != nil {
+		results = fc.sig.funcType().results
+	} else if fc.imethod != nil {
+		results = fc.imethod.gtype.results
+	}
+	if len(results) == 0 {
+		return []Type{tInt}
+	}
+	return results
+}
+
+// number of values an expression pushes onto the stack
+func valueCount(ast Ast) int {
+	switch v := ast.(type) {
+	case *FunCall:
+		return v.resultCount()
+	case *TypeAssertExpression:
+		if v.commaOk {
+			return 2
+		}
+	case *IndexExpression:
+		if v.commaOk {
+			return 2
+		}
+	case *DeleteExpression:
+		return 0
+	}
+	return 1
+}
+
+// implements Ast
+func (fc *FunCall) emit() {
+	// stacking paddings
+	var fh int
+	// emitCode("# frame height %d before arguments", frameHeight)
+	// fh = (frameHeight + 8*len(fc.args)) % 16   // for argument
+	fh = frameHeight % 16
+	if fc.resultArea != nil {
+		fh = (frameHeight + 8) % 16
+	}
+	if fh != 0 {
+		padding := 16 - fh
+		emitCode("\tsubq\t$%d, %%rsp  # stack padding", padding)
+		frameHeight += padding
+	}
+	if fc.resultArea != nil {
+		// the address is left on the top of the stack by the call
+		fc.resultArea.emitLeftValue()
+	}
+
+	isC := fc.sig == nil && fc.function == nil && fc.imethod == nil
+	if fc.function != nil {
+		fc.function.emit()
+	}
+	args := fc.args
+	if fc.receiver != nil {
+		args = append([]Ast{fc.receiver}, args...)
+	}
+	var types []Type
+	for _, arg := range args {
+		types = append(types, arg.(Expression).getType())
+		if isC && isString(arg.(Expression).getType()) {
+			emitCString(arg)
+			continue
+		}
+		arg.emit()
+	}
+
+	registers := assignRegisters(types, regs, fc.receiver != nil)
+	vectors := 0
+	for i, _ := range args {
+		j := len(args) - 1 - i
+		emitPopRegister(registers[j])
+		frameHeight -= 8
+		if isFloat(types[j]) {
+			vectors++
+			if isC && types[j].size() == 4 {
+				// a variadic C function takes a float32 as a double
+				emitCode("\tcvtss2sd\t%%%s, %%%s", registers[j], registers[j])
+			}
+		}
+	}
+	// emitCode("# frame height %d after arguments", frameHeight)
+	// the number of the vector registers for a variadic C function
+	emitCode("\tmovq\t$%d, %%rax", vectors)
+	if fc.function != nil {
+		// the func value is the address of its closure, which starts with the code
+		emitCode("\tpopq\t%%r10")
+		frameHeight -= 8
+		emitCode("\tcallq\t*0(%%r10)\t# frame height %d", frameHeight)
+	} else if fc.imethod != nil {
+		// the receiver is the interface value
+		emitCode("\tmovq\t0(%%rdi), %%r11")
+		emitCode("\tmovq\t8(%%rdi), %%rdi")
+		emitCode("\tcallq\t*%d(%%r11)\t# frame height %d", fc.itabSlot, frameHeight)
+	} else if fc.sig != nil {
+		emitCode("\tcallq\t_%s\t# frame height %d", fc.sig.label(), frameHeight)
+	} else {
+		emitCode("\tcallq\t_%s\t# frame height %d", fc.fname, frameHeight)
+	}
+	if isC {
+		// C functions return a 32-bit int
+		emitCode("\tcltq")
+	}
+
+	if fc.resultArea != nil {
+		emitCode("\taddq\t$8, %%rsp  # pop the result area")
+		frameHeight -= 8
+	}
+	if fh != 0 {
+		padding := 16 - fh
+		emitCode("\taddq\t$%d, %%rsp  # pop padding", padding)
+		frameHeight -= padding
+	}
+
+	// push the return values
+	for _, reg := range assignRegisters(fc.resultTypes(), retRegs, false) {
+		emitPushRegister(reg)
+		frameHeight += 8
+	}
+}
+
+// push a NUL-terminated copy of the string for C functions,
+// the bytes of a literal are already terminated
+func emitCString(ast Ast) {
+	if pe, ok := ast.(*PrimaryExpression); ok {
+		ast = pe.child
+	}
+	if as, ok := ast.(*AstString); ok {
+		emitCode("\tleaq\t.%s(%%rip), %%rax", as.slabel)
+		emitCode("\tpushq\t%%rax")
+		frameHeight += 8
+		return
+	}
+	ast.emit()
+	emitCode("\tpopq\t%%rdi")
+	frameHeight -= 8
+	emitRuntimeCall("_runtime_cstring")
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
 // implements Ast
 func (fc *FunCall) debug() {
 	debugPrintln("ast.funcall")
@@ -499,8 +3332,14 @@ func (fc *FunCall) debug() {
 // implements Ast
 func (fc *FunCall) show(depth int) {
 	str := printSpace(depth)
-	str += fmt.Sprintf("FunCall\n")
+	str += fmt.Sprintf("FunCall(%s)\n", fc.fname)
 	debugPrint(str)
+	if fc.function != nil {
+		fc.function.show(depth + 1)
+	}
+	if fc.receiver != nil {
+		fc.receiver.show(depth + 1)
+	}
 	for _, v := range fc.args {
 		v.show(depth + 1)
 	}
@@ -513,11 +3352,12 @@ func (fc *FunCall) show(depth int) {
 type AstString struct {
 	sval   string
 	slabel string
+	ExpressionBase
 }
 
 // implement Ast
 func (as *AstString) emit() {
-	emitCode("\tleaq\t.%s(%%rip), %%rax", as.slabel)
+	emitCode("\tleaq\t.%s.header(%%rip), %%rax", as.slabel)
 	emitCode("\tpushq\t%%rax")
 	frameHeight += 8
 }
@@ -2,15 +2,19 @@ package main
 
 import (
 	"errors"
+	"strings"
+	"unicode/utf8"
 )
 
 /* ================================
  * ByteStream
+ *     the source is read by bytes, and columns are counted in runes
  * ================================ */
 
 type ByteStream struct {
-	source string
-	index  int
+	source  string
+	index   int
+	decoded int // the end of the runes whose encoding is checked
 	SourceFile
 }
 
@@ -19,22 +23,52 @@ func (bs *ByteStream) getc() (byte, error) {
 		return 0, errors.New("EOF")
 	}
 	r := bs.source[bs.index]
+	if r >= utf8.RuneSelf && bs.index >= bs.decoded {
+		_, size := utf8.DecodeRuneInString(bs.source[bs.index:])
+		if size == 1 {
+			pos := bs.SourceFile
+			pos.column++
+			putErrorAt(&Token{SourceFile: pos}, "Invalid UTF-8 encoding.")
+		}
+		bs.decoded = bs.index + size
+	}
+	bs.index++
 	if r == '\r' || r == '\n' {
 		bs.line++
 		bs.column = 0
+	} else if utf8.RuneStart(r) {
+		bs.column++
 	}
-	bs.index++
-	bs.column++
 	return r, nil
 }
 
+// the next byte, or 0 at the end
+func (bs *ByteStream) peekc() byte {
+	if bs.index >= len(bs.source) {
+		return 0
+	}
+	return bs.source[bs.index]
+}
+
+// the next rune and its size, or 0 at the end
+func (bs *ByteStream) peekRune() (rune, int) {
+	if bs.index >= len(bs.source) {
+		return 0, 0
+	}
+	return utf8.DecodeRuneInString(bs.source[bs.index:])
+}
+
 func (bs *ByteStream) ungetc() {
 	if bs.index > 0 {
 		bs.index--
 		r := bs.source[bs.index]
 		if r == '\r' || r == '\n' {
 			bs.line--
-			bs.column = -1
+			// column of the last character of the previous line
+			start := strings.LastIndexAny(bs.source[:bs.index], "\r\n") + 1
+			bs.column = utf8.RuneCountInString(bs.source[start:bs.index])
+		} else if utf8.RuneStart(r) {
+			bs.column--
 		}
 	}
 }
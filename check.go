@@ -0,0 +1,1696 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+)
+
+/* ================================
+ * Type checker
+ *     annotates every expression with its type,
+ *     and lays out the stack frames of functions
+ * ================================ */
+
+var checkingFunction *FunctionDefinition
+
+func check(ast Ast) {
+	if ast == nil {
+		return
+	}
+	checkStatement(ast)
+}
+
+func checkStatement(ast Ast) {
+	switch v := ast.(type) {
+	case *TranslationUnit:
+		for _, child := range v.childs {
+			checkStatement(child)
+		}
+	case *GlobalDeclaration:
+		for _, sym := range v.syms {
+			checkGlobalVariable(sym)
+		}
+	case *FunctionDefinition:
+		checkFunctionDefinition(v)
+	case *Statement:
+		checkStatement(v.ast)
+	case *CompoundStatement:
+		saved := frameOffset
+		for _, statement := range v.statements {
+			checkStatement(statement)
+		}
+		frameOffset = saved
+	case *ExpressionStatement:
+		checkExpressionStatement(v)
+	case *DeclarationStatement:
+		checkDeclarationStatement(v)
+	case *ConstDeclaration:
+		// checked as they are parsed
+	case *TypeDeclaration:
+		for _, nt := range v.types {
+			// lay out the structs, finding the recursive ones
+			nt.size()
+		}
+	case *MultipleAssignmentStatement:
+		checkMultipleAssignment(v, nil)
+	case *IfStatement:
+		saved := frameOffset
+		if v.init != nil {
+			checkStatement(v.init)
+		}
+		checkCondition(v.cond)
+		checkStatement(v.then)
+		if v.els != nil {
+			checkStatement(v.els)
+		}
+		frameOffset = saved
+	case *ForStatement:
+		saved := frameOffset
+		if v.init != nil {
+			checkStatement(v.init)
+		}
+		if v.cond != nil {
+			checkCondition(v.cond)
+		}
+		if v.post != nil {
+			checkStatement(v.post)
+		}
+		checkStatement(v.body)
+		frameOffset = saved
+	case *ForRangeStatement:
+		saved := frameOffset
+		checkForRangeStatement(v)
+		checkStatement(v.body)
+		frameOffset = saved
+	case *TypeSwitchStatement:
+		saved := frameOffset
+		checkTypeSwitchStatement(v)
+		frameOffset = saved
+	case *ExpressionSwitchStatement:
+		saved := frameOffset
+		checkExpressionSwitchStatement(v)
+		frameOffset = saved
+	case *JumpStatement:
+		// nothing to check
+	case *ReturnStatement:
+		checkReturnStatement(v)
+	default:
+		putError("Unexpected statement %T in type checker.", ast)
+	}
+}
+
+func checkGlobalVariable(sym *GlobalVariable) {
+	if sym.init == nil {
+		// any type has a zero value
+		return
+	}
+	t := checkExpression(sym.init)
+	sym.initval = constantOf(sym.init)
+	if sym.initval == nil {
+		putError("Initializer of global variable %s must be a constant.", sym.name)
+	}
+	if sym.gtype == nil {
+		sym.gtype = defaultType(t)
+	}
+	if !assignable(t, sym.gtype) {
+		putError("Cannot use %s as %s value in global variable %s.", t, sym.gtype, sym.name)
+	}
+	if !isNumeric(sym.gtype) && !isString(sym.gtype) && !isBoolean(sym.gtype) {
+		putError("Acceptable global variable is number, string or boolean, but got %s", sym.gtype)
+	}
+	convertUntyped(sym.init, sym.gtype)
+	sym.initval = constantOf(sym.init)
+}
+
+// the value is converted to the type of the declaration, if any
+func checkNamedConstant(tok *Token, nc *NamedConstant) {
+	t := checkExpression(nc.expr)
+	nc.value = constantOf(nc.expr)
+	if nc.value == nil {
+		putErrorAt(tok, "Initializer of constant %s must be a constant.", nc.name)
+	}
+	if nc.gtype == nil {
+		nc.gtype = t
+		return
+	}
+	if bt := basicOf(nc.gtype); bt == nil || bt.kind == KIND_NIL {
+		putErrorAt(tok, "Invalid constant type %s.", nc.gtype)
+	}
+	checkAssignability(nc.expr, nc.gtype)
+	nc.value = constantOf(nc.expr)
+}
+
+func checkFunctionDefinition(fd *FunctionDefinition) {
+	if fd.sig.receiver != nil {
+		checkMethodReceiver(fd.sig)
+	}
+	// a float type may be declared after the signature
+	if !fitsRegisters(fd.sig.funcType().params, fd.sig.receiver != nil) {
+		putErrorAt(fd.sig.tok, "Too many parameters in %s.", fd.fname)
+	}
+	checkingFunction = fd
+	beginFunction()
+	for _, param := range fd.params {
+		// the callee copies an aggregate argument, like an escaping variable
+		if isAggregate(param.gtype) {
+			param.escapes = true
+		}
+		allocateParameter(param)
+	}
+	for _, result := range fd.namedResults {
+		allocateLocalVariable(result)
+	}
+	if len(fd.captures) > 0 {
+		fd.context = allocateHiddenVariable()
+	}
+	checkStatement(fd.ast)
+	if len(fd.sig.results) > 0 && !isTerminating(fd.ast) {
+		putErrorAt(fd.ast.(*CompoundStatement).end, "Missing return.")
+	}
+	// the parameters are pushed in the prologue
+	fd.space = endFunction() - 8*len(fd.params)
+	checkingFunction = nil
+}
+
+// a terminating statement does not fall through to the statements after it, as defined by the spec
+func isTerminating(ast Ast) bool {
+	switch v := ast.(type) {
+	case *Statement:
+		return isTerminating(v.ast)
+	case *ReturnStatement:
+		return true
+	case *CompoundStatement:
+		return len(v.statements) > 0 && isTerminating(v.statements[len(v.statements)-1])
+	case *IfStatement:
+		return v.els != nil && isTerminating(v.then) && isTerminating(v.els)
+	case *ForStatement:
+		return v.cond == nil && !hasBreak(v.body, v.breakLabel)
+	case *ExpressionSwitchStatement:
+		hasDefault := false
+		for _, clause := range v.clauses {
+			hasDefault = hasDefault || clause.isDefault
+			body := &CompoundStatement{statements: clause.statements}
+			if hasBreak(body, v.breakLabel) || !clause.fallsThrough && !isTerminating(body) {
+				return false
+			}
+		}
+		return hasDefault
+	case *TypeSwitchStatement:
+		hasDefault := false
+		for _, clause := range v.clauses {
+			hasDefault = hasDefault || clause.isDefault
+			body := &CompoundStatement{statements: clause.statements}
+			if hasBreak(body, v.breakLabel) || !isTerminating(body) {
+				return false
+			}
+		}
+		return hasDefault
+	}
+	return false
+}
+
+// whether a break in the statement jumps to the label, of an enclosing statement
+func hasBreak(ast Ast, label string) bool {
+	switch v := ast.(type) {
+	case *Statement:
+		return hasBreak(v.ast, label)
+	case *JumpStatement:
+		return v.keyword == "break" && v.label == label
+	case *CompoundStatement:
+		for _, statement := range v.statements {
+			if hasBreak(statement, label) {
+				return true
+			}
+		}
+	case *IfStatement:
+		return hasBreak(v.then, label) || v.els != nil && hasBreak(v.els, label)
+	case *ForStatement:
+		return hasBreak(v.body, label)
+	case *ForRangeStatement:
+		return hasBreak(v.body, label)
+	case *ExpressionSwitchStatement:
+		for _, clause := range v.clauses {
+			if hasBreak(&CompoundStatement{statements: clause.statements}, label) {
+				return true
+			}
+		}
+	case *TypeSwitchStatement:
+		for _, clause := range v.clauses {
+			if hasBreak(&CompoundStatement{statements: clause.statements}, label) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// the methods are of the named types other than pointers,
+// and the name of a method is not of a field
+// the body is checked as a function of its own, in the middle of the enclosing one
+func checkFuncLiteral(fl *FuncLiteral) {
+	function, offset, space := checkingFunction, frameOffset, localVariableSpace
+	checkFunctionDefinition(fl.fd)
+	checkingFunction, frameOffset, localVariableSpace = function, offset, space
+	if len(fl.fd.captures) == 0 {
+		staticFuncValues[fl.fd.fname] = fl.fd.sig
+	}
+}
+
+func checkMethodReceiver(sig *FunctionSignature) {
+	nt := namedOf(sig.receiver.gtype)
+	if isPointer(nt) || isInterface(nt) {
+		putError("Invalid receiver type %s.", sig.receiver.gtype)
+	}
+	if st, ok := nt.underlying().(*StructType); ok {
+		for _, field := range st.fields {
+			if field.name == sig.fname {
+				putError("Field and method with the same name %s.", sig.fname)
+			}
+		}
+	}
+}
+
+func checkExpressionStatement(es *ExpressionStatement) {
+	switch v := es.expr.(type) {
+	case *FunCall:
+		// the results may be discarded
+		checkFunCall(v)
+	case *DeleteExpression:
+		checkDeleteExpression(v)
+	default:
+		checkExpression(es.expr)
+	}
+}
+
+func checkDeleteExpression(de *DeleteExpression) {
+	t := checkExpression(de.m)
+	mt := mapOf(t)
+	if mt == nil {
+		putErrorAt(de.tok, "Invalid argument for delete: %s is not a map.", t)
+	}
+	checkExpression(de.key)
+	de.key = checkAssignability(de.key, mt.key)
+}
+
+func checkDeclarationStatement(ds *DeclarationStatement) {
+	for _, assign := range ds.assigns {
+		checkMultipleAssignment(assign.(*MultipleAssignmentStatement), ds.syms)
+	}
+	for _, sym := range ds.syms {
+		if sym.gtype == nil {
+			putError("Cannot infer the type of %s.", sym.name)
+		}
+		allocateLocalVariable(sym)
+	}
+}
+
+// the variables in decls are declared by this assignment,
+// and get the types of their values unless they have one
+func checkMultipleAssignment(mas *MultipleAssignmentStatement, decls []*LocalVariable) {
+	if len(mas.lefts) == 2 && len(mas.rights) == 1 {
+		switch v := mas.rights[0].(type) {
+		case *TypeAssertExpression:
+			// v, ok := x.(T)
+			v.commaOk = true
+		case *IndexExpression:
+			// v, ok := m[k], which is an error for the other indexes
+			v.commaOk = true
+		}
+	}
+	types := checkExpressionList(mas.rights)
+	if len(types) != len(mas.lefts) {
+		putErrorAt(mas.rights[0].(Expression).getTok(), "Assignment mismatch: %d variables but %d values.",
+			len(mas.lefts), len(types))
+	}
+	for i, left := range mas.lefts {
+		if left == nil {
+			if len(mas.rights) == len(types) {
+				convertUntyped(mas.rights[i], defaultType(types[i]))
+			}
+			continue
+		}
+		if id, ok := left.(*Identifier); ok && id.symbol.getType() == nil && isDeclaredBy(id.symbol, decls) {
+			if types[i] == tUntypedNil {
+				putErrorAt(id.tok, "Use of untyped nil in assignment.")
+			}
+			id.symbol.(*LocalVariable).gtype = defaultType(types[i])
+		}
+		ltype := checkExpression(left)
+		checkAssignedLeft(left)
+		if len(mas.rights) == len(types) {
+			mas.rights[i] = checkAssignability(mas.rights[i], ltype)
+		} else if !assignable(types[i], ltype) {
+			putErrorAt(left.(Expression).getTok(), "Cannot assign %s to %s.", types[i], ltype)
+		} else {
+			checkForwardedValue(left.(Expression).getTok(), types[i], ltype)
+		}
+	}
+	if len(mas.rights) > 1 {
+		// the aggregate values are copied before any of them is assigned
+		mas.temporaries = make([]*LocalVariable, len(mas.rights))
+		for i, right := range mas.rights {
+			if t := right.(Expression).getType(); isAggregate(t) {
+				mas.temporaries[i] = allocateTemporary(t)
+			}
+		}
+	}
+}
+
+// the key is an int index, and the value an element, but for a map
+func checkForRangeStatement(frs *ForRangeStatement) {
+	t := checkExpression(frs.expr)
+	elem := elementOf(t)
+	key := Type(tInt)
+	if isString(t) {
+		// the runes of a string, at the indices of their first bytes
+		convertUntyped(frs.expr, tString)
+		elem = tInt32
+	} else if mt := mapOf(t); mt != nil {
+		key, elem = mt.key, mt.elem
+	} else if elem == nil {
+		putErrorAt(frs.tok, "Cannot range over %s.", t)
+	}
+	types := []Type{key, elem}
+	for i, left := range []LeftValue{frs.key, frs.value} {
+		if left == nil {
+			continue
+		}
+		if id, ok := left.(*Identifier); ok && isDeclaredBy(id.symbol, frs.decls) {
+			id.symbol.(*LocalVariable).gtype = types[i]
+		}
+		lt := checkExpression(left)
+		checkAssignedLeft(left)
+		if !assignable(types[i], lt) {
+			putErrorAt(left.(Expression).getTok(), "Cannot assign %s to %s in range.", types[i], lt)
+		}
+	}
+	for _, decl := range frs.decls {
+		allocateLocalVariable(decl)
+	}
+	frs.base = allocateHiddenVariable()
+	frs.index = allocateHiddenVariable()
+	frs.length = allocateHiddenVariable()
+	if isString(t) {
+		frs.width = allocateHiddenVariable()
+	}
+}
+
+func isDeclaredBy(sym Symbol, decls []*LocalVariable) bool {
+	for _, decl := range decls {
+		if Symbol(decl) == sym {
+			return true
+		}
+	}
+	return false
+}
+
+func checkReturnStatement(rs *ReturnStatement) {
+	results := checkingFunction.sig.results
+	types := checkExpressionList(rs.exprs)
+	if len(types) != len(results) {
+		putErrorAt(rs.tok, "Wrong number of return values in %s: %d expected, but got %d.",
+			checkingFunction.fname, len(results), len(types))
+	}
+	for i, result := range results {
+		if len(rs.exprs) == len(types) {
+			rs.exprs[i] = checkAssignability(rs.exprs[i], result.gtype)
+		} else if !assignable(types[i], result.gtype) {
+			putErrorAt(rs.tok, "Cannot use %s as %s value in return statement.", types[i], result.gtype)
+		} else {
+			checkForwardedValue(rs.tok, types[i], result.gtype)
+		}
+	}
+}
+
+func checkCondition(ast Ast) {
+	t := checkExpression(ast)
+	if !isBoolean(t) {
+		putErrorAt(ast.(Expression).getTok(), "Non-boolean condition of type %s.", t)
+	}
+	convertUntyped(ast, tBool)
+}
+
+// the value must be assignable to the type, untyped constants are converted.
+// the value is returned to replace the ast, converted if the type is an interface
+func checkAssignability(ast Ast, to Type) Ast {
+	t := ast.(Expression).getType()
+	if it, ok := to.underlying().(*InterfaceType); ok && !assignable(t, to) && !isUntyped(t) {
+		name, pointerReceiver := missingMethod(t, it)
+		if pointerReceiver {
+			putErrorAt(ast.(Expression).getTok(), "Cannot use %s as %s value: method %s has pointer receiver.",
+				t, to, name)
+		}
+		putErrorAt(ast.(Expression).getTok(), "Cannot use %s as %s value: missing method %s.", t, to, name)
+	}
+	if !assignable(t, to) {
+		putErrorAt(ast.(Expression).getTok(), "Cannot use %s as %s value.", t, to)
+	}
+	if isInterface(to) && t != tUntypedNil && !identical(t, to) {
+		from := defaultType(t)
+		convertUntyped(ast, from)
+		useInterfaceConversion(from, to)
+		return &ConversionExpression{
+			ExpressionBase: ExpressionBase{tok: ast.(Expression).getTok(), gtype: to},
+			toType:         to,
+			operand:        ast,
+		}
+	}
+	convertUntyped(ast, to)
+	return ast
+}
+
+// one of the values of a call is not converted to an interface
+func checkForwardedValue(tok *Token, t Type, to Type) {
+	if isInterface(to) && !identical(t, to) {
+		putErrorAt(tok, "Conversion of %s to %s in a multiple-value assignment is not supported.", t, to)
+	}
+}
+
+// register the type information used by the conversion to an interface
+func useInterfaceConversion(from Type, to Type) {
+	switch {
+	case !isInterface(from):
+		typeWordOf(from, to)
+	case !isEmptyInterface(to):
+		interfaceDescriptorOf(to)
+	}
+}
+
+// a single call may yield several values, as does the comma-ok form of a type assertion
+func checkExpressionList(exprs []Ast) []Type {
+	if len(exprs) == 1 {
+		if ta, ok := exprs[0].(*TypeAssertExpression); ok && ta.commaOk {
+			return []Type{checkExpression(ta), tBool}
+		}
+		if ie, ok := exprs[0].(*IndexExpression); ok && ie.commaOk {
+			return []Type{checkExpression(ie), tBool}
+		}
+		if fc, ok := exprs[0].(*FunCall); ok {
+			types := checkFunCall(fc)
+			if len(types) == 0 {
+				putErrorAt(fc.tok, "%s() used as value.", fc.fname)
+			}
+			return types
+		}
+	}
+	var types []Type
+	for _, expr := range exprs {
+		types = append(types, checkExpression(expr))
+	}
+	return types
+}
+
+func checkExpression(ast Ast) Type {
+	var t Type
+	switch v := ast.(type) {
+	case *PrimaryExpression:
+		t = checkExpression(v.child)
+	case *AstConstant:
+		switch v.constant.(type) {
+		case *RuneConstant:
+			t = tUntypedRune
+		case *FloatConstant:
+			t = tUntypedFloat
+		case *ComplexConstant:
+			t = tUntypedComplex
+		case *BoolConstant:
+			t = tUntypedBool
+		case *NilConstant:
+			t = tUntypedNil
+		default:
+			t = tUntypedInt
+		}
+	case *AstString:
+		t = tUntypedString
+	case *Identifier:
+		t = v.symbol.getType()
+	case *FunCall:
+		types := checkFunCall(v)
+		switch len(types) {
+		case 0:
+			putErrorAt(v.tok, "%s() used as value.", v.fname)
+		case 1:
+			t = types[0]
+		default:
+			putErrorAt(v.tok, "Multiple-value %s() in single-value context.", v.fname)
+		}
+	case *AssignmentExpression:
+		t = checkExpression(v.left)
+		checkAssignedLeft(v.left)
+		right := checkExpression(v.right)
+		switch v.operator.(type) {
+		case nil:
+			v.right = checkAssignability(v.right, t)
+		case *ShiftLeftOperator, *ShiftRightOperator:
+			if !isInteger(t) || !isInteger(right) {
+				putErrorAt(v.tok, "Operator %s not defined on %s.", v.tok.sval, t)
+			}
+			convertUntyped(v.right, tUint)
+		default:
+			if !isInteger(t) && !isConcatenation(v.operator, t) && !isFloatOperation(v.operator, t) {
+				putErrorAt(v.tok, "Operator %s not defined on %s.", v.tok.sval, t)
+			}
+			v.right = checkAssignability(v.right, t)
+		}
+	case *ArithmeticExpression:
+		t = checkBinaryOperands(v.tok, v.left, v.right)
+		if !isInteger(t) && !isConcatenation(v.operator, t) && !isFloatOperation(v.operator, t) &&
+			!isComplexOperation(v.operator, t) {
+			putErrorAt(v.tok, "Operator %s not defined on %s.", v.tok.sval, t)
+		}
+		if isDivision(v.operator) && isZeroConstant(v.right) {
+			putErrorAt(v.tok, "Division by zero.")
+		}
+	case *RelationalExpression:
+		operand := checkBinaryOperands(v.tok, v.left, v.right)
+		equality := v.tok.isPunct("==") || v.tok.isPunct("!=")
+		// a slice, a map or a func can only be compared to nil
+		comparable := isBoolean(operand) || isPointer(operand) ||
+			(isSlice(operand) || isMap(operand) || isFunc(operand)) && (isNilLiteral(v.left) || isNilLiteral(v.right))
+		switch operand.underlying().(type) {
+		case *ArrayType, *StructType, *InterfaceType:
+			comparable = isComparable(operand)
+			// comparing interface values in them may panic
+			v.position = positionOf(v.tok)
+		}
+		if isInterface(operand) {
+			// a value compared with an interface value is converted
+			v.left = checkAssignability(v.left, operand)
+			v.right = checkAssignability(v.right, operand)
+		}
+		if !isNumeric(operand) && !isString(operand) && !(equality && comparable) || isComplex(operand) && !equality {
+			putErrorAt(v.tok, "Operator %s not defined on %s.", v.tok.sval, operand)
+		}
+		if isUntyped(operand) && !isComplex(operand) {
+			// compare as the default type
+			convertUntyped(v.left, defaultType(operand))
+			convertUntyped(v.right, defaultType(operand))
+		}
+		t = tUntypedBool
+	case *LogicalAndExpression:
+		t = checkBinaryOperands(v.tok, v.left, v.right)
+		if !isBoolean(t) {
+			putErrorAt(v.tok, "Operator && not defined on %s.", t)
+		}
+	case *LogicalOrExpression:
+		t = checkBinaryOperands(v.tok, v.left, v.right)
+		if !isBoolean(t) {
+			putErrorAt(v.tok, "Operator || not defined on %s.", t)
+		}
+	case *LogicalNotExpression:
+		t = checkExpression(v.operand)
+		if !isBoolean(t) {
+			putErrorAt(v.tok, "Operator ! not defined on %s.", t)
+		}
+	case *UnaryExpression:
+		t = checkExpression(v.operand)
+		if _, ok := v.operator.(FloatUnaryOperator); !isInteger(t) && !(ok && (isFloat(t) || isComplex(t))) {
+			putErrorAt(v.tok, "Operator %s not defined on %s.", v.tok.sval, t)
+		}
+	case *AddressExpression:
+		if cl, ok := v.operand.(*CompositeLiteral); ok {
+			cl.escapes = true
+		}
+		t = &PointerType{elem: checkExpression(v.operand)}
+		if isStringByte(v.operand) {
+			putErrorAt(v.tok, "Cannot take the address of a byte of a string.")
+		}
+		if _, ok := v.operand.(*CompositeLiteral); !ok && !isAddressable(v.operand) {
+			putErrorAt(v.tok, "Cannot take the address of %s.", v.operand.getTok().sval)
+		}
+	case *DereferenceExpression:
+		pt, ok := checkExpression(v.operand).underlying().(*PointerType)
+		if !ok {
+			putErrorAt(v.tok, "Invalid indirect of %s.", v.operand.(Expression).getType())
+		}
+		t = pt.elem
+	case *NewExpression:
+		t = &PointerType{elem: v.elem}
+	case *IndexExpression:
+		t = checkIndexExpression(v)
+	case *SelectorExpression:
+		t = checkSelectorExpression(v)
+		if v.method != nil {
+			// not called, but a method value
+			useMethodValue(v.method)
+		}
+		if v.imethod != nil {
+			v.code = useInterfaceMethodValue(v.operand.(Expression).getType(), v.name)
+		}
+	case *MethodExpression:
+		t = checkMethodExpression(v)
+	case *FunctionValue:
+		staticFuncValues[v.sig.label()] = v.sig
+		t = v.sig.funcType()
+	case *FuncLiteral:
+		checkFuncLiteral(v)
+		t = v.fd.sig.funcType()
+	case *CompositeLiteral:
+		checkCompositeLiteral(v)
+		t = v.literalType
+		if !v.escapes && !isSlice(t) && !isMap(t) {
+			// a struct or an array is built in the frame
+			v.temporary = allocateTemporary(t)
+		}
+	case *LenExpression:
+		operand := checkExpression(v.operand)
+		if elementOf(operand) == nil && !isString(operand) && !isMap(operand) {
+			putErrorAt(v.tok, "Invalid argument for len: %s.", operand)
+		}
+		convertUntyped(v.operand, tString)
+		t = tInt
+	case *ConversionExpression:
+		checkConversion(v)
+		t = v.toType
+	case *TypeAssertExpression:
+		t = checkTypeAssertExpression(v)
+	case *CapExpression:
+		if elementOf(checkExpression(v.operand)) == nil {
+			putErrorAt(v.tok, "Invalid argument for cap: %s.", v.operand.(Expression).getType())
+		}
+		t = tInt
+	case *SliceExpression:
+		t = checkSliceExpression(v)
+	case *MakeExpression:
+		if mt := mapOf(v.makeType); mt != nil {
+			checkMapType(v.tok, mt)
+			mapDescriptorOf(mt)
+			if v.capacity != nil {
+				putErrorAt(v.tok, "Too many arguments to make(%s).", v.makeType)
+			}
+			if v.length != nil {
+				checkSizeArgument(v.length)
+			}
+			t = v.makeType
+			break
+		}
+		if !isSlice(v.makeType) {
+			putErrorAt(v.tok, "Cannot make %s.", v.makeType)
+		}
+		if v.length == nil {
+			putErrorAt(v.tok, "Missing len argument to make(%s).", v.makeType)
+		}
+		checkSizeArgument(v.length)
+		if v.capacity != nil {
+			checkSizeArgument(v.capacity)
+			length, ok1 := constantIndexOf(v.length)
+			capacity, ok2 := constantIndexOf(v.capacity)
+			if ok1 && ok2 && length > capacity {
+				putErrorAt(v.tok, "Len larger than cap in make(%s).", v.makeType)
+			}
+		}
+		t = v.makeType
+	case *AppendExpression:
+		t = checkExpression(v.slice)
+		st, ok := t.underlying().(*SliceType)
+		if !ok {
+			putErrorAt(v.tok, "Invalid argument for append: %s.", t)
+		}
+		for i, value := range v.values {
+			checkExpression(value)
+			if v.spread {
+				v.values[i] = checkAssignability(value, t)
+			} else {
+				v.values[i] = checkAssignability(value, st.elem)
+			}
+		}
+	case *CopyExpression:
+		dst := checkExpression(v.dst)
+		src := checkExpression(v.src)
+		if !isSlice(dst) || !isSlice(src) {
+			putErrorAt(v.tok, "Arguments to copy must be slices, but got %s and %s.", dst, src)
+		}
+		if !identical(elementOf(dst), elementOf(src)) {
+			putErrorAt(v.tok, "Arguments to copy have different element types %s and %s.", dst, src)
+		}
+		t = tInt
+	case *DeleteExpression:
+		putErrorAt(v.tok, "delete(...) (no value) used as value.")
+	case *ShiftExpression:
+		// the result has the type of the left operand
+		t = checkExpression(v.left)
+		if constant := constantOf(v.left); isUntyped(t) && !isInteger(t) && isIntegralConstant(constant) {
+			// a constant shift of an untyped constant is an integer constant
+			t = tUntypedInt
+			v.left.(Expression).setType(t)
+			v.left.(Expression).setConstant(convertConstant(constant, t))
+		}
+		if !isInteger(t) {
+			putErrorAt(v.tok, "Operator %s not defined on %s.", v.tok.sval, t)
+		}
+		count := checkExpression(v.right)
+		if !isInteger(count) {
+			putErrorAt(v.right.(Expression).getTok(), "Shift count type %s, must be integer.", count)
+		}
+		convertUntyped(v.right, tUint)
+	default:
+		putError("Unexpected expression %T in type checker.", ast)
+	}
+	ast.(Expression).setType(t)
+	if constant := foldConstant(ast); constant != nil {
+		checkConstantRange(ast.(Expression).getTok(), constant, t)
+		ast.(Expression).setConstant(convertConstant(constant, t))
+	}
+	return t
+}
+
+func checkIndexExpression(ie *IndexExpression) Type {
+	t := checkExpression(ie.array)
+	if mt := mapOf(t); mt != nil {
+		checkMapType(ie.tok, mt)
+		checkExpression(ie.index)
+		ie.index = checkAssignability(ie.index, mt.key)
+		return mt.elem
+	}
+	if ie.commaOk {
+		putErrorAt(ie.tok, "Assignment mismatch: 2 variables but 1 value.")
+	}
+	elem := elementOf(t)
+	if isString(t) {
+		convertUntyped(ie.array, tString)
+		elem = tUint8
+	}
+	if elem == nil {
+		putErrorAt(ie.tok, "Cannot index %s.", t)
+	}
+	checkIndex(ie.tok, ie.index)
+	// the length of a slice is only known at run time
+	if at := arrayOf(t); at != nil {
+		if index, ok := constantIndexOf(ie.index); ok && index >= at.length {
+			putErrorAt(ie.tok, "Index %d out of bounds [0:%d].", index, at.length)
+		}
+	}
+	return elem
+}
+
+func checkIndex(tok *Token, index Ast) {
+	if !isInteger(checkExpression(index)) {
+		putErrorAt(tok, "Non-integer index of type %s.", index.(Expression).getType())
+	}
+	convertUntyped(index, tInt)
+}
+
+// the length and the capacity of make
+func checkSizeArgument(ast Ast) {
+	t := checkExpression(ast)
+	if !isInteger(t) {
+		putErrorAt(ast.(Expression).getTok(), "Non-integer size argument of type %s.", t)
+	}
+	convertUntyped(ast, tInt)
+}
+
+// slicing an array or a slice yields a slice of the elements,
+// and slicing a string yields a string
+func checkSliceExpression(se *SliceExpression) Type {
+	t := checkExpression(se.operand)
+	elem := elementOf(t)
+	if isString(t) {
+		if se.max != nil {
+			putErrorAt(se.tok, "Invalid operation: 3-index slice of string.")
+		}
+		convertUntyped(se.operand, tString)
+		t = se.operand.(Expression).getType()
+	} else if elem == nil {
+		putErrorAt(se.tok, "Cannot slice %s.", t)
+	}
+	if _, ok := t.underlying().(*ArrayType); ok {
+		if _, ok := se.operand.(LeftValue); !ok {
+			putErrorAt(se.tok, "Invalid operation %s (slice of unaddressable value).", t)
+		}
+	}
+	previous := -1
+	for _, index := range []Ast{se.low, se.high, se.max} {
+		if index == nil {
+			continue
+		}
+		checkIndex(se.tok, index)
+		value, ok := constantIndexOf(index)
+		if !ok {
+			continue
+		}
+		if at := arrayOf(t); at != nil && value > at.length {
+			putErrorAt(se.tok, "Index %d out of bounds [0:%d].", value, at.length+1)
+		}
+		if value < previous {
+			putErrorAt(se.tok, "Invalid slice indices: %d < %d.", value, previous)
+		}
+		previous = value
+	}
+	if isString(t) {
+		return t
+	}
+	return &SliceType{elem: elem}
+}
+
+// the operand is converted, as a value, or from or to a string
+func checkConversion(ce *ConversionExpression) {
+	from := checkExpression(ce.operand)
+	to := ce.toType
+	switch {
+	case isInterface(to) && from == tUntypedNil:
+		convertUntyped(ce.operand, to)
+	case isInterface(to) && assignable(from, to):
+		convertUntyped(ce.operand, defaultType(from))
+		useInterfaceConversion(defaultType(from), to)
+	case isUntyped(from) && assignable(from, to):
+		convertUntyped(ce.operand, to)
+	case identical(from.underlying(), to.underlying()):
+	case isInteger(from) && isInteger(to):
+		// the value is truncated or extended
+	case isNumeric(from) && isNumeric(to):
+		// the value is rounded, or truncated toward zero
+		convertUntyped(ce.operand, defaultType(from))
+	case isPointer(from) && isPointer(to) &&
+		identical(from.underlying().(*PointerType).elem.underlying(), to.underlying().(*PointerType).elem.underlying()):
+	case isString(to) && isInteger(from):
+		convertUntyped(ce.operand, defaultType(from))
+	case isString(to) && isByteOrRuneSlice(from):
+	case isByteOrRuneSlice(to) && isString(from):
+		convertUntyped(ce.operand, tString)
+	default:
+		putErrorAt(ce.tok, "Cannot convert %s to %s.", from, to)
+	}
+}
+
+// x.(T) asserts that x is not nil and its dynamic type is T, or implements T of an interface
+func checkTypeAssertExpression(ta *TypeAssertExpression) Type {
+	t := checkExpression(ta.operand)
+	if ta.assertType == nil {
+		putErrorAt(ta.tok, "Use of .(type) outside type switch.")
+	}
+	it, ok := t.underlying().(*InterfaceType)
+	if !ok {
+		putErrorAt(ta.tok, "Invalid type assertion: non-interface %s on the left.", t)
+	}
+	checkPossibleType(ta.tok, ta.assertType, t, it)
+	ta.staticName = getAstString(runtimeTypeName(t))
+	ta.assertName = getAstString(runtimeTypeName(ta.assertType))
+	return ta.assertType
+}
+
+// the type of a type assertion or a case of a type switch can be the dynamic type of an interface,
+// which is registered for the comparison
+func checkPossibleType(tok *Token, t Type, from Type, it *InterfaceType) {
+	if isInterface(t) {
+		if !isEmptyInterface(t) {
+			interfaceDescriptorOf(t)
+		}
+		return
+	}
+	if name, pointerReceiver := missingMethod(t, it); name != "" {
+		if pointerReceiver {
+			putErrorAt(tok, "Impossible type assertion: %s does not implement %s (method %s has pointer receiver).",
+				t, from, name)
+		}
+		putErrorAt(tok, "Impossible type assertion: %s does not implement %s (missing method %s).", t, from, name)
+	}
+	descriptorOf(t)
+}
+
+// each value of a case is compared with the tag, and a constant value is in one case only
+func checkExpressionSwitchStatement(ss *ExpressionSwitchStatement) {
+	if ss.init != nil {
+		checkStatement(ss.init)
+	}
+	if ss.tag != nil {
+		t := checkExpression(ss.tag)
+		if t == tUntypedNil {
+			putErrorAt(ss.tok, "Use of untyped nil in switch.")
+		}
+		t = defaultType(t)
+		convertUntyped(ss.tag, t)
+		ss.value = &LocalVariable{
+			SymbolBase: SymbolBase{
+				gtype: t,
+			},
+		}
+		allocateLocalVariable(ss.value)
+	}
+	seen := make(map[interface{}]bool)
+	seenDefault := false
+	for _, clause := range ss.clauses {
+		if clause.isDefault {
+			if seenDefault {
+				putErrorAt(clause.tok, "Multiple defaults in switch.")
+			}
+			seenDefault = true
+		}
+		for _, expr := range clause.exprs {
+			if ss.tag == nil {
+				checkCondition(expr)
+				clause.conds = append(clause.conds, expr)
+				continue
+			}
+			tok := expr.(Expression).getTok()
+			cond := &RelationalExpression{
+				// an == at the position of the value
+				ExpressionBase: ExpressionBase{tok: &Token{typ: T_PUNCTUATION, sval: "==", SourceFile: tok.SourceFile}},
+				operator:       &EqualOperator{},
+				left:           ss.hiddenValue(),
+				right:          expr,
+			}
+			checkExpression(cond)
+			if key, ok := constantKeyOf(expr); ok {
+				if seen[key] {
+					putErrorAt(tok, "Duplicate case %s in switch.", tok.sval)
+				}
+				seen[key] = true
+			}
+			clause.conds = append(clause.conds, cond)
+		}
+		saved := frameOffset
+		for _, statement := range clause.statements {
+			checkStatement(statement)
+		}
+		frameOffset = saved
+	}
+}
+
+// the clauses are checked in their own scopes, where the symbol has the type of the single type of the case
+func checkTypeSwitchStatement(ts *TypeSwitchStatement) {
+	if ts.init != nil {
+		checkStatement(ts.init)
+	}
+	t := checkExpression(ts.subject)
+	it, ok := t.underlying().(*InterfaceType)
+	if !ok {
+		putErrorAt(ts.tok, "%s is not an interface.", t)
+	}
+	ts.value = &LocalVariable{
+		SymbolBase: SymbolBase{
+			gtype: t,
+		},
+	}
+	allocateLocalVariable(ts.value)
+	ts.dynamicType = allocateHiddenVariable()
+	var seen []Type
+	seenNil := false
+	seenDefault := false
+	for _, clause := range ts.clauses {
+		if clause.isDefault {
+			if seenDefault {
+				putErrorAt(clause.tok, "Multiple defaults in switch.")
+			}
+			seenDefault = true
+		}
+		for _, ct := range clause.types {
+			if ct == nil {
+				if seenNil {
+					putErrorAt(clause.tok, "Multiple nil cases in type switch.")
+				}
+				seenNil = true
+				continue
+			}
+			for _, other := range seen {
+				if identical(ct, other) {
+					putErrorAt(clause.tok, "Duplicate case %s in type switch.", ct)
+				}
+			}
+			seen = append(seen, ct)
+			checkPossibleType(clause.tok, ct, t, it)
+		}
+		saved := frameOffset
+		if clause.symbol != nil {
+			clause.symbol.gtype = t
+			if len(clause.types) == 1 && clause.types[0] != nil {
+				clause.symbol.gtype = clause.types[0]
+				if isInterface(clause.types[0]) {
+					useInterfaceConversion(t, clause.types[0])
+				}
+			}
+			allocateLocalVariable(clause.symbol)
+		}
+		for _, statement := range clause.statements {
+			checkStatement(statement)
+		}
+		frameOffset = saved
+	}
+}
+
+// + on strings
+func isConcatenation(operator ArithmeticOperator, t Type) bool {
+	_, ok := operator.(*AdditiveOperator)
+	return ok && isString(t)
+}
+
+func isFloatOperation(operator ArithmeticOperator, t Type) bool {
+	_, ok := operator.(FloatOperator)
+	return ok && isFloat(t)
+}
+
+func isComplexOperation(operator ArithmeticOperator, t Type) bool {
+	_, ok := operator.(ComplexOperator)
+	return ok && isComplex(t)
+}
+
+// the bytes of a string are not variables
+func isStringByte(ast Ast) bool {
+	ie, ok := ast.(*IndexExpression)
+	return ok && isString(ie.array.(Expression).getType())
+}
+
+func checkAssignedLeft(left LeftValue) {
+	if isStringByte(left) {
+		putErrorAt(left.(Expression).getTok(), "Cannot assign to a byte of a string.")
+	}
+	if !isAddressable(left) && !isMapIndex(left) {
+		putErrorAt(left.(Expression).getTok(), "Cannot assign to %s.", left.getTok().sval)
+	}
+}
+
+// an element of a map is assigned, though it is not addressable
+func isMapIndex(ast Ast) bool {
+	ie, ok := ast.(*IndexExpression)
+	return ok && isMap(ie.array.(Expression).getType())
+}
+
+// whether the value is in a variable, rather than a temporary like the result of a call
+func isAddressable(ast Ast) bool {
+	switch v := ast.(type) {
+	case *PrimaryExpression:
+		return isAddressable(v.child)
+	case *Identifier:
+		_, constant := v.symbol.(*NamedConstant)
+		return !constant
+	case *DereferenceExpression:
+		return true
+	case *IndexExpression:
+		t := v.array.(Expression).getType()
+		return isSlice(t) || isPointer(t) || !isMap(t) && isAddressable(v.array)
+	case *SelectorExpression:
+		return isPointer(v.operand.(Expression).getType()) || isAddressable(v.operand)
+	}
+	return false
+}
+
+// the field or the method is looked up through the embedded fields, and through a pointer
+func checkSelectorExpression(se *SelectorExpression) Type {
+	t := checkExpression(se.operand)
+	if it, ok := t.underlying().(*InterfaceType); ok {
+		// the methods of an interface are at their indices in the itabs
+		index := it.methodIndex(se.name)
+		if index < 0 {
+			putErrorAt(se.tok, "%s undefined (type %s has no field or method %s).", se.name, t, se.name)
+		}
+		se.imethod = it.methodSet()[index]
+		se.itabSlot = 8 + 8*index
+		return se.imethod.gtype
+	}
+	path, method, imethod, ambiguous := lookupSelector(t, se.name)
+	if ambiguous {
+		putErrorAt(se.tok, "Ambiguous selector %s.", se.name)
+	}
+	if path == nil && method == nil || se.name == "_" {
+		putErrorAt(se.tok, "%s undefined (type %s has no field or method %s).", se.name, t, se.name)
+	}
+	if imethod != nil {
+		// called through the embedded interface
+		se.operand = selectEmbedded(se, path)
+		it := path[len(path)-1].gtype.underlying().(*InterfaceType)
+		se.imethod = imethod
+		se.itabSlot = 8 + 8*it.methodIndex(se.name)
+		return imethod.gtype
+	}
+	if method != nil {
+		se.method = method
+		se.receiver = checkReceiver(se, path)
+		return method.funcType()
+	}
+	se.path = path
+	return path[len(path)-1].gtype
+}
+
+// the embedded field at the end of the path from the operand of x.M
+func selectEmbedded(se *SelectorExpression, path []*Field) *SelectorExpression {
+	embedded := path[len(path)-1]
+	return &SelectorExpression{
+		ExpressionBase: ExpressionBase{tok: se.tok, gtype: embedded.gtype},
+		operand:        se.operand,
+		name:           embedded.name,
+		path:           path,
+	}
+}
+
+// the receiver of the method of x.M as it is passed,
+// x or its embedded field is addressed or dereferenced for the receiver type
+func checkReceiver(se *SelectorExpression, path []*Field) Ast {
+	receiver := se.operand
+	if len(path) > 0 {
+		receiver = selectEmbedded(se, path)
+	}
+	t := receiver.(Expression).getType()
+	switch {
+	case se.method.hasPointerReceiver() && !isPointer(t):
+		left, ok := receiver.(LeftValue)
+		if !ok || !isAddressable(receiver) {
+			putErrorAt(se.tok, "Cannot call pointer method %s on %s.", se.name, t)
+		}
+		markEscaping(left)
+		receiver = &AddressExpression{
+			ExpressionBase: ExpressionBase{tok: se.tok, gtype: &PointerType{elem: t}},
+			operand:        left,
+		}
+	case !se.method.hasPointerReceiver() && isPointer(t):
+		receiver = &DereferenceExpression{
+			ExpressionBase: ExpressionBase{tok: se.tok, gtype: t.underlying().(*PointerType).elem},
+			operand:        receiver,
+		}
+	}
+	return receiver
+}
+
+// T.M takes the receiver of T, and (*T).M the receiver of *T, a promoted method included.
+// I.M of an interface takes the interface value
+func checkMethodExpression(me *MethodExpression) Type {
+	if it, ok := me.recvType.underlying().(*InterfaceType); ok {
+		index := it.methodIndex(me.name)
+		if index < 0 {
+			putErrorAt(me.tok, "%s undefined (type %s has no method %s).", me.name, me.recvType, me.name)
+		}
+		me.code = useInterfaceMethodExpression(me.recvType, me.name)
+		gtype := it.methodSet()[index].gtype
+		return &FuncType{params: append([]Type{me.recvType}, gtype.params...), results: gtype.results}
+	}
+	nt := namedOf(me.recvType)
+	var path []*Field
+	var sig *FunctionSignature
+	var imethod *Method
+	ambiguous := false
+	if nt != nil {
+		path, sig, imethod, ambiguous = lookupSelector(me.recvType, me.name)
+	}
+	if ambiguous {
+		putErrorAt(me.tok, "Ambiguous selector %s.", me.name)
+	}
+	if sig == nil && imethod == nil {
+		putErrorAt(me.tok, "%s undefined (type %s has no method %s).", me.name, me.recvType, me.name)
+	}
+	pointer := isPointer(me.recvType)
+	if sig != nil && !inMethodSet(me.recvType, path, sig) {
+		putErrorAt(me.tok, "Invalid method expression %s.%s (needs pointer receiver (*%s).%s).",
+			nt.name, me.name, nt.name, me.name)
+	}
+	var ft *FuncType
+	if len(path) > 0 {
+		// the receiver is found through the embedded fields
+		me.code = usePromotedMethodExpression(me)
+	} else {
+		me.code = useMethodExpression(sig, pointer)
+	}
+	if imethod != nil {
+		ft = &FuncType{params: imethod.gtype.params, results: imethod.gtype.results}
+	} else {
+		ft = sig.funcType()
+	}
+	ft.params = append([]Type{me.recvType}, ft.params...)
+	return ft
+}
+
+func isNilLiteral(ast Ast) bool {
+	if ac, ok := ast.(*AstConstant); ok {
+		_, ok := ac.constant.(*NilConstant)
+		return ok
+	}
+	return false
+}
+
+// the value of an integer literal
+func constantIndexOf(ast Ast) (int, bool) {
+	value := integerValueOf(constantOf(ast))
+	if value == nil || !value.IsInt64() {
+		return 0, false
+	}
+	return int(value.Int64()), true
+}
+
+func checkCompositeLiteral(cl *CompositeLiteral) {
+	if st, ok := cl.literalType.underlying().(*StructType); ok {
+		checkStructLiteral(cl, st)
+		return
+	}
+	if mt := mapOf(cl.literalType); mt != nil {
+		checkMapLiteral(cl, mt)
+		return
+	}
+	elem := elementOf(cl.literalType)
+	if elem == nil || isPointer(cl.literalType) {
+		putErrorAt(cl.tok, "Invalid composite literal type %s.", cl.literalType)
+	}
+	for _, key := range cl.keys {
+		if key != "" {
+			putErrorAt(cl.tok, "Invalid key %s in literal of %s.", key, cl.literalType)
+		}
+	}
+	if at, ok := cl.literalType.underlying().(*ArrayType); ok && len(cl.elems) > at.length {
+		putErrorAt(cl.tok, "Index %d out of bounds [0:%d].", len(cl.elems)-1, at.length)
+	}
+	for i, e := range cl.elems {
+		checkExpression(e)
+		cl.elems[i] = checkAssignability(e, elem)
+	}
+}
+
+// the constant keys are distinct
+func checkMapLiteral(cl *CompositeLiteral, mt *MapType) {
+	checkMapType(cl.tok, mt)
+	mapDescriptorOf(mt)
+	seen := make(map[interface{}]bool)
+	for i, key := range cl.mapKeys {
+		checkExpression(key)
+		if value, ok := constantKeyOf(key); ok {
+			if seen[value] {
+				putErrorAt(key.(Expression).getTok(), "Duplicate key %v in map literal.", value)
+			}
+			seen[value] = true
+		}
+		cl.mapKeys[i] = checkAssignability(key, mt.key)
+		checkExpression(cl.elems[i])
+		cl.elems[i] = checkAssignability(cl.elems[i], mt.elem)
+	}
+}
+
+// the value of an integer or string literal, to find the duplicate keys
+func constantKeyOf(ast Ast) (interface{}, bool) {
+	if sc, ok := constantOf(ast).(*StringConstant); ok {
+		return sc.str.sval, true
+	}
+	if value, ok := constantIndexOf(ast); ok {
+		return value, true
+	}
+	return nil, false
+}
+
+// the keys are compared by the hash table in the runtime,
+// which does not compare the dynamic types of interface values
+func checkMapType(tok *Token, mt *MapType) {
+	if !isComparable(mt.key) {
+		putErrorAt(tok, "Invalid map key type %s.", mt.key)
+	}
+	if containsInterface(mt.key) {
+		putErrorAt(tok, "Unsupported map key type %s.", mt.key)
+	}
+}
+
+// the elements are either all keyed by the field names or all positional,
+// and a positional literal has the values of all the fields
+func checkStructLiteral(cl *CompositeLiteral, st *StructType) {
+	keyed := len(cl.keys) > 0 && cl.keys[0] != ""
+	seen := make(map[string]bool)
+	for i, elem := range cl.elems {
+		key := cl.keys[i]
+		if (key != "") != keyed {
+			putErrorAt(cl.tok, "Mixture of field:value and value elements in struct literal.")
+		}
+		var field *Field
+		if keyed {
+			for _, f := range st.fields {
+				if f.name == key && key != "_" {
+					field = f
+				}
+			}
+			if field == nil {
+				putErrorAt(cl.tok, "Unknown field %s in struct literal of type %s.", key, cl.literalType)
+			}
+			if seen[key] {
+				putErrorAt(cl.tok, "Duplicate field name %s in struct literal.", key)
+			}
+			seen[key] = true
+		} else {
+			if i >= len(st.fields) {
+				putErrorAt(cl.tok, "Too many values in struct literal of type %s.", cl.literalType)
+			}
+			field = st.fields[i]
+		}
+		checkExpression(elem)
+		cl.elems[i] = checkAssignability(elem, field.gtype)
+		cl.fields = append(cl.fields, field)
+	}
+	if !keyed && len(cl.elems) > 0 && len(cl.elems) < len(st.fields) {
+		putErrorAt(cl.tok, "Too few values in struct literal of type %s.", cl.literalType)
+	}
+}
+
+// both operands must have the same type after the conversion of untyped constants
+func checkBinaryOperands(tok *Token, left Ast, right Ast) Type {
+	lt := checkExpression(left)
+	rt := checkExpression(right)
+	switch {
+	case isUntyped(lt) && isUntyped(rt):
+		if isNumeric(lt) && isNumeric(rt) {
+			// the kind later in the order of int, rune, float and complex
+			if lt == tUntypedComplex || rt == tUntypedComplex {
+				return tUntypedComplex
+			}
+			if lt == tUntypedFloat || rt == tUntypedFloat {
+				return tUntypedFloat
+			}
+			if lt == tUntypedRune || rt == tUntypedRune {
+				return tUntypedRune
+			}
+			return lt
+		}
+		if basicOf(lt).kind != basicOf(rt).kind {
+			putErrorAt(tok, "Mismatched types %s and %s.", lt, rt)
+		}
+		return lt
+	case isUntyped(lt):
+		checkAssignability(left, rt)
+		return rt
+	case isUntyped(rt):
+		checkAssignability(right, lt)
+		return lt
+	case isInterface(rt) && assignable(lt, rt):
+		return rt
+	case isInterface(lt) && assignable(rt, lt):
+		return lt
+	case !identical(lt, rt):
+		putErrorAt(tok, "Mismatched types %s and %s.", lt, rt)
+	}
+	return lt
+}
+
+// returns the result types
+func checkFunCall(fc *FunCall) []Type {
+	var argTypes []Type
+	for _, arg := range fc.args {
+		argTypes = append(argTypes, checkExpression(arg))
+	}
+	if fc.function != nil {
+		return reserveResultArea(fc, checkFunctionValueCall(fc))
+	}
+
+	sig := findFunction(fc.fname)
+	if sig == nil {
+		// C functions take anything and return int
+		for i, arg := range fc.args {
+			convertUntyped(arg, defaultType(argTypes[i]))
+			argTypes[i] = arg.(Expression).getType()
+		}
+		checkRegisters(fc, argTypes)
+		fc.setType(tInt)
+		return []Type{tInt}
+	}
+	fc.sig = sig
+	return reserveResultArea(fc, checkArguments(fc, sig.funcType()))
+}
+
+// the caller has the storage of the aggregate results in its frame
+func reserveResultArea(fc *FunCall, results []Type) []Type {
+	if area := resultAreaOf(results); area != nil {
+		fc.resultArea = allocateTemporary(area)
+	}
+	return results
+}
+
+// a method of x.M(...) is called directly with the receiver,
+// and anything else of a func type through its value
+func checkFunctionValueCall(fc *FunCall) []Type {
+	var t Type
+	if se, ok := fc.function.(*SelectorExpression); ok {
+		t = checkSelectorExpression(se)
+		se.setType(t)
+		if se.method != nil {
+			fc.sig = se.method
+			fc.receiver = se.receiver
+			fc.function = nil
+		}
+		if se.imethod != nil {
+			fc.imethod = se.imethod
+			fc.itabSlot = se.itabSlot
+			fc.receiver = se.operand
+			fc.function = nil
+		}
+	} else {
+		t = checkExpression(fc.function)
+	}
+	ft, ok := t.underlying().(*FuncType)
+	if !ok {
+		putErrorAt(fc.tok, "Cannot call non-function %s (type %s).", fc.fname, t)
+	}
+	return checkArguments(fc, ft)
+}
+
+func checkRegisters(fc *FunCall, argTypes []Type) {
+	if !fitsRegisters(argTypes, fc.receiver != nil) {
+		putErrorAt(fc.tok, "Too many arguments in call to %s.", fc.fname)
+	}
+}
+
+func checkArguments(fc *FunCall, ft *FuncType) []Type {
+	if len(fc.args) != len(ft.params) {
+		putErrorAt(fc.tok, "Wrong number of arguments in call to %s: %d expected, but got %d.",
+			fc.fname, len(ft.params), len(fc.args))
+	}
+	checkRegisters(fc, ft.params)
+	for i, param := range ft.params {
+		fc.args[i] = checkAssignability(fc.args[i], param)
+	}
+	if len(ft.results) > 0 {
+		fc.setType(ft.results[0])
+	}
+	return ft.results
+}
+
+// untyped constants are exact up to this precision
+const maxConstantBits = 512
+
+// a typed numeric constant is representable by its type, a float constant of an integer type
+// is an integer value, and a complex constant of a real type has an imaginary part of zero
+func checkConstantRange(tok *Token, constant Constant, to Type) {
+	if cc, ok := constant.(*ComplexConstant); ok && !isComplex(to) {
+		if cc.im.Sign() != 0 {
+			putErrorAt(tok, "Constant %s truncated to %s.", cc.toStringValue(nil), to)
+		}
+		constant = &FloatConstant{value: cc.re}
+	}
+	if isFloat(to) {
+		if value := floatValueOf(constant); value != nil && !representableFloat(value, to) {
+			putErrorAt(tok, "Constant %s overflows %s.", constant.toStringValue(nil), to)
+		}
+		return
+	}
+	if fc, ok := constant.(*FloatConstant); ok && isInteger(to) {
+		if !fc.value.IsInt() {
+			putErrorAt(tok, "Constant %s truncated to integer.", fc.toStringValue(nil))
+		}
+		constant = convertConstant(constant, to)
+	}
+	value := integerValueOf(constant)
+	if value == nil {
+		return
+	}
+	if isUntyped(to) {
+		if value.BitLen() > maxConstantBits {
+			putErrorAt(tok, "Constant overflow.")
+		}
+		return
+	}
+	if !representable(value, to) {
+		putErrorAt(tok, "Constant %s overflows %s.", value, to)
+	}
+}
+
+// give untyped constant expressions the type required by the context
+func convertUntyped(ast Ast, to Type) {
+	expr := ast.(Expression)
+	if !isUntyped(expr.getType()) || isUntyped(to) {
+		return
+	}
+	if isComplex(to) {
+		putErrorAt(expr.getTok(), "Complex types are not supported.")
+	}
+	expr.setType(to)
+	if constant := expr.getConstant(); constant != nil {
+		// the operands are not emitted
+		checkConstantRange(expr.getTok(), constant, to)
+		expr.setConstant(convertConstant(constant, to))
+		return
+	}
+	switch v := ast.(type) {
+	case *PrimaryExpression:
+		convertUntyped(v.child, to)
+	case *UnaryExpression:
+		convertUntyped(v.operand, to)
+	case *ShiftExpression:
+		if !isInteger(to) {
+			putErrorAt(v.left.(Expression).getTok(), "Shifted operand of type %s must be integer.", to)
+		}
+		convertUntyped(v.left, to)
+	case *ArithmeticExpression:
+		convertUntyped(v.left, to)
+		convertUntyped(v.right, to)
+	case *LogicalAndExpression:
+		convertUntyped(v.left, to)
+		convertUntyped(v.right, to)
+	case *LogicalOrExpression:
+		convertUntyped(v.left, to)
+		convertUntyped(v.right, to)
+	case *LogicalNotExpression:
+		convertUntyped(v.operand, to)
+	}
+}
+
+// the value of a constant expression, but nil, set by the checker
+func constantOf(ast Ast) Constant {
+	constant := ast.(Expression).getConstant()
+	if _, ok := constant.(*NilConstant); ok {
+		return nil
+	}
+	return constant
+}
+
+// the value of an expression whose operands are constants, or nil.
+// the operands are checked, and the type of the expression is set
+func foldConstant(ast Ast) Constant {
+	switch v := ast.(type) {
+	case *PrimaryExpression:
+		return constantOf(v.child)
+	case *AstString:
+		return &StringConstant{str: v}
+	case *Identifier:
+		if nc, ok := v.symbol.(*NamedConstant); ok {
+			return nc.value
+		}
+	case *UnaryExpression:
+		if op, ok := v.operator.(FloatUnaryOperator); ok && isComplex(v.gtype) {
+			if x := complexValueOf(constantOf(v.operand)); x != nil {
+				return makeComplexConstant(op.evaluateFloat(x.re), op.evaluateFloat(x.im))
+			}
+			return nil
+		}
+		if op, ok := v.operator.(FloatUnaryOperator); ok && isFloat(v.gtype) {
+			if x := floatValueOf(constantOf(v.operand)); x != nil {
+				return makeFloatConstant(op.evaluateFloat(x), v.gtype)
+			}
+			return nil
+		}
+		if x := integerValueOf(constantOf(v.operand)); x != nil {
+			return makeIntegerConstant(v.operator.evaluate(x, v.gtype), v.gtype)
+		}
+	case *ArithmeticExpression:
+		left, right := constantOf(v.left), constantOf(v.right)
+		if x, ok := left.(*StringConstant); ok {
+			if y, ok := right.(*StringConstant); ok {
+				return &StringConstant{str: getAstString(x.str.sval + y.str.sval)}
+			}
+		}
+		if op, ok := v.operator.(ComplexOperator); ok && isComplex(v.gtype) {
+			x, y := complexValueOf(left), complexValueOf(right)
+			if x != nil && y != nil && !(isDivision(v.operator) && isZeroComplex(y)) {
+				return op.evaluateComplex(x, y)
+			}
+			return nil
+		}
+		if op, ok := v.operator.(FloatOperator); ok && isFloat(v.gtype) {
+			x, y := floatValueOf(left), floatValueOf(right)
+			if x != nil && y != nil && !(isDivision(v.operator) && y.Sign() == 0) {
+				return makeFloatConstant(op.evaluateFloat(x, y), v.gtype)
+			}
+			return nil
+		}
+		x, y := integerValueOf(left), integerValueOf(right)
+		if x != nil && y != nil && !(isDivision(v.operator) && y.Sign() == 0) {
+			return makeIntegerConstant(v.operator.evaluate(x, y), v.gtype)
+		}
+	case *RelationalExpression:
+		if cmp, ok := compareConstants(constantOf(v.left), constantOf(v.right)); ok {
+			return &BoolConstant{value: v.operator.evaluate(cmp)}
+		}
+	case *LogicalAndExpression:
+		x, xok := constantOf(v.left).(*BoolConstant)
+		y, yok := constantOf(v.right).(*BoolConstant)
+		if xok && yok {
+			return &BoolConstant{value: x.value && y.value}
+		}
+	case *LogicalOrExpression:
+		x, xok := constantOf(v.left).(*BoolConstant)
+		y, yok := constantOf(v.right).(*BoolConstant)
+		if xok && yok {
+			return &BoolConstant{value: x.value || y.value}
+		}
+	case *LogicalNotExpression:
+		if x, ok := constantOf(v.operand).(*BoolConstant); ok {
+			return &BoolConstant{value: !x.value}
+		}
+	case *ShiftExpression:
+		x, y := integerValueOf(constantOf(v.left)), integerValueOf(constantOf(v.right))
+		if x == nil || y == nil {
+			return nil
+		}
+		if y.Sign() < 0 {
+			putErrorAt(v.tok, "Invalid negative shift count %s.", y)
+		}
+		if y.Cmp(big.NewInt(maxConstantBits)) > 0 {
+			if _, left := v.operator.(*ShiftLeftOperator); left && x.Sign() != 0 {
+				putErrorAt(v.tok, "Constant shift overflow.")
+			}
+			// every bit is shifted out
+			y = big.NewInt(maxConstantBits)
+		}
+		return makeIntegerConstant(v.operator.evaluate(x, y), v.gtype)
+	case *ConversionExpression:
+		constant := constantOf(v.operand)
+		switch {
+		case floatValueOf(constant) != nil && isNumeric(v.toType):
+			// converted by the checker to the representation of the type
+			return constant
+		case constant != nil && isString(v.toType) && isString(v.operand.(Expression).getType()):
+			return constant
+		}
+	case *LenExpression:
+		if sc, ok := constantOf(v.operand).(*StringConstant); ok {
+			return &IntegerConstant{value: big.NewInt(int64(len(sc.str.sval)))}
+		}
+	}
+	return nil
+}
+
+// the sign of comparing the constants, booleans are only equal or not
+func compareConstants(left Constant, right Constant) (int, bool) {
+	if x, ok := left.(*StringConstant); ok {
+		if y, ok := right.(*StringConstant); ok {
+			return strings.Compare(x.str.sval, y.str.sval), true
+		}
+	}
+	if x, ok := left.(*BoolConstant); ok {
+		if y, ok := right.(*BoolConstant); ok && x.value == y.value {
+			return 0, true
+		} else if ok {
+			return 1, true
+		}
+	}
+	if x, y := integerValueOf(left), integerValueOf(right); x != nil && y != nil {
+		return x.Cmp(y), true
+	}
+	if x, y := floatValueOf(left), floatValueOf(right); x != nil && y != nil {
+		return x.Cmp(y), true
+	}
+	// complex constants are only equal or not
+	if x, y := complexValueOf(left), complexValueOf(right); x != nil && y != nil {
+		if x.re.Cmp(y.re) == 0 && x.im.Cmp(y.im) == 0 {
+			return 0, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func isDivision(operator ArithmeticOperator) bool {
+	switch operator.(type) {
+	case *DivisionOperator, *RemainderOperator:
+		return true
+	}
+	return false
+}
+
+func isZeroConstant(ast Ast) bool {
+	if cc, ok := constantOf(ast).(*ComplexConstant); ok {
+		return isZeroComplex(cc)
+	}
+	value := floatValueOf(constantOf(ast))
+	return value != nil && value.Sign() == 0
+}
+
+func isZeroComplex(cc *ComplexConstant) bool {
+	return cc.re.Sign() == 0 && cc.im.Sign() == 0
+}
@@ -1,21 +1,398 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 var frameHeight int
+var labelIndex int
 
 func emitCode(code string, v ...interface{}) {
 	fmt.Printf(code+"\n", v...)
 }
 
+func makeLabel() string {
+	label := fmt.Sprintf(".J%d", labelIndex)
+	labelIndex++
+	return label
+}
+
+func emitLabel(label string) {
+	emitCode("%s:", label)
+}
+
+// push a value of the type read from the operand
+func emitLoad(gtype Type, operand string) {
+	if isAggregate(gtype) {
+		emitCode("\tleaq\t%s, %%rax", operand)
+		emitCode("\tpushq\t%%rax")
+	} else if gtype.size() == 8 {
+		emitCode("\tpushq\t%s", operand)
+	} else {
+		emitLoadToRegister(gtype, operand)
+		emitCode("\tpushq\t%%rax")
+	}
+	frameHeight += 8
+}
+
+// load a value of the type extended to 64 bits into %rax
+func emitLoadToRegister(gtype Type, operand string) {
+	instruction := loadInstruction(gtype)
+	if instruction == "movl" {
+		// movl clears the upper half of %rax
+		emitCode("\tmovl\t%s, %%eax", operand)
+	} else {
+		emitCode("\t%s\t%s, %%rax", instruction, operand)
+	}
+}
+
+func loadInstruction(gtype Type) string {
+	unsigned := isUnsigned(gtype)
+	switch gtype.size() {
+	case 1:
+		if unsigned {
+			return "movzbq"
+		}
+		return "movsbq"
+	case 2:
+		if unsigned {
+			return "movzwq"
+		}
+		return "movswq"
+	case 4:
+		if unsigned {
+			return "movl"
+		}
+		return "movslq"
+	}
+	return "movq"
+}
+
+// push the value in a register, a vector register has no push
+func emitPushRegister(reg string) {
+	if strings.HasPrefix(reg, "xmm") {
+		emitCode("\tsubq\t$8, %%rsp")
+		emitCode("\tmovq\t%%%s, 0(%%rsp)", reg)
+		return
+	}
+	emitCode("\tpushq\t%%%s", reg)
+}
+
+func emitPopRegister(reg string) {
+	if strings.HasPrefix(reg, "xmm") {
+		emitCode("\tmovq\t0(%%rsp), %%%s", reg)
+		emitCode("\taddq\t$8, %%rsp")
+		return
+	}
+	emitCode("\tpopq\t%%%s", reg)
+}
+
+// extend the result of an operation in %rax from the width of the type,
+// so that sized integers wrap around. the bits of a float are kept
+func emitExtend(gtype Type) {
+	if isFloat(gtype) {
+		return
+	}
+	switch gtype.size() {
+	case 1:
+		emitLoadToRegister(gtype, "%al")
+	case 2:
+		emitLoadToRegister(gtype, "%ax")
+	case 4:
+		emitLoadToRegister(gtype, "%eax")
+	}
+}
+
+// store the value in %rcx to the address in %rax,
+// an aggregate value is copied from the address in %rcx
+func emitStore(gtype Type) {
+	if isAggregate(gtype) {
+		emitCode("\tmovq\t%%rcx, %%rsi")
+		emitCode("\tmovq\t%%rax, %%rdi")
+		emitCode("\tmovq\t$%d, %%rcx", gtype.size())
+		emitCode("\trep movsb")
+		return
+	}
+	switch gtype.size() {
+	case 1:
+		emitCode("\tmovb\t%%cl, 0(%%rax)")
+	case 2:
+		emitCode("\tmovw\t%%cx, 0(%%rax)")
+	case 4:
+		emitCode("\tmovl\t%%ecx, 0(%%rax)")
+	default:
+		emitCode("\tmovq\t%%rcx, 0(%%rax)")
+	}
+}
+
+// emit "op %rbx, %rax" with the operand width of the type
+func emitBinaryOperation(op string, gtype Type) {
+	if gtype.size() == 8 {
+		emitCode("\t%sq\t%%rbx, %%rax", op)
+	} else {
+		emitCode("\t%sl\t%%ebx, %%eax", op)
+	}
+}
+
+// call a routine of the runtime with the arguments set in the registers
+func emitRuntimeCall(name string) {
+	padding := 0
+	if frameHeight%16 != 0 {
+		padding = 16 - frameHeight%16
+		emitCode("\tsubq\t$%d, %%rsp  # stack padding", padding)
+	}
+	emitCode("\tcallq\t%s", name)
+	if padding > 0 {
+		emitCode("\taddq\t$%d, %%rsp  # pop padding", padding)
+	}
+}
+
+// allocate zeroed memory on the heap, the address is left in %rax
+func emitAllocate(size int) {
+	emitCode("\tmovq\t$%d, %%rdi", size)
+	emitRuntimeCall("_runtime_alloc")
+}
+
+// replace the address of an aggregate value on the stack with a copy on the heap
+func emitCopyToHeap(gtype Type) {
+	emitAllocate(gtype.size())
+	emitCode("\tpopq\t%%rcx")
+	emitStore(gtype)
+	emitCode("\tpushq\t%%rax")
+}
+
+// replace the address of an aggregate value on the stack with a copy in the temporary
+func emitCopyToTemporary(lv *LocalVariable) {
+	emitCode("\tleaq\t-%d(%%rbp), %%rax", lv.offset)
+	emitCode("\tpopq\t%%rcx")
+	emitStore(lv.gtype)
+	emitCode("\tpushq\t%%rax")
+}
+
+// panic unless 0 <= %rcx < length, the index is compared unsigned
+func emitBoundsCheck(length string, position *AstString) {
+	emitRangeCheck("%rcx", length, "jb", runtimeErrorIndex, position)
+}
+
+// panic with the format unless the jump on "cmpq limit, value" is taken,
+// the value and the limit are the arguments of the format, the limit is not in %rsi
+func emitRangeCheck(value string, limit string, jump string, format string, position *AstString) {
+	ok := makeLabel()
+	emitCode("\tcmpq\t%s, %s", limit, value)
+	emitCode("\t%s\t%s", jump, ok)
+	emitCode("\tmovq\t%s, %%rsi", value)
+	emitCode("\tmovq\t%s, %%rdx", limit)
+	emitCode("\tleaq\t%s(%%rip), %%rdi", format)
+	emitCode("\tleaq\t.%s(%%rip), %%rcx", position.slabel)
+	emitCode("\tcallq\t_runtime_panic")
+	emitLabel(ok)
+}
+
+// throw away the value pushed by an expression
+func emitDiscard() {
+	emitCode("\taddq\t$8, %%rsp")
+	frameHeight -= 8
+}
+
+// pop the condition value pushed by an expression and branch on it
+func emitJumpIfZero(label string) {
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 8
+	emitCode("\tcmpq\t$0, %%rax")
+	emitCode("\tje\t%s", label)
+}
+
+func emitJumpIfNotZero(label string) {
+	emitCode("\tpopq\t%%rax")
+	frameHeight -= 8
+	emitCode("\tcmpq\t$0, %%rax")
+	emitCode("\tjne\t%s", label)
+}
+
+func dataDirective(gtype Type) string {
+	switch gtype.size() {
+	case 1:
+		return ".byte"
+	case 2:
+		return ".short"
+	case 4:
+		return ".long"
+	}
+	return ".quad"
+}
+
+// the bytes of a string literal are followed by its header of the address and the length.
+// the terminating NUL is only for C functions, which take the bytes of a literal.
+// the type descriptors follow them, as all the types are registered by the checker
 func emitDataSection() {
 	emitCode(".data")
 
 	// put stinrgs first
 	for _, ast := range stringList {
 		emitCode(".%s:", ast.slabel)
-		emitCode(".string \"%s\"", ast.sval)
+		emitCode(".string \"%s\"", quoteAssembly(ast.sval))
+		emitCode(".balign\t8")
+		emitCode(".%s.header:", ast.slabel)
+		emitCode(".quad\t.%s, %d", ast.slabel, len(ast.sval))
+	}
+	// the closures of the functions without context
+	emitCode(".balign\t8")
+	for _, code := range sortedLabels(staticFuncValues) {
+		emitCode("_%s.f:", code)
+		emitCode(".quad\t_%s", code)
+	}
+	for _, code := range sortedMethodExpressionLabels(promotedMethodExpressions) {
+		emitCode("_%s.f:", code)
+		emitCode(".quad\t_%s", code)
+	}
+	emitTypeInfo()
+}
+
+/* ================================
+ * func values
+ * ================================ */
+// a func value is the address of a closure, which holds the code address followed by the context.
+// the code is called with the closure in %r10
+
+// the labels of the code used as func values without context, like T.M
+var staticFuncValues = make(map[string]*FunctionSignature)
+
+// the methods of x.M, which are called with the receiver in the closure
+var boundMethods = make(map[string]*FunctionSignature)
+
+// the value methods of (*T).M, which are called with the receiver pointer
+var derefMethods = make(map[string]*FunctionSignature)
+
+// the value methods of T.M of a float type, which are called with the receiver in %xmm0
+var floatReceiverMethods = make(map[string]*FunctionSignature)
+
+// T.M and (*T).M of the promoted methods, by the labels of their code.
+// the code is called with the address of the receiver of T, which it finds the receiver of M from
+var promotedMethodExpressions = make(map[string]*MethodExpression)
+
+// register the code of a method expression, the label is returned
+func useMethodExpression(sig *FunctionSignature, pointer bool) string {
+	code := methodCode(sig, pointer)
+	if !pointer && isFloat(sig.receiver.gtype) {
+		// a receiver is in %rdi
+		floatReceiverMethods[code] = sig
+		code += ".xmm"
+	}
+	staticFuncValues[code] = sig
+	return code
+}
+
+func usePromotedMethodExpression(me *MethodExpression) string {
+	code := namedOf(me.recvType).name + "." + me.name
+	promotedMethodExpressions[code] = me
+	return code
+}
+
+func sortedMethodExpressionLabels(m map[string]*MethodExpression) []string {
+	var labels []string
+	for label := range m {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// the label of the code of a method called with the receiver, or a pointer to it
+func methodCode(sig *FunctionSignature, pointer bool) string {
+	code := sig.label()
+	if pointer && !sig.hasPointerReceiver() && !isAggregate(sig.receiver.gtype) {
+		// an aggregate is passed as its address already
+		derefMethods[code] = sig
+		code += ".deref"
+	}
+	return code
+}
+
+func useMethodValue(sig *FunctionSignature) {
+	boundMethods[sig.label()] = sig
+}
+
+func sortedLabels(m map[string]*FunctionSignature) []string {
+	var labels []string
+	for label := range m {
+		labels = append(labels, label)
 	}
+	sort.Strings(labels)
+	return labels
+}
+
+// the code to call the methods of the func values
+func emitMethodWrappers() {
+	emitCode(".text")
+	for _, label := range sortedLabels(boundMethods) {
+		sig := boundMethods[label]
+		emitCode("_%s.fm:", label)
+		// the integer arguments are shifted for the receiver
+		ints := 0
+		for _, param := range sig.params {
+			if !isFloat(param.gtype) {
+				ints++
+			}
+		}
+		for i := ints; i > 0; i-- {
+			emitCode("\tmovq\t%%%s, %%%s", regs[i-1], regs[i])
+		}
+		emitCode("\tmovq\t8(%%r10), %%rdi")
+		emitCode("\tjmp\t_%s", label)
+	}
+	for _, label := range sortedLabels(floatReceiverMethods) {
+		sig := floatReceiverMethods[label]
+		types := []Type{sig.receiver.gtype}
+		for _, param := range sig.params {
+			types = append(types, param.gtype)
+		}
+		from := assignRegisters(types, regs, false)
+		to := assignRegisters(types, regs, true)
+		emitCode("_%s.xmm:", label)
+		// the other arguments are shifted up for the receiver, and then the floats down
+		for i := len(types) - 1; i > 0; i-- {
+			if !isFloat(types[i]) {
+				emitCode("\tmovq\t%%%s, %%%s", from[i], to[i])
+			}
+		}
+		emitCode("\tmovq\t%%%s, %%%s", from[0], to[0])
+		for i := 1; i < len(types); i++ {
+			if isFloat(types[i]) {
+				emitCode("\tmovq\t%%%s, %%%s", from[i], to[i])
+			}
+		}
+		emitCode("\tjmp\t_%s", label)
+	}
+	for _, label := range sortedMethodExpressionLabels(promotedMethodExpressions) {
+		me := promotedMethodExpressions[label]
+		emitCode("_%s:", label)
+		emitPromotedMethodCall(me.recvType, me.name)
+	}
+	for _, label := range sortedLabels(derefMethods) {
+		emitCode("_%s.deref:", label)
+		emitLoadToRegister(derefMethods[label].receiver.gtype, "0(%rdi)")
+		emitCode("\tmovq\t%%rax, %%rdi")
+		emitCode("\tjmp\t_%s", label)
+	}
+}
+
+// escape the bytes for a string directive of the assembler
+func quoteAssembly(s string) string {
+	var quoted []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			quoted = append(quoted, '\\', c)
+		case c < 0x20 || c >= 0x7f:
+			quoted = append(quoted, fmt.Sprintf("\\%03o", c)...)
+		default:
+			quoted = append(quoted, c)
+		}
+	}
+	return string(quoted)
 }
 
 func emitFuncPrologue(fname string) {
@@ -36,4 +413,10 @@ func emitFuncEpilogue() {
 func generate(ast Ast) {
 	emitDataSection()
 	ast.emit()
+	for _, fd := range funcLiterals {
+		fd.emit()
+	}
+	emitTypeInfoWrappers()
+	emitMethodWrappers()
+	emitRuntime()
 }
@@ -1,44 +1,258 @@
 package main
 
 import (
-	"strconv"
+	"fmt"
+	"math"
+	"math/big"
 )
 
 /*** interface definitioins ***/
+// a constant is emitted as a value of the type of its expression
 type Constant interface {
-	emitConstant()
-	toStringValue() string
+	emitConstant(gtype Type)
+	toStringValue(gtype Type) string
 }
 
 /* ===============================
  * Constants implementation
  * =============================== */
+// the value of a rune literal, or of an untyped expression with one
 type RuneConstant struct {
-	rval rune
+	value *big.Int
 }
 
 // implements Constant
-func (rc *RuneConstant) emitConstant() {
-	emitCode("\tpushq\t$%d", rc.rval)
-	frameHeight += 8
+func (rc *RuneConstant) emitConstant(gtype Type) {
+	emitIntegerConstant(rc.value)
 }
 
 // implements Costant
-func (rc *RuneConstant) toStringValue() string {
-	return string(rc.rval)
+func (rc *RuneConstant) toStringValue(gtype Type) string {
+	return rc.value.String()
 }
 
-type IntegerConstant struct {
-	ival int
+// a string literal, whose header is emitted by emitDataSection
+type StringConstant struct {
+	str *AstString
+}
+
+// implements Constant
+func (sc *StringConstant) emitConstant(gtype Type) {
+	sc.str.emit()
 }
 
 // implements Constant
-func (ic *IntegerConstant) emitConstant() {
-	emitCode("\tpushq\t$%d", ic.ival)
+func (sc *StringConstant) toStringValue(gtype Type) string {
+	return fmt.Sprintf(".%s, %d", sc.str.slabel, len(sc.str.sval))
+}
+
+type NilConstant struct {
+}
+
+// implements Constant
+func (nc *NilConstant) emitConstant(gtype Type) {
+	emitCode("\tpushq\t$0")
 	frameHeight += 8
 }
 
 // implements Constant
-func (ic *IntegerConstant) toStringValue() string {
-	return strconv.Itoa(ic.ival)
+func (nc *NilConstant) toStringValue(gtype Type) string {
+	return "nil"
+}
+
+// the value of true and false, or of a constant condition
+type BoolConstant struct {
+	value bool
+}
+
+// implements Constant
+func (bc *BoolConstant) emitConstant(gtype Type) {
+	emitCode("\tpushq\t$%s", bc.toStringValue(gtype))
+	frameHeight += 8
+}
+
+// implements Constant
+func (bc *BoolConstant) toStringValue(gtype Type) string {
+	if bc.value {
+		return "1"
+	}
+	return "0"
+}
+
+// integer constants are exact, a typed one is representable by its type
+type IntegerConstant struct {
+	value *big.Int
+}
+
+// implements Constant
+func (ic *IntegerConstant) emitConstant(gtype Type) {
+	emitIntegerConstant(ic.value)
+}
+
+// implements Constant
+func (ic *IntegerConstant) toStringValue(gtype Type) string {
+	return ic.value.String()
+}
+
+// float constants are exact up to the precision of the untyped constants,
+// a typed one is rounded to its type. the value of a float type is its bits
+type FloatConstant struct {
+	value *big.Float
+}
+
+// implements Constant
+func (fc *FloatConstant) emitConstant(gtype Type) {
+	emitIntegerConstant(floatBits(fc.value, gtype))
+}
+
+// implements Constant
+func (fc *FloatConstant) toStringValue(gtype Type) string {
+	if gtype == nil || isUntyped(gtype) {
+		return fc.value.Text('g', -1)
+	}
+	return floatBits(fc.value, gtype).String()
+}
+
+// complex constants are untyped, as there are no complex types.
+// one of an imaginary part of zero is converted to a real type
+type ComplexConstant struct {
+	re *big.Float
+	im *big.Float
+}
+
+// implements Constant
+func (cc *ComplexConstant) emitConstant(gtype Type) {
+	putError("internal error: complex constant %s is emitted.", cc.toStringValue(nil))
+}
+
+// implements Constant
+func (cc *ComplexConstant) toStringValue(gtype Type) string {
+	if cc.im.Sign() < 0 {
+		return fmt.Sprintf("(%s - %si)", cc.re.Text('g', -1), newFloat().Neg(cc.im).Text('g', -1))
+	}
+	return fmt.Sprintf("(%s + %si)", cc.re.Text('g', -1), cc.im.Text('g', -1))
+}
+
+// the bits of the IEEE 754 representation of the value in the float type
+func floatBits(value *big.Float, gtype Type) *big.Int {
+	if gtype.size() == 4 {
+		f, _ := value.Float32()
+		return new(big.Int).SetUint64(uint64(math.Float32bits(f)))
+	}
+	f, _ := value.Float64()
+	return new(big.Int).SetUint64(math.Float64bits(f))
+}
+
+// push the bit pattern of the value in 64 bits
+func emitIntegerConstant(value *big.Int) {
+	bits := int64(value.Uint64())
+	if value.IsInt64() {
+		bits = value.Int64()
+	}
+	if bits < math.MinInt32 || bits > math.MaxInt32 {
+		// pushq takes only a 32-bit immediate
+		emitCode("\tmovabsq\t$%d, %%rax", bits)
+		emitCode("\tpushq\t%%rax")
+	} else {
+		emitCode("\tpushq\t$%d", bits)
+	}
+	frameHeight += 8
+}
+
+// the value of an integer or a rune constant, or nil
+func integerValueOf(c Constant) *big.Int {
+	switch v := c.(type) {
+	case *IntegerConstant:
+		return v.value
+	case *RuneConstant:
+		return v.value
+	}
+	return nil
+}
+
+// a rune constant when the type is untyped rune
+func makeIntegerConstant(value *big.Int, t Type) Constant {
+	if t == tUntypedRune {
+		return &RuneConstant{value: value}
+	}
+	return &IntegerConstant{value: value}
+}
+
+// the value of a numeric constant, or nil
+func floatValueOf(c Constant) *big.Float {
+	if fc, ok := c.(*FloatConstant); ok {
+		return fc.value
+	}
+	if value := integerValueOf(c); value != nil {
+		return new(big.Float).SetPrec(maxConstantBits).SetInt(value)
+	}
+	return nil
+}
+
+// the value of a numeric constant as a complex constant, or nil
+func complexValueOf(c Constant) *ComplexConstant {
+	if cc, ok := c.(*ComplexConstant); ok {
+		return cc
+	}
+	if value := floatValueOf(c); value != nil {
+		return &ComplexConstant{re: value, im: newFloat()}
+	}
+	return nil
+}
+
+// a numeric constant of an integer value, like 2.0
+func isIntegralConstant(c Constant) bool {
+	x := complexValueOf(c)
+	return x != nil && x.im.Sign() == 0 && x.re.IsInt()
+}
+
+// a typed float constant is rounded to its type. a constant is an exact value, whose zero
+// has no sign
+func makeFloatConstant(value *big.Float, t Type) Constant {
+	if !isUntyped(t) {
+		f, _ := value.Float64()
+		if t.size() == 4 {
+			f32, _ := value.Float32()
+			f = float64(f32)
+		}
+		value = newFloat().SetFloat64(f)
+	}
+	if value.Sign() == 0 {
+		value = newFloat()
+	}
+	return &FloatConstant{value: value}
+}
+
+func makeComplexConstant(re *big.Float, im *big.Float) *ComplexConstant {
+	if re.Sign() == 0 {
+		re = newFloat()
+	}
+	if im.Sign() == 0 {
+		im = newFloat()
+	}
+	return &ComplexConstant{re: re, im: im}
+}
+
+// the constant in the representation of the type, a float constant of an integer type is
+// an integer value, which is checked with checkConstantRange
+func convertConstant(c Constant, t Type) Constant {
+	if cc, ok := c.(*ComplexConstant); ok && isNumeric(t) && !isComplex(t) {
+		// the imaginary part is zero
+		c = &FloatConstant{value: cc.re}
+	}
+	switch {
+	case isFloat(t):
+		if value := floatValueOf(c); value != nil {
+			return makeFloatConstant(value, t)
+		}
+	case isInteger(t):
+		if fc, ok := c.(*FloatConstant); ok {
+			value, _ := fc.value.Int(nil)
+			return makeIntegerConstant(value, t)
+		}
+		if value := integerValueOf(c); value != nil {
+			return makeIntegerConstant(value, t)
+		}
+	}
+	return c
 }
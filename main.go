@@ -18,6 +18,14 @@ func putError(errorMsg string, v ...interface{}) {
 	panic(s)
 }
 
+func putErrorAt(tok *Token, errorMsg string, v ...interface{}) {
+	if tok == nil || tok.line == 0 {
+		putError(errorMsg, v...)
+	}
+	msg := fmt.Sprintf(errorMsg, v...)
+	putError("%s:%d:%d: %s", tok.filename, tok.line, tok.column, msg)
+}
+
 func parseOptions(args []string) {
 	for _, opt := range args {
 		if opt == "-t" {
@@ -52,6 +60,7 @@ func main() {
 	if errorFlag {
 		panic("internal error")
 	}
+	check(ast)
 	if astMode {
 		showAst(ast, 0)
 	} else {
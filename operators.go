@@ -1,8 +1,43 @@
 package main
 
+import (
+	"math/big"
+)
+
 /*** interface definitioins ***/
+// evaluate folds constant operands, exactly
 type ArithmeticOperator interface {
-	emitOperator()
+	emitOperator(gtype Type)
+	evaluate(x *big.Int, y *big.Int) *big.Int
+}
+
+// emitCompare sets the flags and returns the condition code which holds,
+// evaluate folds the sign of comparing constant operands
+type RelationalOperator interface {
+	emitCompare(gtype Type) string
+	evaluate(cmp int) bool
+}
+
+type UnaryOperator interface {
+	emitOperator(gtype Type)
+	evaluate(x *big.Int, gtype Type) *big.Int
+}
+
+// the operators defined on floats, which fold float constants too
+type FloatOperator interface {
+	ArithmeticOperator
+	evaluateFloat(x *big.Float, y *big.Float) *big.Float
+}
+
+// the operators defined on complex constants
+type ComplexOperator interface {
+	FloatOperator
+	evaluateComplex(x *ComplexConstant, y *ComplexConstant) *ComplexConstant
+}
+
+type FloatUnaryOperator interface {
+	UnaryOperator
+	evaluateFloat(x *big.Float) *big.Float
 }
 
 /* ===============================
@@ -12,32 +47,527 @@ type AdditiveOperator struct {
 }
 
 // implements ArithmeticOperator
-func (ao *AdditiveOperator) emitOperator() {
-	emitCode("\taddl\t%%ebx, %%eax")
+func (ao *AdditiveOperator) emitOperator(gtype Type) {
+	if isString(gtype) {
+		// the concatenation is a new string
+		emitCode("\tmovq\t%%rax, %%rdi")
+		emitCode("\tmovq\t%%rbx, %%rsi")
+		emitRuntimeCall("_runtime_concatstrings")
+		return
+	}
+	if isFloat(gtype) {
+		emitFloatOperation("add", gtype)
+		return
+	}
+	emitBinaryOperation("add", gtype)
+}
+
+// implements ArithmeticOperator
+func (ao *AdditiveOperator) evaluate(x *big.Int, y *big.Int) *big.Int {
+	return new(big.Int).Add(x, y)
+}
+
+// implements FloatOperator
+func (ao *AdditiveOperator) evaluateFloat(x *big.Float, y *big.Float) *big.Float {
+	return newFloat().Add(x, y)
+}
+
+// implements ComplexOperator
+func (ao *AdditiveOperator) evaluateComplex(x *ComplexConstant, y *ComplexConstant) *ComplexConstant {
+	return makeComplexConstant(newFloat().Add(x.re, y.re), newFloat().Add(x.im, y.im))
 }
 
 type SubtractionOperator struct {
 }
 
 // implements ArithmeticOperator
-func (so *SubtractionOperator) emitOperator() {
-	emitCode("\tsubl\t%%ebx, %%eax")
+func (so *SubtractionOperator) emitOperator(gtype Type) {
+	if isFloat(gtype) {
+		emitFloatOperation("sub", gtype)
+		return
+	}
+	emitBinaryOperation("sub", gtype)
+}
+
+// implements ArithmeticOperator
+func (so *SubtractionOperator) evaluate(x *big.Int, y *big.Int) *big.Int {
+	return new(big.Int).Sub(x, y)
+}
+
+// implements FloatOperator
+func (so *SubtractionOperator) evaluateFloat(x *big.Float, y *big.Float) *big.Float {
+	return newFloat().Sub(x, y)
+}
+
+// implements ComplexOperator
+func (so *SubtractionOperator) evaluateComplex(x *ComplexConstant, y *ComplexConstant) *ComplexConstant {
+	return makeComplexConstant(newFloat().Sub(x.re, y.re), newFloat().Sub(x.im, y.im))
 }
 
 type MultiplicativeOperator struct {
 }
 
 // implements ArithmeticOperator
-func (mo *MultiplicativeOperator) emitOperator() {
+func (mo *MultiplicativeOperator) emitOperator(gtype Type) {
+	if isFloat(gtype) {
+		emitFloatOperation("mul", gtype)
+		return
+	}
 	emitCode("\tpushq\t%%rdx")
-	emitCode("\timul\t%%ebx, %%eax")
+	emitBinaryOperation("imul", gtype)
 	emitCode("\tpopq\t%%rdx")
 }
 
+// implements ArithmeticOperator
+func (mo *MultiplicativeOperator) evaluate(x *big.Int, y *big.Int) *big.Int {
+	return new(big.Int).Mul(x, y)
+}
+
+// implements FloatOperator
+func (mo *MultiplicativeOperator) evaluateFloat(x *big.Float, y *big.Float) *big.Float {
+	return newFloat().Mul(x, y)
+}
+
+// implements ComplexOperator
+func (mo *MultiplicativeOperator) evaluateComplex(x *ComplexConstant, y *ComplexConstant) *ComplexConstant {
+	// (a+bi)(c+di) = (ac-bd) + (ad+bc)i
+	re := newFloat().Sub(newFloat().Mul(x.re, y.re), newFloat().Mul(x.im, y.im))
+	im := newFloat().Add(newFloat().Mul(x.re, y.im), newFloat().Mul(x.im, y.re))
+	return makeComplexConstant(re, im)
+}
+
 type DivisionOperator struct {
 }
 
 // implements AritheticOperator
-func (do *DivisionOperator) emitOperator() {
-	emitCode("\tidivl\t%%ebx, %%eax")
+func (do *DivisionOperator) emitOperator(gtype Type) {
+	if isFloat(gtype) {
+		emitFloatOperation("div", gtype)
+		return
+	}
+	emitDivision(gtype, false)
+}
+
+// implements ArithmeticOperator
+func (do *DivisionOperator) evaluate(x *big.Int, y *big.Int) *big.Int {
+	// truncated toward zero
+	return new(big.Int).Quo(x, y)
+}
+
+// implements FloatOperator
+func (do *DivisionOperator) evaluateFloat(x *big.Float, y *big.Float) *big.Float {
+	return newFloat().Quo(x, y)
+}
+
+// implements ComplexOperator
+func (do *DivisionOperator) evaluateComplex(x *ComplexConstant, y *ComplexConstant) *ComplexConstant {
+	// (a+bi)/(c+di) = ((ac+bd) + (bc-ad)i) / (cc+dd)
+	norm := newFloat().Add(newFloat().Mul(y.re, y.re), newFloat().Mul(y.im, y.im))
+	re := newFloat().Add(newFloat().Mul(x.re, y.re), newFloat().Mul(x.im, y.im))
+	im := newFloat().Sub(newFloat().Mul(x.im, y.re), newFloat().Mul(x.re, y.im))
+	return makeComplexConstant(re.Quo(re, norm), im.Quo(im, norm))
+}
+
+type RemainderOperator struct {
+}
+
+// implements AritheticOperator
+func (ro *RemainderOperator) emitOperator(gtype Type) {
+	emitDivision(gtype, true)
+}
+
+// implements ArithmeticOperator
+func (ro *RemainderOperator) evaluate(x *big.Int, y *big.Int) *big.Int {
+	return new(big.Int).Rem(x, y)
+}
+
+// divide %rax by %rbx, truncating toward zero,
+// the operands are extended to 64 bits on the stack
+func emitDivision(gtype Type, remainder bool) {
+	emitCode("\tpushq\t%%rdx")
+	if isUnsigned(gtype) {
+		emitCode("\txorl\t%%edx, %%edx")
+		emitCode("\tdivq\t%%rbx")
+	} else {
+		// idivq traps on the minimum value divided by -1,
+		// Go defines the quotient as the negation and the remainder as 0
+		divide := makeLabel()
+		end := makeLabel()
+		emitCode("\tcmpq\t$-1, %%rbx")
+		emitCode("\tjne\t%s", divide)
+		if remainder {
+			emitCode("\txorl\t%%edx, %%edx")
+		} else {
+			emitCode("\tnegq\t%%rax")
+		}
+		emitCode("\tjmp\t%s", end)
+		emitLabel(divide)
+		emitCode("\tcqto")
+		emitCode("\tidivq\t%%rbx")
+		emitLabel(end)
+	}
+	if remainder {
+		emitCode("\tmovq\t%%rdx, %%rax")
+	}
+	emitCode("\tpopq\t%%rdx")
+}
+
+// the result of an operation on float constants, exact up to the precision
+func newFloat() *big.Float {
+	return new(big.Float).SetPrec(maxConstantBits)
+}
+
+// emit the SSE operation of %xmm1 into %xmm0 on the floats in %rax and %rbx,
+// the result is left in %rax. a float32 is in the low half of the register
+func emitFloatOperation(op string, gtype Type) {
+	emitCode("\tmovq\t%%rax, %%xmm0")
+	emitCode("\tmovq\t%%rbx, %%xmm1")
+	emitCode("\t%s%s\t%%xmm1, %%xmm0", op, floatSuffix(gtype))
+	emitCode("\tmovq\t%%xmm0, %%rax")
+}
+
+// the suffix of the SSE instructions on the scalar of the float type
+func floatSuffix(gtype Type) string {
+	if gtype.size() == 4 {
+		return "ss"
+	}
+	return "sd"
+}
+
+type BitAndOperator struct {
+}
+
+// implements ArithmeticOperator
+func (bao *BitAndOperator) emitOperator(gtype Type) {
+	emitBinaryOperation("and", gtype)
+}
+
+// implements ArithmeticOperator
+func (bao *BitAndOperator) evaluate(x *big.Int, y *big.Int) *big.Int {
+	return new(big.Int).And(x, y)
+}
+
+type BitOrOperator struct {
+}
+
+// implements ArithmeticOperator
+func (boo *BitOrOperator) emitOperator(gtype Type) {
+	emitBinaryOperation("or", gtype)
+}
+
+// implements ArithmeticOperator
+func (boo *BitOrOperator) evaluate(x *big.Int, y *big.Int) *big.Int {
+	return new(big.Int).Or(x, y)
+}
+
+type BitXorOperator struct {
+}
+
+// implements ArithmeticOperator
+func (bxo *BitXorOperator) emitOperator(gtype Type) {
+	emitBinaryOperation("xor", gtype)
+}
+
+// implements ArithmeticOperator
+func (bxo *BitXorOperator) evaluate(x *big.Int, y *big.Int) *big.Int {
+	return new(big.Int).Xor(x, y)
+}
+
+type BitClearOperator struct {
+}
+
+// implements ArithmeticOperator
+func (bco *BitClearOperator) emitOperator(gtype Type) {
+	emitCode("\tnotq\t%%rbx")
+	emitBinaryOperation("and", gtype)
+}
+
+// implements ArithmeticOperator
+func (bco *BitClearOperator) evaluate(x *big.Int, y *big.Int) *big.Int {
+	return new(big.Int).AndNot(x, y)
+}
+
+/* ===============================
+ * Shift operators implementation
+ *     shift %rax by the unsigned count in %rbx,
+ *     the width of the operand is 64 bits after the extension
+ * =============================== */
+type ShiftLeftOperator struct {
+}
+
+// implements ArithmeticOperator
+func (slo *ShiftLeftOperator) emitOperator(gtype Type) {
+	// x86 masks the count, but Go shifts every bit out
+	emitCode("\tmovq\t%%rbx, %%rcx")
+	emitCode("\tshlq\t%%cl, %%rax")
+	emitCode("\txorl\t%%ecx, %%ecx")
+	emitCode("\tcmpq\t$64, %%rbx")
+	emitCode("\tcmovaeq\t%%rcx, %%rax")
+}
+
+// implements ArithmeticOperator
+func (slo *ShiftLeftOperator) evaluate(x *big.Int, y *big.Int) *big.Int {
+	return new(big.Int).Lsh(x, uint(y.Uint64()))
+}
+
+type ShiftRightOperator struct {
+}
+
+// implements ArithmeticOperator
+func (sro *ShiftRightOperator) emitOperator(gtype Type) {
+	if isUnsigned(gtype) {
+		emitCode("\tmovq\t%%rbx, %%rcx")
+		emitCode("\tshrq\t%%cl, %%rax")
+		emitCode("\txorl\t%%ecx, %%ecx")
+		emitCode("\tcmpq\t$64, %%rbx")
+		emitCode("\tcmovaeq\t%%rcx, %%rax")
+	} else {
+		// the sign fills the value when the count is too large
+		emitCode("\tmovl\t$63, %%ecx")
+		emitCode("\tcmpq\t$63, %%rbx")
+		emitCode("\tcmovbeq\t%%rbx, %%rcx")
+		emitCode("\tsarq\t%%cl, %%rax")
+	}
+}
+
+// implements ArithmeticOperator
+func (sro *ShiftRightOperator) evaluate(x *big.Int, y *big.Int) *big.Int {
+	// rounded toward negative infinity, like the arithmetic shift
+	return new(big.Int).Rsh(x, uint(y.Uint64()))
+}
+
+/* ===============================
+ * Unary operators implementation
+ *     the operand is in %rax
+ * =============================== */
+type PositiveOperator struct {
+}
+
+// implements UnaryOperator
+func (po *PositiveOperator) emitOperator(gtype Type) {
+}
+
+// implements UnaryOperator
+func (po *PositiveOperator) evaluate(x *big.Int, gtype Type) *big.Int {
+	return x
+}
+
+// implements FloatUnaryOperator
+func (po *PositiveOperator) evaluateFloat(x *big.Float) *big.Float {
+	return x
+}
+
+type NegativeOperator struct {
+}
+
+// implements UnaryOperator
+func (no *NegativeOperator) emitOperator(gtype Type) {
+	if isFloat(gtype) {
+		// the sign bit is flipped, for 0 and NaN too
+		emitCode("\tbtcq\t$%d, %%rax", gtype.size()*8-1)
+		return
+	}
+	emitCode("\tnegq\t%%rax")
+}
+
+// implements UnaryOperator
+func (no *NegativeOperator) evaluate(x *big.Int, gtype Type) *big.Int {
+	return new(big.Int).Neg(x)
+}
+
+// implements FloatUnaryOperator
+func (no *NegativeOperator) evaluateFloat(x *big.Float) *big.Float {
+	return newFloat().Neg(x)
+}
+
+type ComplementOperator struct {
+}
+
+// implements UnaryOperator
+func (co *ComplementOperator) emitOperator(gtype Type) {
+	emitCode("\tnotq\t%%rax")
+}
+
+// implements UnaryOperator
+func (co *ComplementOperator) evaluate(x *big.Int, gtype Type) *big.Int {
+	if isUnsigned(gtype) {
+		// all the bits of the type are flipped
+		ones := new(big.Int).Lsh(big.NewInt(1), uint(gtype.size()*8))
+		return new(big.Int).Xor(x, ones.Sub(ones, big.NewInt(1)))
+	}
+	return new(big.Int).Not(x)
+}
+
+/* ===============================
+ * Relational operators implementation
+ * =============================== */
+var negatedConditions = map[string]string{
+	"e": "ne", "ne": "e",
+	"l": "ge", "ge": "l", "le": "g", "g": "le",
+	"b": "ae", "ae": "b", "be": "a", "a": "be",
+}
+
+// compare the floats in %rax and %rbx, or in %rbx and %rax when swapped.
+// ucomis sets the flags like an unsigned comparison, and ZF, PF and CF all
+// when the operands are unordered with a NaN, so that only ne, a and ae are false for them
+func emitFloatComparison(gtype Type, swapped bool) {
+	emitCode("\tmovq\t%%rax, %%xmm0")
+	emitCode("\tmovq\t%%rbx, %%xmm1")
+	if swapped {
+		emitCode("\tucomi%s\t%%xmm0, %%xmm1", floatSuffix(gtype))
+	} else {
+		emitCode("\tucomi%s\t%%xmm1, %%xmm0", floatSuffix(gtype))
+	}
+}
+
+// set %rax to 1 if the condition of a comparison holds, to 0 otherwise.
+// floats are equal only when ordered, and not equal when unordered
+func emitSetCondition(condition string, gtype Type) {
+	emitCode("\tset%s\t%%al", condition)
+	if isFloat(gtype) && condition == "e" {
+		emitCode("\tsetnp\t%%cl")
+		emitCode("\tandb\t%%cl, %%al")
+	} else if isFloat(gtype) && condition == "ne" {
+		emitCode("\tsetp\t%%cl")
+		emitCode("\torb\t%%cl, %%al")
+	}
+	emitCode("\tmovzbl\t%%al, %%eax")
+}
+
+// jump to the label if the condition of a comparison is the same as jumpIf
+func emitJumpCondition(condition string, gtype Type, label string, jumpIf bool) {
+	if !jumpIf {
+		condition = negatedConditions[condition]
+	}
+	if isFloat(gtype) && condition == "e" {
+		unordered := makeLabel()
+		emitCode("\tjp\t%s", unordered)
+		emitCode("\tje\t%s", label)
+		emitLabel(unordered)
+		return
+	}
+	if isFloat(gtype) && condition == "ne" {
+		emitCode("\tjp\t%s", label)
+	}
+	emitCode("\tj%s\t%s", condition, label)
+}
+
+type EqualOperator struct {
+}
+
+// implements RelationalOperator
+func (eo *EqualOperator) emitCompare(gtype Type) string {
+	if isFloat(gtype) {
+		emitFloatComparison(gtype, false)
+	} else {
+		emitBinaryOperation("cmp", gtype)
+	}
+	return "e"
+}
+
+// implements RelationalOperator
+func (eo *EqualOperator) evaluate(cmp int) bool {
+	return cmp == 0
+}
+
+type NotEqualOperator struct {
+}
+
+// implements RelationalOperator
+func (neo *NotEqualOperator) emitCompare(gtype Type) string {
+	if isFloat(gtype) {
+		emitFloatComparison(gtype, false)
+	} else {
+		emitBinaryOperation("cmp", gtype)
+	}
+	return "ne"
+}
+
+// implements RelationalOperator
+func (neo *NotEqualOperator) evaluate(cmp int) bool {
+	return cmp != 0
+}
+
+type LessOperator struct {
+}
+
+// implements RelationalOperator
+func (lo *LessOperator) emitCompare(gtype Type) string {
+	if isFloat(gtype) {
+		emitFloatComparison(gtype, true)
+		return "a"
+	}
+	emitBinaryOperation("cmp", gtype)
+	if isUnsigned(gtype) {
+		return "b"
+	}
+	return "l"
+}
+
+// implements RelationalOperator
+func (lo *LessOperator) evaluate(cmp int) bool {
+	return cmp < 0
+}
+
+type LessEqualOperator struct {
+}
+
+// implements RelationalOperator
+func (leo *LessEqualOperator) emitCompare(gtype Type) string {
+	if isFloat(gtype) {
+		emitFloatComparison(gtype, true)
+		return "ae"
+	}
+	emitBinaryOperation("cmp", gtype)
+	if isUnsigned(gtype) {
+		return "be"
+	}
+	return "le"
+}
+
+// implements RelationalOperator
+func (leo *LessEqualOperator) evaluate(cmp int) bool {
+	return cmp <= 0
+}
+
+type GreaterOperator struct {
+}
+
+// implements RelationalOperator
+func (gto *GreaterOperator) emitCompare(gtype Type) string {
+	if isFloat(gtype) {
+		emitFloatComparison(gtype, false)
+		return "a"
+	}
+	emitBinaryOperation("cmp", gtype)
+	if isUnsigned(gtype) {
+		return "a"
+	}
+	return "g"
+}
+
+// implements RelationalOperator
+func (gto *GreaterOperator) evaluate(cmp int) bool {
+	return cmp > 0
+}
+
+type GreaterEqualOperator struct {
+}
+
+// implements RelationalOperator
+func (geo *GreaterEqualOperator) emitCompare(gtype Type) string {
+	if isFloat(gtype) {
+		emitFloatComparison(gtype, false)
+		return "ae"
+	}
+	emitBinaryOperation("cmp", gtype)
+	if isUnsigned(gtype) {
+		return "ae"
+	}
+	return "ge"
+}
+
+// implements RelationalOperator
+func (geo *GreaterEqualOperator) evaluate(cmp int) bool {
+	return cmp >= 0
 }
@@ -2,12 +2,27 @@ package main
 
 import (
 	"fmt"
-	"strconv"
+	"math/big"
 )
 
 var stringIndex = 0
 var stringList []*AstString
 
+/* jump targets of break and continue, a switch has no continue label */
+type LoopContext struct {
+	name          string
+	breakLabel    string
+	continueLabel string
+}
+
+var loopStack []*LoopContext
+var pendingLabel string
+
+var currentFunction *FunctionDefinition
+
+// the func literals in the program, which are emitted after the other functions
+var funcLiterals []*FunctionDefinition
+
 func parse() Ast {
 	currentScope = globalScope
 	return parseTranslationUnit()
@@ -20,6 +35,7 @@ func parseTranslationUnit() Ast {
 	}
 	packname := parsePackageDeclaration()
 	packages := parseImport()
+	collectDeclarations()
 	var childs []Ast
 
 	for {
@@ -39,6 +55,10 @@ func parseTranslationUnit() Ast {
 		case tok.isKeyword("var"):
 			ast := parseGlobalDeclaration()
 			childs = append(childs, ast)
+		case tok.isKeyword("type"), tok.isKeyword("const"):
+			collected := collectedDeclarations[tStream.index]
+			tStream.index = collected.end
+			childs = append(childs, collected.ast)
 		default:
 			putError("func expected, but got %v.", tok.sval)
 		}
@@ -135,39 +155,101 @@ func parseImportParenthesis() []string {
 }
 
 func parseGlobalDeclaration() Ast {
-	sym := parseDeclarationStatementCommon().(*GlobalVariable)
-	if sym==nil {
-		return &GlobalDeclaration{
-			sym: nil,
+	gd := &GlobalDeclaration{}
+	parseDeclarationGroup("var", func() {
+		names, gtype, exprs := parseVarSpec()
+		if exprs != nil && len(exprs) != len(names) {
+			putErrorAt(names[0], "Assignment mismatch: %d variables but %d values.", len(names), len(exprs))
 		}
-	}
-	tok := lookahead(1)
+		for i, name := range names {
+			if isBlankIdentifier(name) {
+				continue
+			}
+			sym := makeSymbol(name, gtype).(*GlobalVariable)
+			if exprs != nil {
+				sym.init = exprs[i]
+			}
+			gd.syms = append(gd.syms, sym)
+		}
+	})
+	return gd
+}
 
-	initstr := "0"
-	if tok.isPunct("=") {
-		consumeToken("=")
-		tok2 := lookahead(1)
-		initstr = tok2.sval
-		nextToken()
-	}
-	consumeToken(";")
+// the value of iota in a constant declaration, or -1
+var currentIota = -1
 
-	var initval Constant
-	switch sym.gtype {
-	case "int":
-		ival, _ := strconv.Atoi(initstr)
-		initval = &IntegerConstant{
-			ival: ival,
+// const ( A T = iota; B; C ), where a spec without values repeats the type and the values
+// of the previous one, parsed again with its own iota. the constants are checked as they are
+// parsed, so that their values are known to the constant expressions which follow
+func parseConstDeclaration() Ast {
+	cd := &ConstDeclaration{}
+	repeated := -1 // the index of the type and the values to repeat
+	currentIota = 0
+	parseDeclarationGroup("const", func() {
+		names := parseIdentifierList()
+		if tok := lookahead(1); tok.isSemicolon() || tok.isPunct(")") {
+			if repeated < 0 {
+				putErrorAt(names[0], "Missing init expr for const declaration.")
+			}
+			end := tStream.index
+			tStream.index = repeated
+			cd.syms = append(cd.syms, parseConstSpec(names)...)
+			tStream.index = end
+		} else {
+			repeated = tStream.index
+			cd.syms = append(cd.syms, parseConstSpec(names)...)
 		}
-	default:
-		putError("Acceptable global variable is int, but got %s", sym.gtype)
+		currentIota++
+	})
+	currentIota = -1
+	return cd
+}
+
+// [Type] = ExpressionList
+func parseConstSpec(names []*Token) []*NamedConstant {
+	var gtype Type
+	if isTypeStart(lookahead(1)) {
+		gtype = parseType()
+	}
+	consumeToken("=")
+	exprs := parseExpressionList()
+	if len(exprs) < len(names) {
+		putErrorAt(names[0], "Missing init expr for const declaration.")
+	}
+	if len(exprs) > len(names) {
+		putErrorAt(names[0], "Extra init expr.")
+	}
+	var syms []*NamedConstant
+	for i, name := range names {
+		// the constant is declared after its value, which cannot refer to it
+		nc := &NamedConstant{
+			expr: exprs[i],
+			SymbolBase: SymbolBase{
+				name:  name.sval,
+				gtype: gtype,
+			},
+		}
+		checkNamedConstant(name, nc)
+		syms = append(syms, nc)
 	}
-	sym.initval = initval
-	return &GlobalDeclaration{
-		sym: sym,
+	for i, nc := range syms {
+		if nc.name != "_" {
+			declareSymbol(names[i], nc)
+		}
 	}
+	return syms
 }
 
+// an unnamed or blank parameter is not declared
+func declareParameter(param *Parameter) *LocalVariable {
+	if param.name == "" || param.name == "_" {
+		return &LocalVariable{
+			function:   currentFunction,
+			SymbolBase: SymbolBase{gtype: param.gtype},
+		}
+	}
+	return makeSymbol(param.tok, param.gtype).(*LocalVariable)
+}
 
 func parseFunctionDefinition() Ast {
 	tok := lookahead(1)
@@ -176,89 +258,623 @@ func parseFunctionDefinition() Ast {
 		return nil
 	}
 	consumeToken("func")
-	beginFunction()
-	tok = lookahead(1)
+	sig := parseFunctionSignature()
+	fd := parseFunctionBody(sig)
+	consumeSemicolon()
+	return fd
+}
+
+// the parameters and the named results are declared in the scope of the body.
+// a func literal is parsed in the middle of the enclosing function, which is restored
+func parseFunctionBody(sig *FunctionSignature) *FunctionDefinition {
+	fd := &FunctionDefinition{
+		fname:       sig.label(),
+		sig:         sig,
+		returnLabel: makeLabel(),
+		outer:       currentFunction,
+	}
+	savedLoops := loopStack
+	loopStack = nil
+	currentFunction = fd
+	beginSymbolBlock()
+	if sig.receiver != nil {
+		// passed as the first argument
+		fd.params = append(fd.params, declareParameter(sig.receiver))
+	}
+	for _, param := range sig.params {
+		fd.params = append(fd.params, declareParameter(param))
+	}
+	for _, result := range sig.results {
+		if result.name != "" {
+			sym := makeSymbol(result.tok, result.gtype).(*LocalVariable)
+			fd.namedResults = append(fd.namedResults, sym)
+		}
+	}
+
+	tok3 := lookahead(1)
+	if !tok3.isPunct("{") {
+		putError("Expected {, but got %s", tok3.sval)
+	}
+	// the outermost block of the body is the block of the parameters
+	fd.ast = parseStatementList()
+	endSymbolBlock()
+	currentFunction = fd.outer
+	loopStack = savedLoops
+	return fd
+}
+
+// the receiver of a method is in the parentheses before the name
+func parseFunctionSignature() *FunctionSignature {
+	var receiver *Parameter
+	if tok := lookahead(1); tok.isPunct("(") {
+		receivers := parseParameterList()
+		if len(receivers) != 1 {
+			putErrorAt(tok, "Method has %d receivers.", len(receivers))
+		}
+		receiver = receivers[0]
+		if namedOf(receiver.gtype) == nil {
+			putErrorAt(tok, "Invalid receiver type %s.", receiver.gtype)
+		}
+	}
+	tok := lookahead(1)
 	if !tok.isTypeIdentifier() {
 		putError("Expected identifier, but got %s", tok.typ)
 		return nil
 	}
 	nextToken()
-	consumeToken("(")
+	params := parseParameterList()
+	results := parseResultList()
+	if len(results) > len(retRegs) {
+		putErrorAt(tok, "Too many results in %s.", tok.sval)
+	}
+	return &FunctionSignature{
+		fname:    tok.sval,
+		tok:      tok,
+		receiver: receiver,
+		params:   params,
+		results:  results,
+	}
+}
 
-	beginSymbolBlock()
+// the results are in parentheses, or a single type
+func parseResultList() []*Parameter {
+	tok := lookahead(1)
+	switch {
+	case tok.isPunct("("):
+		return parseParameterList()
+	case isTypeStart(tok):
+		return []*Parameter{&Parameter{gtype: parseType()}}
+	}
+	return nil
+}
+
+// func(int, string) bool, the names of the parameters are ignored
+func parseFuncType() Type {
+	consumeToken("func")
+	ft := &FuncType{}
+	for _, param := range parseParameterList() {
+		ft.params = append(ft.params, param.gtype)
+	}
+	for _, result := range parseResultList() {
+		ft.results = append(ft.results, result.gtype)
+	}
+	return ft
+}
+
+// func(x int) int { ... } is named after the enclosing function like main.func1,
+// and emitted after it
+func parseFuncLiteral() Ast {
+	tok := lookahead(1)
+	consumeToken("func")
+	outer := currentFunction
+	outer.literals++
+	sig := &FunctionSignature{
+		fname:   fmt.Sprintf("%s.func%d", outer.fname, outer.literals),
+		tok:     tok,
+		params:  parseParameterList(),
+		results: parseResultList(),
+	}
+	if len(sig.results) > len(retRegs) {
+		putErrorAt(tok, "Too many results in func literal.")
+	}
+	fd := parseFunctionBody(sig)
+	funcLiterals = append(funcLiterals, fd)
+	return &FuncLiteral{
+		ExpressionBase: ExpressionBase{tok: tok},
+		fd:             fd,
+	}
+}
 
-PARSE_ARGUMENT_LIST_LOOP:
+// the symbol of a variable in the function, which is captured from the enclosing functions
+// when it is declared in one of them. the captured variable is moved to the heap,
+// and its address is passed through the closures
+func (fd *FunctionDefinition) capture(lv *LocalVariable) Symbol {
+	if lv.function == fd {
+		return lv
+	}
+	for _, cv := range fd.captures {
+		if cv.variable == lv {
+			return cv
+		}
+	}
+	lv.escapes = true
+	cv := &CapturedVariable{
+		variable: lv,
+		outer:    fd.outer.capture(lv),
+		function: fd,
+		index:    len(fd.captures),
+	}
+	fd.captures = append(fd.captures, cv)
+	return cv
+}
+
+// parses both "(a, b int, c string)" and "(int, string)"
+func parseParameterList() []*Parameter {
+	consumeToken("(")
+	var entries []*Parameter
+	var idents []*Token
+	named := false
 	for {
 		tok := lookahead(1)
-		switch {
-		case tok.isPunct(")"):
-			break PARSE_ARGUMENT_LIST_LOOP
-		case tok.isTypeIdentifier():
+		if tok.isPunct(")") {
+			break
+		}
+		if tok.isTypeIdentifier() && isTypeStart(lookahead(2)) {
+			// name Type
 			nextToken()
-			tok2 := lookahead(1)
-			makeSymbol(tok.sval, tok2.sval)
+			entries = append(entries, &Parameter{name: tok.sval, tok: tok, gtype: parseType()})
+			idents = append(idents, tok)
+			named = true
+		} else if tok.isTypeIdentifier() {
+			// either a name or a type name
 			nextToken()
-			tok3 := lookahead(1)
-			if tok3.isPunct(",") {
-				consumeToken(",")
-				continue
-			} else if tok3.isPunct(")") {
-				break PARSE_ARGUMENT_LIST_LOOP
-			} else {
-				putError("Expected ) or \",\", but got %s.", tok3.sval)
+			entries = append(entries, &Parameter{})
+			idents = append(idents, tok)
+		} else {
+			entries = append(entries, &Parameter{gtype: parseType()})
+			idents = append(idents, nil)
+		}
+		tok3 := lookahead(1)
+		if tok3.isPunct(",") {
+			consumeToken(",")
+		} else if !tok3.isPunct(")") {
+			putErrorAt(tok3, "Expected ) or \",\", but got %s.", tok3.sval)
+		}
+	}
+	consumeToken(")")
+	if !named {
+		for i, entry := range entries {
+			if entry.gtype == nil {
+				entry.gtype = resolveTypeName(idents[i])
 			}
-		default:
-			putError("Expected ) or identifier, but got %s.", tok.sval)
 		}
+		return entries
 	}
 
-	consumeToken(")")
-	// expect Type
-	tok2 := lookahead(1)
-	var rettype string
-	if tok2.isTypeIdentifier() {
-		rettype = tok2.sval
+	// names without a type share the type that follows them
+	var params []*Parameter
+	var pending []*Token
+	for i, entry := range entries {
+		if idents[i] == nil {
+			putError("Mixed named and unnamed parameters.")
+		}
+		if entry.gtype == nil {
+			pending = append(pending, idents[i])
+			continue
+		}
+		for _, name := range pending {
+			params = append(params, &Parameter{name: name.sval, tok: name, gtype: entry.gtype})
+		}
+		pending = nil
+		params = append(params, entry)
+	}
+	if len(pending) > 0 {
+		putErrorAt(pending[0], "Missing type for parameter %s.", pending[0].sval)
+	}
+	return params
+}
+
+func isTypeStart(tok *Token) bool {
+	return tok.isTypeIdentifier() || tok.isPunct("*") || tok.isPunct("[") || tok.isKeyword("struct") ||
+		tok.isKeyword("interface") || tok.isKeyword("map") || tok.isKeyword("func")
+}
+
+func parseType() Type {
+	tok := lookahead(1)
+	switch {
+	case tok.isTypeIdentifier():
 		nextToken()
+		return resolveTypeName(tok)
+	case tok.isPunct("*"):
+		consumeToken("*")
+		return &PointerType{elem: parseType()}
+	case tok.isKeyword("struct"):
+		return parseStructType()
+	case tok.isKeyword("interface"):
+		return parseInterfaceType()
+	case tok.isKeyword("func"):
+		return parseFuncType()
+	case tok.isKeyword("map"):
+		consumeToken("map")
+		consumeToken("[")
+		key := parseType()
+		consumeToken("]")
+		return &MapType{key: key, elem: parseType()}
+	case tok.isPunct("[") && lookahead(2).isPunct("]"):
+		consumeToken("[")
+		consumeToken("]")
+		return &SliceType{elem: parseType()}
+	case tok.isPunct("["):
+		consumeToken("[")
+		length := parseArrayLength()
+		consumeToken("]")
+		return &ArrayType{elem: parseType(), length: length}
+	default:
+		putErrorAt(tok, "Expected type, but got %s.", tok.sval)
+	}
+	return nil
+}
+
+// struct { a, b T; E; *P }, where E and P are embedded
+func parseStructType() Type {
+	consumeToken("struct")
+	consumeToken("{")
+	var fields []*Field
+	names := make(map[string]bool)
+	addField := func(tok *Token, field *Field) {
+		if names[field.name] {
+			putErrorAt(tok, "Duplicate field %s.", field.name)
+		}
+		if field.name != "_" {
+			names[field.name] = true
+		}
+		fields = append(fields, field)
+	}
+	for !lookahead(1).isPunct("}") {
+		tok := lookahead(1)
+		if tok.isPunct("*") || tok.isTypeIdentifier() && (lookahead(2).isSemicolon() || lookahead(2).isPunct("}")) {
+			name := tok
+			if tok.isPunct("*") {
+				name = lookahead(2)
+			}
+			addField(name, &Field{name: name.sval, gtype: parseType(), embedded: true})
+			consumeSemicolon()
+			continue
+		}
+		var idents []*Token
+		for {
+			ident := lookahead(1)
+			if !ident.isTypeIdentifier() {
+				putErrorAt(ident, "Expected field name, but got %s.", ident.sval)
+			}
+			nextToken()
+			idents = append(idents, ident)
+			if !lookahead(1).isPunct(",") {
+				break
+			}
+			consumeToken(",")
+		}
+		gtype := parseType()
+		for _, ident := range idents {
+			addField(ident, &Field{name: ident.sval, gtype: gtype})
+		}
+		consumeSemicolon()
+	}
+	consumeToken("}")
+	return newStructType(fields)
+}
+
+// interface { M(T) R; E }, where E is embedded
+func parseInterfaceType() Type {
+	consumeToken("interface")
+	consumeToken("{")
+	it := &InterfaceType{}
+	names := make(map[string]bool)
+	for !lookahead(1).isPunct("}") {
+		tok := lookahead(1)
+		if !tok.isTypeIdentifier() {
+			putErrorAt(tok, "Expected method name, but got %s.", tok.sval)
+		}
+		if !lookahead(2).isPunct("(") {
+			it.embedded = append(it.embedded, parseType())
+			consumeSemicolon()
+			continue
+		}
+		sig := parseFunctionSignature()
+		if names[sig.fname] {
+			putErrorAt(tok, "Duplicate method %s.", sig.fname)
+		}
+		names[sig.fname] = true
+		it.declared = append(it.declared, &Method{name: sig.fname, gtype: sig.funcType()})
+		consumeSemicolon()
+	}
+	consumeToken("}")
+	return it
+}
+
+// the length is a constant expression, which is checked as the type is parsed
+func parseArrayLength() int {
+	tok := lookahead(1)
+	length := parseExpression()
+	if !isInteger(checkExpression(length)) {
+		putErrorAt(tok, "Non-integer array length of type %s.", length.(Expression).getType())
+	}
+	value := integerValueOf(constantOf(length))
+	if value == nil {
+		putErrorAt(tok, "Array length %s is not constant.", tok.sval)
+	}
+	if value.Sign() < 0 || !value.IsInt64() {
+		putErrorAt(tok, "Invalid array length %s.", value)
+	}
+	return int(value.Int64())
+}
+
+// the length of [...]T is the number of the elements,
+// a type followed by a parenthesis is a conversion like []byte(s)
+func parseCompositeLiteral() Ast {
+	tok := lookahead(1)
+	var gtype Type
+	if tok.isPunct("[") && lookahead(2).isPunct("...") {
+		consumeToken("[")
+		consumeToken("...")
+		consumeToken("]")
+		gtype = &ArrayType{elem: parseType(), length: -1}
 	} else {
-		rettype = "void"
+		gtype = parseType()
+		if lookahead(1).isPunct("(") {
+			return parseConversion(gtype, tok)
+		}
 	}
-	tok3 := lookahead(1)
-	if !tok3.isPunct("{") {
-		putError("Expected {, but got %s", tok3.sval)
+	return parseCompositeLiteralBody(gtype, tok)
+}
+
+// the elements in the braces, keyed by the field names of a struct or by the keys of a map.
+// the type of an element or a key may be elided when it is a composite literal, or a pointer to one
+func parseCompositeLiteralBody(gtype Type, tok *Token) Ast {
+	consumeToken("{")
+	cl := &CompositeLiteral{
+		ExpressionBase: ExpressionBase{tok: tok},
+		literalType:    gtype,
+	}
+	mt := mapOf(gtype)
+	for !lookahead(1).isPunct("}") {
+		key := ""
+		if mt != nil {
+			cl.mapKeys = append(cl.mapKeys, parseElement(mt.key))
+			consumeToken(":")
+		} else if lookahead(1).isTypeIdentifier() && lookahead(2).isPunct(":") {
+			key = lookahead(1).sval
+			nextToken()
+			consumeToken(":")
+		}
+		elem := parseElement(elementTypeOf(gtype, key, len(cl.elems)))
+		cl.keys = append(cl.keys, key)
+		cl.elems = append(cl.elems, elem)
+		if !lookahead(1).isPunct(",") {
+			break
+		}
+		consumeToken(",")
+	}
+	consumeToken("}")
+	if at, ok := gtype.(*ArrayType); ok && at.length < 0 {
+		at.length = len(cl.elems)
+	}
+	return cl
+}
+
+// an element of a composite literal, of the type when it is elided
+func parseElement(elemType Type) Ast {
+	elemTok := lookahead(1)
+	if !elemTok.isPunct("{") {
+		return parseExpression()
+	}
+	if elemType == nil {
+		putErrorAt(elemTok, "Missing type in composite literal.")
+	}
+	if pt, ok := elemType.underlying().(*PointerType); ok {
+		return &AddressExpression{
+			ExpressionBase: ExpressionBase{tok: elemTok},
+			operand:        parseCompositeLiteralBody(pt.elem, elemTok).(LeftValue),
+		}
+	}
+	return parseCompositeLiteralBody(elemType, elemTok)
+}
+
+// the type of an element of a composite literal, or nil
+func elementTypeOf(gtype Type, key string, index int) Type {
+	if mt := mapOf(gtype); mt != nil {
+		return mt.elem
+	}
+	st, ok := gtype.underlying().(*StructType)
+	if !ok {
+		return elementOf(gtype)
+	}
+	for i, field := range st.fields {
+		if key == field.name || key == "" && i == index {
+			return field.gtype
+		}
+	}
+	return nil
+}
+
+// T(x), the type has been parsed
+func parseConversion(gtype Type, tok *Token) Ast {
+	consumeToken("(")
+	operand := parseExpression()
+	if lookahead(1).isPunct(",") {
+		consumeToken(",")
+	}
+	consumeToken(")")
+	return &ConversionExpression{
+		ExpressionBase: ExpressionBase{tok: tok},
+		toType:         gtype,
+		operand:        operand,
+	}
+}
+
+func resolveTypeName(tok *Token) Type {
+	gtype := lookupType(tok.sval)
+	if gtype == nil && collecting {
+		// declared later in the file
+		nt := &NamedType{name: tok.sval}
+		globalScope.types[tok.sval] = nt
+		forwardTypes[tok.sval] = tok
+		return nt
+	}
+	if gtype == nil {
+		putErrorAt(tok, "Undefined type %s.", tok.sval)
+	}
+	return gtype
+}
+
+// the top-level type and constant declarations are parsed with the signatures,
+// the types referred to before their declarations are kept with the tokens
+var collecting bool
+var forwardTypes = make(map[string]*Token)
+
+type collectedDeclaration struct {
+	ast Ast
+	end int // the index of the token after the declaration
+}
+
+// by the index of the first token
+var collectedDeclarations = make(map[int]*collectedDeclaration)
+
+func parseTypeDeclaration() *TypeDeclaration {
+	td := &TypeDeclaration{}
+	parseDeclarationGroup("type", func() {
+		tok := lookahead(1)
+		if !tok.isTypeIdentifier() {
+			putErrorAt(tok, "Expected type name, but got %s.", tok.sval)
+		}
+		nextToken()
+		if lookahead(1).isPunct("=") {
+			// an alias denotes the type itself, and is declared after it
+			consumeToken("=")
+			declareAlias(tok, parseType())
+			return
+		}
+		// declared before its base, which may refer to it
+		nt := declareType(tok)
+		nt.base = parseType()
+		td.types = append(td.types, nt)
+	})
+	return td
+}
+
+func declareType(tok *Token) *NamedType {
+	if currentScope.symenv[tok.sval] != nil {
+		putErrorAt(tok, "%s redeclared in this block.", tok.sval)
+	}
+	if t := currentScope.types[tok.sval]; t != nil {
+		if _, forward := forwardTypes[tok.sval]; !forward || currentScope != globalScope {
+			putErrorAt(tok, "%s redeclared in this block.", tok.sval)
+		}
+		delete(forwardTypes, tok.sval)
+		return t.(*NamedType)
+	}
+	nt := &NamedType{name: tok.sval}
+	currentScope.types[tok.sval] = nt
+	return nt
+}
+
+func declareAlias(tok *Token, gtype Type) {
+	if _, forward := forwardTypes[tok.sval]; forward && currentScope == globalScope {
+		putErrorAt(tok, "Alias %s is used before its declaration.", tok.sval)
+	}
+	if currentScope.symenv[tok.sval] != nil || currentScope.types[tok.sval] != nil {
+		putErrorAt(tok, "%s redeclared in this block.", tok.sval)
+	}
+	currentScope.types[tok.sval] = gtype
+}
+
+func declareMethod(sig *FunctionSignature) {
+	nt := namedOf(sig.receiver.gtype)
+	if nt.methods == nil {
+		nt.methods = make(map[string]*FunctionSignature)
+	}
+	if nt.methods[sig.fname] != nil {
+		putErrorAt(sig.tok, "Method %s redeclared.", sig.label())
+	}
+	nt.methods[sig.fname] = sig
+}
+
+// collect the top-level types, constants and the signatures of all functions before parsing their bodies,
+// so that they can be used before their declarations
+func collectDeclarations() {
+	start := tStream.index
+	depth := 0
+	// func starts a declaration only at the beginning of a top-level line,
+	// elsewhere it is a func type or a func literal
+	lineStart := true
+	collecting = true
+	for tok := lookahead(1); !tok.isEOF(); tok = lookahead(1) {
+		switch {
+		case depth == 0 && (tok.isKeyword("type") || tok.isKeyword("const")):
+			index := tStream.index
+			var ast Ast
+			if tok.isKeyword("type") {
+				ast = parseTypeDeclaration()
+			} else {
+				ast = parseConstDeclaration()
+			}
+			collectedDeclarations[index] = &collectedDeclaration{
+				ast: ast,
+				end: tStream.index,
+			}
+			continue
+		case depth == 0 && lineStart && tok.isKeyword("func"):
+			consumeToken("func")
+			sig := parseFunctionSignature()
+			if sig.receiver != nil {
+				declareMethod(sig)
+				continue
+			}
+			if findFunction(sig.fname) != nil {
+				putErrorAt(sig.tok, "Function %s redeclared.", sig.fname)
+			}
+			functionTable[sig.fname] = sig
+			continue
+		case tok.isPunct("{"):
+			depth++
+		case tok.isPunct("}"):
+			depth--
+		}
+		lineStart = tok.isPunct(";")
+		nextToken()
 	}
-	ast := parseCompoundStatement()
-	params := endSymbolBlock()
-	space := endFunction()
-	return &FunctionDefinition{
-		fname:   tok.sval,
-		rettype: rettype,
-		params:  params,
-		ast:     ast,
-		space:   space,
+	for name, tok := range forwardTypes {
+		putErrorAt(tok, "Undefined type %s.", name)
 	}
+	collecting = false
+	tStream.index = start
 }
 
 func parseCompoundStatement() Ast {
+	beginSymbolBlock()
+	cs := parseStatementList()
+	endSymbolBlock()
+	return cs
+}
+
+// the statements in braces, declared in the current block
+func parseStatementList() *CompoundStatement {
 	var statements []Ast
 	consumeToken("{")
-	beginSymbolBlock()
 	for {
 		tok := lookahead(1)
 		switch {
 		case tok.isPunct("}"):
 			consumeToken("}")
-			consumeToken(";")
-			localvars := endSymbolBlock()
 			return &CompoundStatement{
 				statements: statements,
-				localvars:  localvars,
+				end:        tok,
 			}
 		default:
 			var ast Ast = parseStatement()
 			statements = append(statements, ast)
 		}
 	}
-	return parseStatement()
 }
 
 func parseStatement() Ast {
@@ -268,18 +884,43 @@ func parseStatement() Ast {
 	switch {
 	case tok.isPunct("{"):
 		ast = parseCompoundStatement()
+		consumeSemicolon()
 	case tok.isKeyword("var"):
 		ast = parseDeclarationStatement()
-	default:
-		ast = parseExpression()
-		tok2 := lookahead(1)
-		switch {
-		case tok2.isPunct("="):
-			ast = parseAssignmentExpressionRightHand(ast)
-			consumeToken(";")
-		default:
-			consumeToken(";")
+	case tok.isKeyword("type"):
+		ast = parseTypeDeclaration()
+	case tok.isKeyword("const"):
+		ast = parseConstDeclaration()
+	case tok.isKeyword("if"):
+		ast = parseIfStatement()
+		consumeSemicolon()
+	case tok.isKeyword("for"):
+		ast = parseForStatement()
+		consumeSemicolon()
+	case tok.isKeyword("switch"):
+		ast = parseSwitchStatement()
+		consumeSemicolon()
+	case tok.isKeyword("return"):
+		ast = parseReturnStatement()
+		consumeSemicolon()
+	case tok.isKeyword("break"):
+		ast = parseBreakStatement()
+		consumeSemicolon()
+	case tok.isKeyword("continue"):
+		ast = parseContinueStatement()
+		consumeSemicolon()
+	case tok.isKeyword("fallthrough"):
+		putErrorAt(tok, "fallthrough statement out of place.")
+	case tok.isTypeIdentifier() && lookahead(2).isPunct(":"):
+		nextToken()
+		consumeToken(":")
+		if lookahead(1).isKeyword("for") || lookahead(1).isKeyword("switch") {
+			pendingLabel = tok.sval
 		}
+		return parseStatement()
+	default:
+		ast = parseSimpleStatement()
+		consumeSemicolon()
 	}
 
 	return &Statement{
@@ -287,73 +928,678 @@ func parseStatement() Ast {
 	}
 }
 
-func parseDeclarationStatementCommon() Symbol {
-
-	tok := lookahead(1)
-	switch {
-	case tok.isEOF():
-		return nil
-	case tok.isKeyword("var"):
-		consumeToken("var")
-		tok2 := lookahead(1)
-		if !tok2.isTypeIdentifier() {
-			putError("Expected identifier, but got %s.", tok2.sval)
-			return nil
-		}
-		nextToken()
-
-		tok3 := lookahead(1)
-		if !tok3.isTypeIdentifier() {
-			putError("Expected type, but got %s.", tok3.sval)
-			return nil
+func parseSimpleStatement() Ast {
+	if isShortVariableDeclaration() {
+		return parseShortVariableDeclaration()
+	}
+	lefts := parseExpressionListOrBlank()
+	if len(lefts) == 1 && lefts[0] != nil {
+		return &ExpressionStatement{
+			expr: parseAssignmentExpressionRightHand(lefts[0]),
 		}
-		sym := makeSymbol(tok2.sval, tok3.sval)
-		nextToken()
-		return sym
-	default:
-		putError("Expected var, but got %s.", tok.sval)
-		return nil
 	}
-	return nil
-}
 
-func parseDeclarationStatement() Ast {
-	sym := parseDeclarationStatementCommon().(*LocalVariable)
-	tok := lookahead(1)
-	if tok.isPunct("=") {
-		id := &Identifier{
-			symbol: sym,
+	consumeToken("=")
+	rights := parseExpressionList()
+	var lvs []LeftValue
+	for _, left := range lefts {
+		if left == nil {
+			lvs = append(lvs, nil)
+			continue
 		}
-		ast := parseAssignmentExpressionRightHand(id)
-		consumeToken(";")
-		return &DeclarationStatement{
-			sym:    sym,
-			assign: ast,
+		lv, ok := left.(LeftValue)
+		if !ok {
+			putError("Cannot assign to %T.", left)
 		}
+		lvs = append(lvs, lv)
 	}
-	consumeToken(";")
-	return &DeclarationStatement{
-		sym:    sym,
-		assign: nil,
+	return &MultipleAssignmentStatement{
+		lefts:  lvs,
+		rights: rights,
 	}
 }
 
-func parseAssignmentExpressionRightHand(ast Ast) Ast {
+func isBlankIdentifier(tok *Token) bool {
+	return tok.isIdentifier("_")
+}
+
+// an identifier list followed by ":="
+func isShortVariableDeclaration() bool {
+	for i := 1; ; i += 2 {
+		if !lookahead(i).isTypeIdentifier() {
+			return false
+		}
+		tok := lookahead(i + 1)
+		switch {
+		case tok.isPunct(":="):
+			return true
+		case !tok.isPunct(","):
+			return false
+		}
+	}
+}
+
+func parseShortVariableDeclaration() Ast {
+	var names []*Token
+	for {
+		names = append(names, lookahead(1))
+		nextToken()
+		if !lookahead(1).isPunct(",") {
+			break
+		}
+		consumeToken(",")
+	}
+	tok := lookahead(1)
+	consumeToken(":=")
+	rights := parseExpressionList()
+
+	ds := &DeclarationStatement{}
+	var lefts []LeftValue
+	for i, name := range names {
+		if isBlankIdentifier(name) {
+			lefts = append(lefts, nil)
+			continue
+		}
+		for _, previous := range names[:i] {
+			if previous.sval == name.sval {
+				putErrorAt(name, "%s repeated on left side of :=.", name.sval)
+			}
+		}
+		sym := currentScope.symenv[name.sval]
+		if sym == nil {
+			// the type is inferred by the type checker
+			sym = makeSymbol(name, nil)
+			ds.syms = append(ds.syms, sym.(*LocalVariable))
+		}
+		lefts = append(lefts, &Identifier{
+			ExpressionBase: ExpressionBase{
+				tok: name,
+			},
+			symbol: sym,
+		})
+	}
+	if len(ds.syms) == 0 {
+		putErrorAt(tok, "No new variables on left side of :=.")
+	}
+	ds.assigns = []Ast{&MultipleAssignmentStatement{
+		lefts:  lefts,
+		rights: rights,
+	}}
+	return ds
+}
+
+func parseExpressionListOrBlank() []Ast {
+	var r []Ast
+	for {
+		if isBlankIdentifier(lookahead(1)) {
+			nextToken()
+			r = append(r, nil)
+		} else {
+			r = append(r, parseExpression())
+		}
+		if !lookahead(1).isPunct(",") {
+			return r
+		}
+		consumeToken(",")
+	}
+}
+
+func parseExpressionList() []Ast {
+	var r []Ast
+	for {
+		r = append(r, parseExpression())
+		if !lookahead(1).isPunct(",") {
+			return r
+		}
+		consumeToken(",")
+	}
+}
+
+// unwrap the condition parsed as a simple statement in if and for headers
+func conditionOf(ast Ast) Ast {
+	es, ok := ast.(*ExpressionStatement)
+	if !ok {
+		putError("Expected condition, but got a statement.")
+	}
+	if _, ok := es.expr.(*AssignmentExpression); ok {
+		putError("Cannot use assignment as a condition.")
+	}
+	return es.expr
+}
+
+func parseReturnStatement() Ast {
+	tok := lookahead(1)
+	consumeToken("return")
+	var exprs []Ast
+	tok2 := lookahead(1)
+	if !tok2.isSemicolon() && !tok2.isPunct("}") {
+		exprs = parseExpressionList()
+	}
+
+	if len(exprs) == 0 && len(currentFunction.namedResults) > 0 {
+		// bare return of named results
+		for _, sym := range currentFunction.namedResults {
+			exprs = append(exprs, &Identifier{
+				symbol: sym,
+			})
+		}
+	}
+	return &ReturnStatement{
+		tok:         tok,
+		exprs:       exprs,
+		sig:         currentFunction.sig,
+		returnLabel: currentFunction.returnLabel,
+	}
+}
+
+func parseIfStatement() Ast {
+	consumeToken("if")
+	beginSymbolBlock()
+	var init Ast
+	cond := parseSimpleStatement()
+	if lookahead(1).isSemicolon() {
+		consumeToken(";")
+		init = cond
+		cond = parseExpression()
+	} else {
+		cond = conditionOf(cond)
+	}
+	tok := lookahead(1)
+	if !tok.isPunct("{") {
+		putError("Expected {, but got %s", tok.sval)
+	}
+	then := parseCompoundStatement()
+
+	var els Ast
+	if lookahead(1).isKeyword("else") {
+		consumeToken("else")
+		tok = lookahead(1)
+		switch {
+		case tok.isKeyword("if"):
+			els = parseIfStatement()
+		case tok.isPunct("{"):
+			els = parseCompoundStatement()
+		default:
+			putError("Expected if or {, but got %s", tok.sval)
+		}
+	}
+	endSymbolBlock()
+	return &IfStatement{
+		init: init,
+		cond: cond,
+		then: then,
+		els:  els,
+	}
+}
+
+// switch init; tag { case x, y: ... fallthrough default: ... },
+// or a type switch when the tag is a type guard
+func parseSwitchStatement() Ast {
+	tok := lookahead(1)
+	consumeToken("switch")
+	beginSymbolBlock()
+	var init Ast
+	if hasSwitchInit() {
+		init = parseSimpleStatement()
+		consumeToken(";")
+	}
+	var binding *Token
+	if lookahead(1).isTypeIdentifier() && lookahead(2).isPunct(":=") {
+		binding = lookahead(1)
+		nextToken()
+		consumeToken(":=")
+	}
+	var tag Ast
+	if binding != nil || !lookahead(1).isPunct("{") {
+		tag = parseExpression()
+	}
+	breakLabel := makeLabel()
+	loopStack = append(loopStack, &LoopContext{
+		name:       pendingLabel,
+		breakLabel: breakLabel,
+	})
+	pendingLabel = ""
+	var ast Ast
+	if guard, ok := tag.(*TypeAssertExpression); ok && guard.assertType == nil {
+		ast = parseTypeSwitchBody(&TypeSwitchStatement{
+			tok:        tok,
+			init:       init,
+			subject:    guard.operand,
+			breakLabel: breakLabel,
+		}, binding)
+	} else {
+		if binding != nil {
+			putErrorAt(binding, "%s := %s used as value.", binding.sval, tag.(Expression).getTok().sval)
+		}
+		ast = parseExpressionSwitchBody(&ExpressionSwitchStatement{
+			tok:        tok,
+			init:       init,
+			tag:        tag,
+			breakLabel: breakLabel,
+		})
+	}
+	loopStack = loopStack[:len(loopStack)-1]
+	endSymbolBlock()
+	return ast
+}
+
+// a fallthrough ends the statements of a clause other than the last
+func parseExpressionSwitchBody(ss *ExpressionSwitchStatement) Ast {
+	consumeToken("{")
+	for !lookahead(1).isPunct("}") {
+		clause := &SwitchClause{
+			tok: lookahead(1),
+		}
+		if lookahead(1).isKeyword("default") {
+			consumeToken("default")
+			clause.isDefault = true
+		} else {
+			consumeToken("case")
+			clause.exprs = parseExpressionList()
+		}
+		consumeToken(":")
+		beginSymbolBlock()
+		for !isCaseEnd(lookahead(1)) {
+			if tok := lookahead(1); tok.isKeyword("fallthrough") {
+				nextToken()
+				consumeSemicolon()
+				if lookahead(1).isPunct("}") {
+					putErrorAt(tok, "Cannot fallthrough final case in switch.")
+				}
+				if !isCaseEnd(lookahead(1)) {
+					putErrorAt(tok, "fallthrough statement out of place.")
+				}
+				clause.fallsThrough = true
+				break
+			}
+			clause.statements = append(clause.statements, parseStatement())
+		}
+		endSymbolBlock()
+		ss.clauses = append(ss.clauses, clause)
+	}
+	consumeToken("}")
+	return ss
+}
+
+// v := x.(type) declares v in each clause
+func parseTypeSwitchBody(ts *TypeSwitchStatement, binding *Token) Ast {
+	consumeToken("{")
+	for !lookahead(1).isPunct("}") {
+		clause := &TypeSwitchClause{
+			tok: lookahead(1),
+		}
+		if lookahead(1).isKeyword("default") {
+			consumeToken("default")
+			clause.isDefault = true
+		} else {
+			consumeToken("case")
+			for {
+				if isNilIdentifier(lookahead(1)) {
+					// the case of a nil interface
+					nextToken()
+					clause.types = append(clause.types, nil)
+				} else {
+					clause.types = append(clause.types, parseType())
+				}
+				if !lookahead(1).isPunct(",") {
+					break
+				}
+				consumeToken(",")
+			}
+		}
+		consumeToken(":")
+		beginSymbolBlock()
+		if binding != nil {
+			// the type is of the case, or of x
+			clause.symbol = makeSymbol(binding, nil).(*LocalVariable)
+		}
+		for !isCaseEnd(lookahead(1)) {
+			clause.statements = append(clause.statements, parseStatement())
+		}
+		endSymbolBlock()
+		ts.clauses = append(ts.clauses, clause)
+	}
+	consumeToken("}")
+	return ts
+}
+
+// whether a semicolon comes before the block of a switch
+func hasSwitchInit() bool {
+	depth := 0
+	for i := 1; ; i++ {
+		tok := lookahead(i)
+		switch {
+		case tok.isEOF():
+			return false
+		case tok.isPunct("("), tok.isPunct("["):
+			depth++
+		case tok.isPunct(")"), tok.isPunct("]"):
+			depth--
+		case depth == 0 && tok.isPunct("{"):
+			return false
+		case depth == 0 && tok.isSemicolon():
+			return true
+		}
+	}
+}
+
+func isCaseEnd(tok *Token) bool {
+	return tok.isKeyword("case") || tok.isKeyword("default") || tok.isPunct("}") || tok.isEOF()
+}
+
+func isNilIdentifier(tok *Token) bool {
+	return tok.isIdentifier("nil") && !currentScope.isDeclaredSymbol("nil")
+}
+
+func parseForStatement() Ast {
+	consumeToken("for")
+	ctx := &LoopContext{
+		name:          pendingLabel,
+		breakLabel:    makeLabel(),
+		continueLabel: makeLabel(),
+	}
+	pendingLabel = ""
+
+	beginSymbolBlock()
+	if isRangeClause() {
+		return parseForRangeStatement(ctx)
+	}
+	var init, cond, post Ast
+	if !lookahead(1).isPunct("{") {
+		if !lookahead(1).isSemicolon() {
+			cond = parseSimpleStatement()
+		}
+		if lookahead(1).isSemicolon() {
+			// for init; cond; post {}
+			consumeToken(";")
+			init = cond
+			cond = nil
+			if !lookahead(1).isSemicolon() {
+				cond = parseExpression()
+			}
+			consumeToken(";")
+			if !lookahead(1).isPunct("{") {
+				post = parseSimpleStatement()
+			}
+		} else {
+			cond = conditionOf(cond)
+		}
+	}
+	tok := lookahead(1)
+	if !tok.isPunct("{") {
+		putError("Expected {, but got %s", tok.sval)
+	}
+	loopStack = append(loopStack, ctx)
+	body := parseCompoundStatement()
+	loopStack = loopStack[:len(loopStack)-1]
+	endSymbolBlock()
+
+	return &ForStatement{
+		init:          init,
+		cond:          cond,
+		post:          post,
+		body:          body,
+		breakLabel:    ctx.breakLabel,
+		continueLabel: ctx.continueLabel,
+	}
+}
+
+// the keyword range appears before the body of the loop
+func isRangeClause() bool {
+	for i := 1; ; i++ {
+		tok := lookahead(i)
+		switch {
+		case tok.isKeyword("range"):
+			return true
+		case tok.isEOF(), tok.isPunct("{"), tok.isSemicolon():
+			return false
+		}
+	}
+}
+
+// for k, v := range x {}, for k, v = range x {} or for range x {}
+func parseForRangeStatement(ctx *LoopContext) Ast {
+	frs := &ForRangeStatement{
+		breakLabel:    ctx.breakLabel,
+		continueLabel: ctx.continueLabel,
+	}
+	var lefts []Ast
+	var names []*Token
+	tok := lookahead(1)
+	switch {
+	case tok.isKeyword("range"):
+	case isShortVariableDeclaration():
+		for !lookahead(1).isPunct(":=") {
+			names = append(names, lookahead(1))
+			nextToken()
+			if lookahead(1).isPunct(",") {
+				consumeToken(",")
+			}
+		}
+		consumeToken(":=")
+	default:
+		lefts = parseExpressionListOrBlank()
+		consumeToken("=")
+	}
+	if len(names) > 2 || len(lefts) > 2 {
+		putErrorAt(tok, "Range clause permits at most two iteration variables.")
+	}
+	frs.tok = lookahead(1)
+	consumeToken("range")
+	// the variables are not in scope of the ranged expression
+	frs.expr = parseExpression()
+	for _, name := range names {
+		if isBlankIdentifier(name) {
+			lefts = append(lefts, nil)
+			continue
+		}
+		sym := makeSymbol(name, nil).(*LocalVariable)
+		frs.decls = append(frs.decls, sym)
+		lefts = append(lefts, &Identifier{
+			ExpressionBase: ExpressionBase{tok: name},
+			symbol:         sym,
+		})
+	}
+	if len(names) > 0 && len(frs.decls) == 0 {
+		putErrorAt(tok, "No new variables on left side of :=.")
+	}
+	if len(lefts) > 0 && lefts[0] != nil {
+		frs.key = leftValueOf(lefts[0], tok)
+	}
+	if len(lefts) > 1 && lefts[1] != nil {
+		frs.value = leftValueOf(lefts[1], tok)
+	}
+	if !lookahead(1).isPunct("{") {
+		putError("Expected {, but got %s", lookahead(1).sval)
+	}
+	loopStack = append(loopStack, ctx)
+	frs.body = parseCompoundStatement()
+	loopStack = loopStack[:len(loopStack)-1]
+	endSymbolBlock()
+	return frs
+}
+
+func findLoopContext(tok *Token, name string) *LoopContext {
+	keyword := tok.sval
+	for i := len(loopStack) - 1; i >= 0; i-- {
+		ctx := loopStack[i]
+		if keyword == "continue" && ctx.continueLabel == "" {
+			continue
+		}
+		if name == "" || ctx.name == name {
+			return ctx
+		}
+	}
+	if name == "" {
+		putErrorAt(tok, "%s is not in a loop.", keyword)
+	} else {
+		putErrorAt(tok, "Invalid %s label %s.", keyword, name)
+	}
+	return nil
+}
+
+func parseOptionalLabelName() string {
+	tok := lookahead(1)
+	if tok.isTypeIdentifier() {
+		nextToken()
+		return tok.sval
+	}
+	return ""
+}
+
+func parseBreakStatement() Ast {
+	tok := lookahead(1)
+	consumeToken("break")
+	ctx := findLoopContext(tok, parseOptionalLabelName())
+	return &JumpStatement{
+		keyword: "break",
+		label:   ctx.breakLabel,
+	}
+}
+
+func parseContinueStatement() Ast {
+	tok := lookahead(1)
+	consumeToken("continue")
+	ctx := findLoopContext(tok, parseOptionalLabelName())
+	return &JumpStatement{
+		keyword: "continue",
+		label:   ctx.continueLabel,
+	}
+}
+
+// a semicolon may be omitted before a closing ")" or "}"
+func consumeSemicolon() {
+	tok := lookahead(1)
+	if tok.isEOF() || tok.isPunct(")") || tok.isPunct("}") {
+		return
+	}
+	consumeToken(";")
+}
+
+func parseDeclarationStatement() Ast {
+	ds := &DeclarationStatement{}
+	parseDeclarationGroup("var", func() {
+		names, gtype, exprs := parseVarSpec()
+		var lefts []LeftValue
+		for _, name := range names {
+			if isBlankIdentifier(name) {
+				lefts = append(lefts, nil)
+				continue
+			}
+			sym := makeSymbol(name, gtype).(*LocalVariable)
+			ds.syms = append(ds.syms, sym)
+			lefts = append(lefts, &Identifier{
+				ExpressionBase: ExpressionBase{
+					tok: name,
+				},
+				symbol: sym,
+			})
+		}
+		if exprs != nil {
+			ds.assigns = append(ds.assigns, &MultipleAssignmentStatement{
+				lefts:  lefts,
+				rights: exprs,
+			})
+		}
+	})
+	return ds
+}
+
+// parses both "var x T = e" and the grouped "var ( ... )", or those of type
+func parseDeclarationGroup(keyword string, parseSpec func()) {
+	consumeToken(keyword)
+	if lookahead(1).isPunct("(") {
+		consumeToken("(")
+		for !lookahead(1).isPunct(")") {
+			parseSpec()
+			consumeSemicolon()
+		}
+		consumeToken(")")
+	} else {
+		parseSpec()
+	}
+	consumeSemicolon()
+}
+
+// IdentifierList [Type] [= ExpressionList]
+// the type is nil when it is inferred from the initializer
+func parseVarSpec() ([]*Token, Type, []Ast) {
+	names := parseIdentifierList()
+	var gtype Type
+	if isTypeStart(lookahead(1)) {
+		gtype = parseType()
+	}
+	var exprs []Ast
+	if lookahead(1).isPunct("=") {
+		consumeToken("=")
+		exprs = parseExpressionList()
+	}
+	if gtype == nil && exprs == nil {
+		putErrorAt(names[0], "Expected type or initializer for %s.", names[0].sval)
+	}
+	return names, gtype, exprs
+}
+
+func parseIdentifierList() []*Token {
+	var names []*Token
+	for {
+		tok := lookahead(1)
+		if !tok.isTypeIdentifier() {
+			putError("Expected identifier, but got %s.", tok.sval)
+		}
+		nextToken()
+		names = append(names, tok)
+		if !lookahead(1).isPunct(",") {
+			return names
+		}
+		consumeToken(",")
+	}
+}
+
+func parseAssignmentExpressionRightHand(ast Ast) Ast {
 	tok := lookahead(1)
 	switch {
 	case tok.isEOF():
 		return ast
 	case tok.isPunct("="):
 		consumeToken("=")
-		var right Ast = parseAdditiveExpression()
+		var right Ast = parseExpression()
 		left, ok := ast.(LeftValue)
 		if !ok {
 			putError("fatal: cannot cast %T.", ast)
 			panic("internal error")
 		}
 		return &AssignmentExpression{
-			left:  left,
-			right: right,
+			ExpressionBase: ExpressionBase{tok: tok},
+			left:           left,
+			right:          right,
+		}
+	case tok.isPunct("++"), tok.isPunct("--"):
+		consumeToken(tok.sval)
+		var operator ArithmeticOperator = &AdditiveOperator{}
+		if tok.isPunct("--") {
+			operator = &SubtractionOperator{}
+		}
+		one := &AstConstant{
+			ExpressionBase: ExpressionBase{
+				tok:      tok,
+				constant: &IntegerConstant{value: big.NewInt(1)},
+			},
+		}
+		return &AssignmentExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			operator:       operator,
+			left:           leftValueOf(ast, tok),
+			right:          one,
+		}
+	case compoundAssignmentOperator(tok) != nil:
+		consumeToken(tok.sval)
+		var right Ast = parseExpression()
+		return &AssignmentExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			operator:       compoundAssignmentOperator(tok),
+			left:           leftValueOf(ast, tok),
+			right:          right,
 		}
 	case tok.isSemicolon():
 		return ast
@@ -365,77 +1611,191 @@ func parseAssignmentExpressionRightHand(ast Ast) Ast {
 	return ast
 }
 
+func leftValueOf(ast Ast, tok *Token) LeftValue {
+	left, ok := ast.(LeftValue)
+	if !ok {
+		putErrorAt(tok, "Cannot assign to %T.", ast)
+	}
+	return left
+}
+
+// the operator of op=, or nil
+func compoundAssignmentOperator(tok *Token) ArithmeticOperator {
+	if !tok.isTypePunct() {
+		return nil
+	}
+	switch tok.sval {
+	case "+=":
+		return &AdditiveOperator{}
+	case "-=":
+		return &SubtractionOperator{}
+	case "*=":
+		return &MultiplicativeOperator{}
+	case "/=":
+		return &DivisionOperator{}
+	case "%=":
+		return &RemainderOperator{}
+	case "&=":
+		return &BitAndOperator{}
+	case "|=":
+		return &BitOrOperator{}
+	case "^=":
+		return &BitXorOperator{}
+	case "&^=":
+		return &BitClearOperator{}
+	case "<<=":
+		return &ShiftLeftOperator{}
+	case ">>=":
+		return &ShiftRightOperator{}
+	}
+	return nil
+}
+
 func parseExpression() Ast {
-	ast := parseAdditiveExpression()
+	ast := parseLogicalOrExpression()
 	return ast
 }
 
-func parseAdditiveExpression() Ast {
-	var ast Ast = parseMultiplicativeExpression()
+func parseLogicalOrExpression() Ast {
+	var ast Ast = parseLogicalAndExpression()
 	for {
 		tok := lookahead(1)
 		switch {
-		case tok.isEOF():
-			return ast
-		case tok.isPunct("+"):
-			consumeToken("+")
-			right := parseMultiplicativeExpression()
-			ast = &ArithmeticExpression{
-				operator: &AdditiveOperator{},
-				left:     ast,
-				right:    right,
+		case tok.isPunct("||"):
+			consumeToken("||")
+			right := parseLogicalAndExpression()
+			ast = &LogicalOrExpression{
+				ExpressionBase: ExpressionBase{tok: tok},
+				left:           ast,
+				right:          right,
 			}
-		case tok.isPunct("-"):
-			consumeToken("-")
-			right := parseMultiplicativeExpression()
-			ast = &ArithmeticExpression{
-				operator: &SubtractionOperator{},
-				left:     ast,
-				right:    right,
+		default:
+			return ast
+		}
+	}
+}
+
+func parseLogicalAndExpression() Ast {
+	var ast Ast = parseRelationalExpression()
+	for {
+		tok := lookahead(1)
+		switch {
+		case tok.isPunct("&&"):
+			consumeToken("&&")
+			right := parseRelationalExpression()
+			ast = &LogicalAndExpression{
+				ExpressionBase: ExpressionBase{tok: tok},
+				left:           ast,
+				right:          right,
 			}
-		case tok.isSemicolon():
+		default:
 			return ast
-		case tok.isPunct("="):
+		}
+	}
+}
+
+func parseRelationalExpression() Ast {
+	var ast Ast = parseAdditiveExpression()
+	for {
+		tok := lookahead(1)
+		var operator RelationalOperator
+		switch {
+		case tok.isPunct("=="):
+			operator = &EqualOperator{}
+		case tok.isPunct("!="):
+			operator = &NotEqualOperator{}
+		case tok.isPunct("<"):
+			operator = &LessOperator{}
+		case tok.isPunct("<="):
+			operator = &LessEqualOperator{}
+		case tok.isPunct(">"):
+			operator = &GreaterOperator{}
+		case tok.isPunct(">="):
+			operator = &GreaterEqualOperator{}
+		default:
 			return ast
+		}
+		consumeToken(tok.sval)
+		right := parseAdditiveExpression()
+		ast = &RelationalExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			operator:       operator,
+			left:           ast,
+			right:          right,
+		}
+	}
+}
+
+func parseAdditiveExpression() Ast {
+	var ast Ast = parseMultiplicativeExpression()
+	for {
+		tok := lookahead(1)
+		var operator ArithmeticOperator
+		switch {
+		case tok.isPunct("+"):
+			operator = &AdditiveOperator{}
+		case tok.isPunct("-"):
+			operator = &SubtractionOperator{}
+		case tok.isPunct("|"):
+			operator = &BitOrOperator{}
+		case tok.isPunct("^"):
+			operator = &BitXorOperator{}
 		default:
 			return ast
 		}
+		consumeToken(tok.sval)
+		right := parseMultiplicativeExpression()
+		ast = &ArithmeticExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			operator:       operator,
+			left:           ast,
+			right:          right,
+		}
 	}
-	return ast
 }
 
 func parseMultiplicativeExpression() Ast {
 	var ast Ast = parseUnaryExpression()
 	for {
 		tok := lookahead(1)
+		var operator ArithmeticOperator
 		switch {
-		case tok.isEOF():
-			return ast
 		case tok.isPunct("*"):
-			consumeToken("*")
-			right := parseUnaryExpression()
-			ast = &ArithmeticExpression{
-				operator: &MultiplicativeOperator{},
-				left:     ast,
-				right:    right,
-			}
+			operator = &MultiplicativeOperator{}
 		case tok.isPunct("/"):
-			consumeToken("/")
+			operator = &DivisionOperator{}
+		case tok.isPunct("%"):
+			operator = &RemainderOperator{}
+		case tok.isPunct("&"):
+			operator = &BitAndOperator{}
+		case tok.isPunct("&^"):
+			operator = &BitClearOperator{}
+		case tok.isPunct("<<"), tok.isPunct(">>"):
+			consumeToken(tok.sval)
 			right := parseUnaryExpression()
-			ast = &ArithmeticExpression{
-				operator: &DivisionOperator{},
-				left:     ast,
-				right:    right,
+			operator = &ShiftLeftOperator{}
+			if tok.isPunct(">>") {
+				operator = &ShiftRightOperator{}
 			}
-		case tok.isSemicolon():
-			return ast
-		case tok.isPunct("+"), tok.isPunct("-"), tok.isPunct("="):
-			return ast
+			ast = &ShiftExpression{
+				ExpressionBase: ExpressionBase{tok: tok},
+				operator:       operator,
+				left:           ast,
+				right:          right,
+			}
+			continue
 		default:
 			return ast
 		}
+		consumeToken(tok.sval)
+		right := parseUnaryExpression()
+		ast = &ArithmeticExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			operator:       operator,
+			left:           ast,
+			right:          right,
+		}
 	}
-	return ast
 }
 
 func parseUnaryExpression() Ast {
@@ -445,7 +1805,52 @@ func parseUnaryExpression() Ast {
 	switch {
 	case tok.isEOF():
 		return nil
-	case tok.isTypeString(), tok.isTypeIdentifier(), tok.isTypeInt(), tok.isTypeRune():
+	case tok.isPunct("!"):
+		consumeToken("!")
+		operand := parseUnaryExpression()
+		return &LogicalNotExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			operand:        operand,
+		}
+	case tok.isPunct("&"):
+		consumeToken("&")
+		operand := parseUnaryExpression()
+		left, ok := operand.(LeftValue)
+		if !ok {
+			putErrorAt(tok, "Cannot take the address of %T.", operand)
+		}
+		markEscaping(left)
+		return &AddressExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			operand:        left,
+		}
+	case tok.isPunct("*"):
+		consumeToken("*")
+		operand := parseUnaryExpression()
+		return &DereferenceExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			operand:        operand,
+		}
+	case tok.isPunct("+"), tok.isPunct("-"), tok.isPunct("^"):
+		consumeToken(tok.sval)
+		operand := parseUnaryExpression()
+		var operator UnaryOperator
+		switch tok.sval {
+		case "+":
+			operator = &PositiveOperator{}
+		case "-":
+			operator = &NegativeOperator{}
+		case "^":
+			operator = &ComplementOperator{}
+		}
+		return &UnaryExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			operator:       operator,
+			operand:        operand,
+		}
+	case tok.isTypeString(), tok.isTypeIdentifier(), tok.isTypeInt(), tok.isTypeFloat(), tok.isTypeImaginary(), tok.isTypeRune(),
+		tok.isPunct("("), tok.isPunct("["),
+		tok.isKeyword("struct"), tok.isKeyword("interface"), tok.isKeyword("map"), tok.isKeyword("func"):
 		ast = parsePrimaryExpression()
 		return ast
 	default:
@@ -455,21 +1860,176 @@ func parseUnaryExpression() Ast {
 	return nil
 }
 
+// a local variable whose address is taken may be referenced
+// after its function returns, so it is allocated on the heap.
+// so is the variable of an element or a field whose address is taken
+func markEscaping(left LeftValue) {
+	switch v := left.(type) {
+	case *Identifier:
+		if lv, ok := v.symbol.(*LocalVariable); ok {
+			lv.escapes = true
+		}
+	case *IndexExpression:
+		if array, ok := v.array.(LeftValue); ok {
+			markEscaping(array)
+		}
+	case *SelectorExpression:
+		if operand, ok := v.operand.(LeftValue); ok {
+			markEscaping(operand)
+		}
+	}
+}
+
+// an operand followed by index and slice suffixes
 func parsePrimaryExpression() Ast {
+	ast := parseOperand()
+	for {
+		tok := lookahead(1)
+		switch {
+		case tok.isPunct("["):
+			consumeToken("[")
+			var index Ast
+			if !lookahead(1).isPunct(":") {
+				index = parseExpression()
+			}
+			if lookahead(1).isPunct(":") {
+				ast = parseSliceExpressionRightHand(ast, index, tok)
+				continue
+			}
+			consumeToken("]")
+			ast = &IndexExpression{
+				ExpressionBase: ExpressionBase{tok: tok},
+				array:          ast,
+				index:          index,
+				position:       positionOf(tok),
+			}
+		case tok.isPunct(".") && lookahead(2).isPunct("("):
+			ast = parseTypeAssertion(ast)
+		case tok.isPunct("."):
+			consumeToken(".")
+			name := lookahead(1)
+			if !name.isTypeIdentifier() {
+				putErrorAt(name, "Expected field name, but got %s.", name.sval)
+			}
+			nextToken()
+			ast = &SelectorExpression{
+				ExpressionBase: ExpressionBase{tok: name},
+				operand:        ast,
+				name:           name.sval,
+			}
+		case tok.isPunct("("):
+			ast = parseFunctionValueCall(ast)
+		default:
+			return ast
+		}
+	}
+}
+
+// a call of a method, or of a func value.
+// which one x.M(...) is, is known after the checking
+func parseFunctionValueCall(function Ast) Ast {
+	fc := &FunCall{
+		ExpressionBase: ExpressionBase{tok: function.(Expression).getTok()},
+		fname:          function.(Expression).getTok().sval,
+		function:       function,
+	}
+	consumeToken("(")
+	fc.args = parseArgumentList()
+	consumeToken(")")
+	return fc
+}
+
+// x.(T), or x.(type) of a type switch, which has no type
+func parseTypeAssertion(operand Ast) Ast {
+	consumeToken(".")
+	tok := lookahead(1)
+	consumeToken("(")
+	ta := &TypeAssertExpression{
+		ExpressionBase: ExpressionBase{tok: tok},
+		operand:        operand,
+		position:       positionOf(tok),
+	}
+	if lookahead(1).isKeyword("type") {
+		consumeToken("type")
+	} else {
+		ta.assertType = parseType()
+	}
+	consumeToken(")")
+	return ta
+}
+
+// the rest of operand[low:high:max] after low
+func parseSliceExpressionRightHand(operand Ast, low Ast, tok *Token) Ast {
+	// a slice of an array variable shares its storage
+	if left, ok := operand.(LeftValue); ok {
+		markEscaping(left)
+	}
+	consumeToken(":")
+	var high, max Ast
+	if !lookahead(1).isPunct("]") && !lookahead(1).isPunct(":") {
+		high = parseExpression()
+	}
+	if lookahead(1).isPunct(":") {
+		consumeToken(":")
+		if high == nil {
+			putErrorAt(tok, "Middle index required in 3-index slice.")
+		}
+		if lookahead(1).isPunct("]") {
+			putErrorAt(tok, "Final index required in 3-index slice.")
+		}
+		max = parseExpression()
+	}
+	consumeToken("]")
+	return &SliceExpression{
+		ExpressionBase: ExpressionBase{tok: tok},
+		operand:        operand,
+		low:            low,
+		high:           high,
+		max:            max,
+		position:       positionOf(tok),
+	}
+}
+
+// the position reported by a runtime panic
+func positionOf(tok *Token) *AstString {
+	return getAstString(fmt.Sprintf("%s:%d", tok.filename, tok.line))
+}
+
+func parseOperand() Ast {
 	tok := lookahead(1)
 	switch {
 	case tok.isEOF():
 		return nil
-	case tok.isTypeInt(), tok.isTypeRune(), tok.isTypeString():
+	case tok.isTypeInt(), tok.isTypeFloat(), tok.isTypeImaginary(), tok.isTypeRune(), tok.isTypeString():
 		ast := parseConstant()
 		return &PrimaryExpression{
-			child: ast,
+			ExpressionBase: ExpressionBase{tok: tok},
+			child:          ast,
 		}
-	case tok.isTypeIdentifier(), tok.isTypeKeyword():
+	case tok.isKeyword("func"):
+		return parseFuncLiteral()
+	case tok.isTypeIdentifier(), tok.isTypeKeyword() && !tok.isKeyword("struct") && !tok.isKeyword("interface") &&
+		!tok.isKeyword("map"):
 		ast := parseIdentifierOrFuncall()
 		return ast
+	case tok.isPunct("(") && lookahead(2).isPunct("*") && isTypeName(lookahead(3)) && lookahead(4).isPunct(")"):
+		// (*T).M, or the conversion (*T)(x)
+		consumeToken("(")
+		recvType := parseType()
+		consumeToken(")")
+		if lookahead(1).isPunct("(") {
+			return parseConversion(recvType, tok)
+		}
+		return parseMethodExpression(recvType, tok)
+	case tok.isPunct("("):
+		consumeToken("(")
+		ast := parseExpression()
+		consumeToken(")")
+		return ast
+	case tok.isPunct("["), tok.isKeyword("struct"), tok.isKeyword("interface"), tok.isKeyword("map"):
+		return parseCompositeLiteral()
 	default:
-		putError("Unexpected token %v in parsePrimaryExpression.\n", tok.sval)
+		putError("Unexpected token %v in parseOperand.\n", tok.sval)
 	}
 
 	return nil
@@ -481,19 +2041,50 @@ func parseConstant() Ast {
 	case tok.isEOF():
 		putError("tok is nil\n")
 	case tok.isTypeInt():
-		ival, _ := strconv.Atoi(tok.sval)
+		// the prefix selects the base, and octal with a leading 0
+		value, ok := new(big.Int).SetString(tok.sval, 0)
+		if !ok {
+			putErrorAt(tok, "Invalid integer constant %s.", tok.sval)
+		}
 		nextToken()
 		return &AstConstant{
-			constant: &IntegerConstant{
-				ival: ival,
+			ExpressionBase: ExpressionBase{
+				tok:      tok,
+				constant: &IntegerConstant{value: value},
+			},
+		}
+	case tok.isTypeFloat():
+		value, _, err := big.ParseFloat(tok.sval, 0, maxConstantBits, big.ToNearestEven)
+		if err != nil {
+			putErrorAt(tok, "Invalid floating-point constant %s.", tok.sval)
+		}
+		nextToken()
+		return &AstConstant{
+			ExpressionBase: ExpressionBase{
+				tok:      tok,
+				constant: &FloatConstant{value: value},
+			},
+		}
+	case tok.isTypeImaginary():
+		// the digits before i are decimal even with a leading 0, as in a float
+		value, _, err := big.ParseFloat(tok.sval[:len(tok.sval)-1], 0, maxConstantBits, big.ToNearestEven)
+		if err != nil {
+			putErrorAt(tok, "Invalid imaginary constant %s.", tok.sval)
+		}
+		nextToken()
+		return &AstConstant{
+			ExpressionBase: ExpressionBase{
+				tok:      tok,
+				constant: &ComplexConstant{re: newFloat(), im: value},
 			},
 		}
 	case tok.isTypeRune():
 		rarr := []rune(tok.sval)
 		nextToken()
 		return &AstConstant{
-			constant: &RuneConstant{
-				rval: rarr[0],
+			ExpressionBase: ExpressionBase{
+				tok:      tok,
+				constant: &RuneConstant{value: big.NewInt(int64(rarr[0]))},
 			},
 		}
 	case tok.isTypeString():
@@ -519,9 +2110,13 @@ func parseIdentifier() *Identifier {
 		if sym == nil {
 			putError("Undefined variable %s.\n", tok.sval)
 		}
+		if lv, ok := sym.(*LocalVariable); ok {
+			sym = currentFunction.capture(lv)
+		}
 
 		return &Identifier{
-			symbol: sym,
+			ExpressionBase: ExpressionBase{tok: tok},
+			symbol:         sym,
 		}
 	default:
 		putError("Unexpected token %v in parseSymbol.\n", tok.sval)
@@ -537,26 +2132,168 @@ func parseIdentifierOrFuncall() Ast {
 		return parseIdentifier()
 	}
 	nextToken()
-	tok = lookahead(1)
+	tok2 := lookahead(1)
 	switch {
-	case tok.isEOF():
+	case tok2.isEOF():
 		return nil
-	case tok.isPunct("("):
+	case name == "iota" && currentIota >= 0:
+		return &AstConstant{
+			ExpressionBase: ExpressionBase{
+				tok:      tok,
+				constant: &IntegerConstant{value: big.NewInt(int64(currentIota))},
+			},
+		}
+	case name == "true" || name == "false":
+		return &AstConstant{
+			ExpressionBase: ExpressionBase{
+				tok:      tok,
+				constant: &BoolConstant{value: name == "true"},
+			},
+		}
+	case name == "nil":
+		return &AstConstant{
+			ExpressionBase: ExpressionBase{
+				tok:      tok,
+				constant: &NilConstant{},
+			},
+		}
+	case name == "len" && tok2.isPunct("("):
+		consumeToken("(")
+		operand := parseExpression()
+		consumeToken(")")
+		return &LenExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			operand:        operand,
+		}
+	case lookupType(name) != nil && tok2.isPunct("("):
+		return parseConversion(lookupType(name), tok)
+	case lookupType(name) != nil && tok2.isPunct("{"):
+		return parseCompositeLiteralBody(lookupType(name), tok)
+	case lookupType(name) != nil && tok2.isPunct("."):
+		return parseMethodExpression(lookupType(name), tok)
+	case findFunction(name) != nil && !tok2.isPunct("("):
+		return &FunctionValue{
+			ExpressionBase: ExpressionBase{tok: tok},
+			sig:            findFunction(name),
+		}
+	case name == "cap" && tok2.isPunct("("):
+		consumeToken("(")
+		operand := parseExpression()
+		consumeToken(")")
+		return &CapExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			operand:        operand,
+		}
+	case name == "make" && tok2.isPunct("("):
+		consumeToken("(")
+		makeType := parseType()
+		var length, capacity Ast
+		if lookahead(1).isPunct(",") {
+			consumeToken(",")
+			length = parseExpression()
+		}
+		if lookahead(1).isPunct(",") {
+			consumeToken(",")
+			capacity = parseExpression()
+		}
+		consumeToken(")")
+		return &MakeExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			makeType:       makeType,
+			length:         length,
+			capacity:       capacity,
+			position:       positionOf(tok),
+		}
+	case name == "append" && tok2.isPunct("("):
+		consumeToken("(")
+		args := parseArgumentList()
+		spread := false
+		if lookahead(1).isPunct("...") {
+			consumeToken("...")
+			spread = true
+		}
+		consumeToken(")")
+		if len(args) == 0 {
+			putErrorAt(tok, "Missing arguments to append.")
+		}
+		if spread && len(args) != 2 {
+			putErrorAt(tok, "Can only use ... with final argument to append.")
+		}
+		return &AppendExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			slice:          args[0],
+			values:         args[1:],
+			spread:         spread,
+		}
+	case name == "copy" && tok2.isPunct("("):
+		consumeToken("(")
+		args := parseArgumentList()
+		consumeToken(")")
+		if len(args) != 2 {
+			putErrorAt(tok, "copy expects 2 arguments, but got %d.", len(args))
+		}
+		return &CopyExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			dst:            args[0],
+			src:            args[1],
+		}
+	case name == "delete" && tok2.isPunct("("):
+		consumeToken("(")
+		args := parseArgumentList()
+		consumeToken(")")
+		if len(args) != 2 {
+			putErrorAt(tok, "delete expects 2 arguments, but got %d.", len(args))
+		}
+		return &DeleteExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			m:              args[0],
+			key:            args[1],
+		}
+	case name == "new" && tok2.isPunct("("):
+		consumeToken("(")
+		elem := parseType()
+		consumeToken(")")
+		return &NewExpression{
+			ExpressionBase: ExpressionBase{tok: tok},
+			elem:           elem,
+		}
+	case tok2.isPunct("("):
 		consumeToken("(")
 		args := parseArgumentList()
 		consumeToken(")")
 		return &FunCall{
-			fname: name,
-			args:  args,
+			ExpressionBase: ExpressionBase{tok: tok},
+			fname:          name,
+			args:           args,
 		}
 	default:
-		putError("Undeclared identifier %s.", name)
+		putErrorAt(tok, "Undeclared identifier %s.", name)
 	}
 
 	fmt.Println("TBD")
 	return nil
 }
 
+// whether the identifier is of a type, rather than of a variable
+func isTypeName(tok *Token) bool {
+	return tok.isTypeIdentifier() && !currentScope.isDeclaredSymbol(tok.sval) && lookupType(tok.sval) != nil
+}
+
+// T.M and (*T).M are the functions of the methods, taking the receiver as the first argument
+func parseMethodExpression(recvType Type, tok *Token) Ast {
+	consumeToken(".")
+	name := lookahead(1)
+	if !name.isTypeIdentifier() {
+		putErrorAt(name, "Expected method name, but got %s.", name.sval)
+	}
+	nextToken()
+	return &MethodExpression{
+		ExpressionBase: ExpressionBase{tok: tok},
+		recvType:       recvType,
+		name:           name.sval,
+	}
+}
+
 func parseArgumentList() []Ast {
 	var r []Ast
 	for {
@@ -574,7 +2311,7 @@ func parseArgumentList() []Ast {
 		switch {
 		case tok.isEOF():
 			putError("Expected ), but got EOF")
-		case tok.isPunct(")"):
+		case tok.isPunct(")"), tok.isPunct("..."):
 			return r
 		case tok.isPunct(","):
 			consumeToken(",")
@@ -0,0 +1,1151 @@
+package main
+
+/* ================================
+ * Runtime
+ *     routines called by the generated code,
+ *     they are emitted after the program
+ * ================================ */
+
+// formats of the runtime errors, with up to three arguments
+const (
+	runtimeErrorIndex             = ".runtime_errorIndex"
+	runtimeErrorSliceLength       = ".runtime_errorSliceLength"
+	runtimeErrorSliceCapacity     = ".runtime_errorSliceCapacity"
+	runtimeErrorSliceOrder        = ".runtime_errorSliceOrder"
+	runtimeErrorSlice3Length      = ".runtime_errorSlice3Length"
+	runtimeErrorSlice3Capacity    = ".runtime_errorSlice3Capacity"
+	runtimeErrorSlice3OrderHigh   = ".runtime_errorSlice3OrderHigh"
+	runtimeErrorSlice3OrderLow    = ".runtime_errorSlice3OrderLow"
+	runtimeErrorMakesliceLength   = ".runtime_errorMakesliceLength"
+	runtimeErrorMakesliceCapacity = ".runtime_errorMakesliceCapacity"
+	runtimeErrorAssertNil         = ".runtime_errorAssertNil"
+	runtimeErrorAssertType        = ".runtime_errorAssertType"
+	runtimeErrorAssertMethod      = ".runtime_errorAssertMethod"
+	runtimeErrorUncomparable      = ".runtime_errorUncomparable"
+	runtimeErrorNilMap            = ".runtime_errorNilMap"
+)
+
+func emitRuntime() {
+	emitCode(".data")
+	emitCode(".balign\t8")
+	// the heap chunk being allocated from
+	emitCode(".runtime_heapNext:")
+	emitCode(".quad\t0")
+	emitCode(".runtime_heapEnd:")
+	emitCode(".quad\t0")
+	// the value of nil slices
+	emitCode(".runtime_zero:")
+	emitCode(".zero\t24")
+	emitCode(".runtime_panicPrefix:")
+	emitCode(".string \"panic: \"")
+	emitCode(".runtime_errorPrefix:")
+	emitCode(".string \"panic: runtime error: \"")
+	emitCode(".runtime_errorPosition:")
+	emitCode(".string \"\\n\\n\\t%%s\\n\"")
+	emitCode("%s:", runtimeErrorIndex)
+	emitCode(".string \"index out of range [%%ld] with length %%ld\"")
+	emitCode("%s:", runtimeErrorSliceLength)
+	emitCode(".string \"slice bounds out of range [:%%ld] with length %%ld\"")
+	emitCode("%s:", runtimeErrorSliceCapacity)
+	emitCode(".string \"slice bounds out of range [:%%ld] with capacity %%ld\"")
+	emitCode("%s:", runtimeErrorSliceOrder)
+	emitCode(".string \"slice bounds out of range [%%ld:%%ld]\"")
+	emitCode("%s:", runtimeErrorSlice3Length)
+	emitCode(".string \"slice bounds out of range [::%%ld] with length %%ld\"")
+	emitCode("%s:", runtimeErrorSlice3Capacity)
+	emitCode(".string \"slice bounds out of range [::%%ld] with capacity %%ld\"")
+	emitCode("%s:", runtimeErrorSlice3OrderHigh)
+	emitCode(".string \"slice bounds out of range [:%%ld:%%ld]\"")
+	emitCode("%s:", runtimeErrorSlice3OrderLow)
+	emitCode(".string \"slice bounds out of range [%%ld:%%ld:]\"")
+	emitCode("%s:", runtimeErrorMakesliceLength)
+	emitCode(".string \"makeslice: len out of range\"")
+	emitCode("%s:", runtimeErrorMakesliceCapacity)
+	emitCode(".string \"makeslice: cap out of range\"")
+	emitCode("%s:", runtimeErrorAssertNil)
+	emitCode(".string \"interface conversion: interface is nil, not %%s\"")
+	emitCode("%s:", runtimeErrorAssertType)
+	emitCode(".string \"interface conversion: %%s is %%s, not %%s\"")
+	emitCode("%s:", runtimeErrorAssertMethod)
+	emitCode(".string \"interface conversion: %%s is not %%s: missing method %%s\"")
+	emitCode("%s:", runtimeErrorUncomparable)
+	emitCode(".string \"comparing uncomparable type %%s\"")
+	emitCode("%s:", runtimeErrorNilMap)
+	emitCode(".string \"assignment to entry in nil map\"")
+
+	emitCode(".text")
+	emitRuntimePanic()
+	emitRuntimeAlloc()
+	emitRuntimeMakeslice()
+	emitRuntimeGrowslice()
+	emitRuntimeAppendslice()
+	emitRuntimeSlicecopy()
+	emitRuntimeConcatstrings()
+	emitRuntimeCmpstring()
+	emitRuntimeCstring()
+	emitRuntimeCopybytes("_runtime_slicebytetostring", tString.size())
+	emitRuntimeCopybytes("_runtime_stringtoslicebyte", 24)
+	emitRuntimeDecoderune()
+	emitRuntimeEncoderune()
+	emitRuntimeIntstring()
+	emitRuntimeStringtoslicerune()
+	emitRuntimeSlicerunetostring()
+	emitRuntimeLookupitab()
+	emitRuntimePanicassert()
+	emitRuntimeIfaceeq()
+	emitRuntimeMemhash()
+	emitRuntimeStrhash()
+	emitRuntimeMakemap()
+	emitRuntimeMapfind()
+	emitRuntimeMapaccess()
+	emitRuntimeMapassign()
+	emitRuntimeMapgrow()
+	emitRuntimeMapdelete()
+	emitRuntimeMapiterinit()
+}
+
+// %rdi is the format, %rsi, %rdx and %r8 its arguments, %rcx the position in the source.
+// _runtime_throw prints the message without the prefix of runtime errors
+func emitRuntimePanic() {
+	message := makeLabel()
+	for _, entry := range []string{"_runtime_panic", "_runtime_throw"} {
+		emitCode("%s:", entry)
+		emitCode("\tandq\t$-16, %%rsp")
+		emitCode("\tpushq\t%%rcx")
+		emitCode("\tpushq\t%%r8")
+		emitCode("\tpushq\t%%rdx")
+		emitCode("\tpushq\t%%rsi")
+		emitCode("\tpushq\t%%rdi")
+		emitCode("\tpushq\t%%rdi")
+		if entry == "_runtime_panic" {
+			emitCode("\tleaq\t.runtime_errorPrefix(%%rip), %%rsi")
+			emitCode("\tjmp\t%s", message)
+		}
+	}
+	emitCode("\tleaq\t.runtime_panicPrefix(%%rip), %%rsi")
+	emitLabel(message)
+	emitCode("\tmovl\t$2, %%edi")
+	emitCode("\tmovl\t$0, %%eax")
+	emitCode("\tcallq\t_dprintf")
+	emitCode("\tmovl\t$2, %%edi")
+	emitCode("\tmovq\t8(%%rsp), %%rsi")
+	emitCode("\tmovq\t16(%%rsp), %%rdx")
+	emitCode("\tmovq\t24(%%rsp), %%rcx")
+	emitCode("\tmovq\t32(%%rsp), %%r8")
+	emitCode("\tmovl\t$0, %%eax")
+	emitCode("\tcallq\t_dprintf")
+	emitCode("\tmovl\t$2, %%edi")
+	emitCode("\tleaq\t.runtime_errorPosition(%%rip), %%rsi")
+	emitCode("\tmovq\t40(%%rsp), %%rdx")
+	emitCode("\tmovl\t$0, %%eax")
+	emitCode("\tcallq\t_dprintf")
+	emitCode("\tmovl\t$2, %%edi")
+	emitCode("\tcallq\t_exit")
+}
+
+// allocate %rdi bytes of zeroed memory, the address is returned in %rax.
+// the memory is cut from chunks of calloc, and never freed
+func emitRuntimeAlloc() {
+	fits := makeLabel()
+	emitCode("_runtime_alloc:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	// round up to 8 bytes, and give distinct addresses to empty values
+	emitCode("\taddq\t$7, %%rdi")
+	emitCode("\tandq\t$-8, %%rdi")
+	emitCode("\tmovl\t$8, %%eax")
+	emitCode("\tcmovzq\t%%rax, %%rdi")
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovq\t.runtime_heapNext(%%rip), %%rax")
+	emitCode("\tleaq\t(%%rax,%%rbx), %%rcx")
+	emitCode("\tcmpq\t.runtime_heapEnd(%%rip), %%rcx")
+	emitCode("\tjbe\t%s", fits)
+	// a new chunk of 1MB, or larger for a large value
+	emitCode("\tmovq\t$1048576, %%r12")
+	emitCode("\tcmpq\t%%r12, %%rbx")
+	emitCode("\tcmovaq\t%%rbx, %%r12")
+	emitCode("\tmovl\t$1, %%edi")
+	emitCode("\tmovq\t%%r12, %%rsi")
+	emitCode("\tcallq\t_calloc")
+	emitCode("\tleaq\t(%%rax,%%r12), %%rcx")
+	emitCode("\tmovq\t%%rcx, .runtime_heapEnd(%%rip)")
+	emitCode("\tleaq\t(%%rax,%%rbx), %%rcx")
+	emitLabel(fits)
+	emitCode("\tmovq\t%%rcx, .runtime_heapNext(%%rip)")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// %rdi is the length, %rsi the capacity, %rdx the element size and %rcx the position,
+// the address of the new slice header is returned in %rax
+func emitRuntimeMakeslice() {
+	invalidLength := makeLabel()
+	invalidCapacity := makeLabel()
+	valid := makeLabel()
+	emitCode("_runtime_makeslice:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tpushq\t%%r13")
+	emitCode("\tpushq\t%%r14")
+	emitCode("\ttestq\t%%rdi, %%rdi")
+	emitCode("\tjs\t%s", invalidLength)
+	emitCode("\ttestq\t%%rsi, %%rsi")
+	emitCode("\tjs\t%s", invalidCapacity)
+	emitCode("\tcmpq\t%%rdi, %%rsi")
+	emitCode("\tjge\t%s", valid)
+	emitLabel(invalidCapacity)
+	emitCode("\tleaq\t%s(%%rip), %%rdi", runtimeErrorMakesliceCapacity)
+	emitCode("\tcallq\t_runtime_panic")
+	emitLabel(invalidLength)
+	emitCode("\tleaq\t%s(%%rip), %%rdi", runtimeErrorMakesliceLength)
+	emitCode("\tcallq\t_runtime_panic")
+	emitLabel(valid)
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovq\t%%rsi, %%r12")
+	emitCode("\tmovq\t%%rdx, %%r13")
+	emitCode("\tmovl\t$24, %%edi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, %%r14")
+	emitCode("\tmovq\t%%r12, %%rdi")
+	emitCode("\timulq\t%%r13, %%rdi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, 0(%%r14)")
+	emitCode("\tmovq\t%%rbx, 8(%%r14)")
+	emitCode("\tmovq\t%%r12, 16(%%r14)")
+	emitCode("\tmovq\t%%r14, %%rax")
+	emitCode("\tpopq\t%%r14")
+	emitCode("\tpopq\t%%r13")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// extend the length of the slice header at %rdi by %rsi elements of %rdx bytes.
+// when the capacity is short, the elements are moved to a new array
+// of twice the capacity, or of the new length if it is larger
+func emitRuntimeGrowslice() {
+	done := makeLabel()
+	emitCode("_runtime_growslice:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tpushq\t%%r13")
+	emitCode("\tpushq\t%%r14")
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovq\t%%rdx, %%r13")
+	emitCode("\tmovq\t8(%%rbx), %%r14")
+	emitCode("\taddq\t%%rsi, %%r14")
+	emitCode("\tcmpq\t16(%%rbx), %%r14")
+	emitCode("\tjbe\t%s", done)
+	emitCode("\tmovq\t16(%%rbx), %%r12")
+	emitCode("\taddq\t%%r12, %%r12")
+	emitCode("\tcmpq\t%%r14, %%r12")
+	emitCode("\tcmovbq\t%%r14, %%r12")
+	emitCode("\tmovq\t%%r12, %%rdi")
+	emitCode("\timulq\t%%r13, %%rdi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, %%rdi")
+	emitCode("\tmovq\t0(%%rbx), %%rsi")
+	emitCode("\tmovq\t8(%%rbx), %%rcx")
+	emitCode("\timulq\t%%r13, %%rcx")
+	emitCode("\trep movsb")
+	emitCode("\tmovq\t%%rax, 0(%%rbx)")
+	emitCode("\tmovq\t%%r12, 16(%%rbx)")
+	emitLabel(done)
+	emitCode("\tmovq\t%%r14, 8(%%rbx)")
+	emitCode("\tpopq\t%%r14")
+	emitCode("\tpopq\t%%r13")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// append the elements of the slice header at %rsi to the one at %rdi,
+// the elements are of %rdx bytes
+func emitRuntimeAppendslice() {
+	emitCode("_runtime_appendslice:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tpushq\t%%r13")
+	emitCode("\tpushq\t%%r14")
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovq\t%%rdx, %%r13")
+	// the source may be the same array, its header is read before growing
+	emitCode("\tmovq\t0(%%rsi), %%r12")
+	emitCode("\tmovq\t8(%%rsi), %%r14")
+	emitCode("\tmovq\t%%r14, %%rsi")
+	emitCode("\tcallq\t_runtime_growslice")
+	emitCode("\tmovq\t8(%%rbx), %%rdi")
+	emitCode("\tsubq\t%%r14, %%rdi")
+	emitCode("\timulq\t%%r13, %%rdi")
+	emitCode("\taddq\t0(%%rbx), %%rdi")
+	emitCode("\tmovq\t%%r12, %%rsi")
+	emitCode("\tmovq\t%%r14, %%rdx")
+	emitCode("\timulq\t%%r13, %%rdx")
+	emitCode("\tcallq\t_memmove")
+	emitCode("\tpopq\t%%r14")
+	emitCode("\tpopq\t%%r13")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// copy the elements of the slice header at %rsi to the one at %rdi,
+// the elements are of %rdx bytes. the number of them is returned in %rax
+func emitRuntimeSlicecopy() {
+	emitCode("_runtime_slicecopy:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tmovq\t8(%%rdi), %%rax")
+	emitCode("\tcmpq\t8(%%rsi), %%rax")
+	emitCode("\tcmovaq\t8(%%rsi), %%rax")
+	emitCode("\tpushq\t%%rax")
+	emitCode("\tsubq\t$8, %%rsp")
+	emitCode("\timulq\t%%rax, %%rdx")
+	emitCode("\tmovq\t0(%%rdi), %%rdi")
+	emitCode("\tmovq\t0(%%rsi), %%rsi")
+	emitCode("\tcallq\t_memmove")
+	emitCode("\tmovq\t-8(%%rbp), %%rax")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// concatenate the strings at %rdi and %rsi,
+// the address of the new string header is returned in %rax
+func emitRuntimeConcatstrings() {
+	emitCode("_runtime_concatstrings:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tpushq\t%%r13")
+	emitCode("\tpushq\t%%r14")
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovq\t%%rsi, %%r12")
+	emitCode("\tmovq\t8(%%rbx), %%r13")
+	emitCode("\taddq\t8(%%r12), %%r13")
+	emitCode("\tmovl\t$16, %%edi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, %%r14")
+	emitCode("\tmovq\t%%r13, %%rdi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, 0(%%r14)")
+	emitCode("\tmovq\t%%r13, 8(%%r14)")
+	emitCode("\tmovq\t%%rax, %%rdi")
+	emitCode("\tmovq\t0(%%rbx), %%rsi")
+	emitCode("\tmovq\t8(%%rbx), %%rcx")
+	emitCode("\trep movsb")
+	emitCode("\tmovq\t0(%%r12), %%rsi")
+	emitCode("\tmovq\t8(%%r12), %%rcx")
+	emitCode("\trep movsb")
+	emitCode("\tmovq\t%%r14, %%rax")
+	emitCode("\tpopq\t%%r14")
+	emitCode("\tpopq\t%%r13")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// compare the strings at %rdi and %rsi by their bytes,
+// %rax is returned negative, zero or positive
+func emitRuntimeCmpstring() {
+	differ := makeLabel()
+	done := makeLabel()
+	emitCode("_runtime_cmpstring:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovq\t%%rsi, %%r12")
+	emitCode("\tmovq\t8(%%rbx), %%rdx")
+	emitCode("\tcmpq\t8(%%r12), %%rdx")
+	emitCode("\tcmovaq\t8(%%r12), %%rdx")
+	emitCode("\tmovq\t0(%%rbx), %%rdi")
+	emitCode("\tmovq\t0(%%r12), %%rsi")
+	emitCode("\tcallq\t_memcmp")
+	emitCode("\ttestl\t%%eax, %%eax")
+	emitCode("\tjne\t%s", differ)
+	// the shorter one is a prefix of the other
+	emitCode("\tmovq\t8(%%rbx), %%rax")
+	emitCode("\tsubq\t8(%%r12), %%rax")
+	emitCode("\tjmp\t%s", done)
+	emitLabel(differ)
+	emitCode("\tmovslq\t%%eax, %%rax")
+	emitLabel(done)
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// copy the string at %rdi with a terminating NUL for C functions,
+// the address of the bytes is returned in %rax
+func emitRuntimeCstring() {
+	emitCode("_runtime_cstring:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tmovq\t0(%%rdi), %%rbx")
+	emitCode("\tmovq\t8(%%rdi), %%r12")
+	emitCode("\tleaq\t1(%%r12), %%rdi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, %%rdi")
+	emitCode("\tmovq\t%%rbx, %%rsi")
+	emitCode("\tmovq\t%%r12, %%rcx")
+	emitCode("\trep movsb")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// copy the bytes of the string or the slice at %rdi to a new one,
+// whose header is of headerSize bytes. the address of the header is returned in %rax
+func emitRuntimeCopybytes(name string, headerSize int) {
+	emitCode("%s:", name)
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tpushq\t%%r13")
+	emitCode("\tpushq\t%%r14")
+	emitCode("\tmovq\t0(%%rdi), %%rbx")
+	emitCode("\tmovq\t8(%%rdi), %%r12")
+	emitCode("\tmovl\t$%d, %%edi", headerSize)
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, %%r14")
+	emitCode("\tmovq\t%%r12, %%rdi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, 0(%%r14)")
+	emitCode("\tmovq\t%%r12, 8(%%r14)")
+	if headerSize > 16 {
+		// the capacity of a slice
+		emitCode("\tmovq\t%%r12, 16(%%r14)")
+	}
+	emitCode("\tmovq\t%%rax, %%rdi")
+	emitCode("\tmovq\t%%rbx, %%rsi")
+	emitCode("\tmovq\t%%r12, %%rcx")
+	emitCode("\trep movsb")
+	emitCode("\tmovq\t%%r14, %%rax")
+	emitCode("\tpopq\t%%r14")
+	emitCode("\tpopq\t%%r13")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// decode the UTF-8 sequence at %rdi of %rsi bytes, at least one.
+// the rune is returned in %rax and its width in %rdx,
+// an invalid sequence is U+FFFD of one byte
+func emitRuntimeDecoderune() {
+	two := makeLabel()
+	three := makeLabel()
+	four := makeLabel()
+	continuation := makeLabel()
+	loop := makeLabel()
+	invalid := makeLabel()
+	done := makeLabel()
+	emitCode("_runtime_decoderune:")
+	emitCode("\tmovzbl\t0(%%rdi), %%eax")
+	emitCode("\tmovl\t$1, %%edx")
+	emitCode("\tcmpl\t$0x80, %%eax")
+	emitCode("\tjb\t%s", done)
+	emitCode("\tcmpl\t$0xc2, %%eax")
+	emitCode("\tjb\t%s", invalid)
+	emitCode("\tcmpl\t$0xe0, %%eax")
+	emitCode("\tjb\t%s", two)
+	emitCode("\tcmpl\t$0xf0, %%eax")
+	emitCode("\tjb\t%s", three)
+	emitCode("\tcmpl\t$0xf5, %%eax")
+	emitCode("\tjb\t%s", four)
+	emitCode("\tjmp\t%s", invalid)
+	// %r8 and %r9 are the bounds of the second byte,
+	// which exclude overlong forms, surrogates and runes above U+10FFFF
+	emitLabel(two)
+	emitCode("\tandl\t$0x1f, %%eax")
+	emitCode("\tmovl\t$2, %%edx")
+	emitCode("\tmovl\t$0x80, %%r8d")
+	emitCode("\tmovl\t$0xbf, %%r9d")
+	emitCode("\tjmp\t%s", continuation)
+	emitLabel(three)
+	emitCode("\tmovl\t$0x80, %%r8d")
+	emitCode("\tmovl\t$0xbf, %%r9d")
+	emitCode("\tmovl\t$0xa0, %%r10d")
+	emitCode("\tcmpl\t$0xe0, %%eax")
+	emitCode("\tcmovel\t%%r10d, %%r8d")
+	emitCode("\tmovl\t$0x9f, %%r10d")
+	emitCode("\tcmpl\t$0xed, %%eax")
+	emitCode("\tcmovel\t%%r10d, %%r9d")
+	emitCode("\tandl\t$0x0f, %%eax")
+	emitCode("\tmovl\t$3, %%edx")
+	emitCode("\tjmp\t%s", continuation)
+	emitLabel(four)
+	emitCode("\tmovl\t$0x80, %%r8d")
+	emitCode("\tmovl\t$0xbf, %%r9d")
+	emitCode("\tmovl\t$0x90, %%r10d")
+	emitCode("\tcmpl\t$0xf0, %%eax")
+	emitCode("\tcmovel\t%%r10d, %%r8d")
+	emitCode("\tmovl\t$0x8f, %%r10d")
+	emitCode("\tcmpl\t$0xf4, %%eax")
+	emitCode("\tcmovel\t%%r10d, %%r9d")
+	emitCode("\tandl\t$0x07, %%eax")
+	emitCode("\tmovl\t$4, %%edx")
+	emitLabel(continuation)
+	emitCode("\tcmpq\t%%rdx, %%rsi")
+	emitCode("\tjb\t%s", invalid)
+	emitCode("\tmovzbl\t1(%%rdi), %%ecx")
+	emitCode("\tcmpl\t%%r8d, %%ecx")
+	emitCode("\tjb\t%s", invalid)
+	emitCode("\tcmpl\t%%r9d, %%ecx")
+	emitCode("\tja\t%s", invalid)
+	emitCode("\tmovl\t$1, %%r11d")
+	emitLabel(loop)
+	emitCode("\tmovzbl\t(%%rdi,%%r11), %%ecx")
+	emitCode("\tmovl\t%%ecx, %%r10d")
+	emitCode("\tandl\t$0xc0, %%r10d")
+	emitCode("\tcmpl\t$0x80, %%r10d")
+	emitCode("\tjne\t%s", invalid)
+	emitCode("\tshll\t$6, %%eax")
+	emitCode("\tandl\t$0x3f, %%ecx")
+	emitCode("\torl\t%%ecx, %%eax")
+	emitCode("\tincq\t%%r11")
+	emitCode("\tcmpq\t%%rdx, %%r11")
+	emitCode("\tjb\t%s", loop)
+	emitCode("\tret")
+	emitLabel(invalid)
+	emitCode("\tmovl\t$0xfffd, %%eax")
+	emitCode("\tmovl\t$1, %%edx")
+	emitLabel(done)
+	emitCode("\tret")
+}
+
+// encode the rune in %rsi as UTF-8 to %rdi, the width is returned in %rax.
+// a rune out of range or a surrogate is encoded as U+FFFD
+func emitRuntimeEncoderune() {
+	valid := makeLabel()
+	invalid := makeLabel()
+	two := makeLabel()
+	three := makeLabel()
+	four := makeLabel()
+	emitCode("_runtime_encoderune:")
+	emitCode("\tmovq\t%%rsi, %%rax")
+	// negative runes are above U+10FFFF as unsigned
+	emitCode("\tcmpq\t$0x10ffff, %%rax")
+	emitCode("\tja\t%s", invalid)
+	emitCode("\tmovq\t%%rax, %%rcx")
+	emitCode("\tandq\t$-2048, %%rcx")
+	emitCode("\tcmpq\t$0xd800, %%rcx")
+	emitCode("\tjne\t%s", valid)
+	emitLabel(invalid)
+	emitCode("\tmovl\t$0xfffd, %%eax")
+	emitLabel(valid)
+	emitCode("\tcmpq\t$0x80, %%rax")
+	emitCode("\tjae\t%s", two)
+	emitCode("\tmovb\t%%al, 0(%%rdi)")
+	emitCode("\tmovl\t$1, %%eax")
+	emitCode("\tret")
+	emitLabel(two)
+	emitCode("\tcmpq\t$0x800, %%rax")
+	emitCode("\tjae\t%s", three)
+	emitEncodeByte(6, 0xc0, 0)
+	emitEncodeByte(0, 0x80, 1)
+	emitCode("\tmovl\t$2, %%eax")
+	emitCode("\tret")
+	emitLabel(three)
+	emitCode("\tcmpq\t$0x10000, %%rax")
+	emitCode("\tjae\t%s", four)
+	emitEncodeByte(12, 0xe0, 0)
+	emitEncodeByte(6, 0x80, 1)
+	emitEncodeByte(0, 0x80, 2)
+	emitCode("\tmovl\t$3, %%eax")
+	emitCode("\tret")
+	emitLabel(four)
+	emitEncodeByte(18, 0xf0, 0)
+	emitEncodeByte(12, 0x80, 1)
+	emitEncodeByte(6, 0x80, 2)
+	emitEncodeByte(0, 0x80, 3)
+	emitCode("\tmovl\t$4, %%eax")
+	emitCode("\tret")
+}
+
+// store the bits of the rune in %rax from the shift with the prefix to the offset of %rdi,
+// the prefix of a continuation byte takes the six bits below the shift
+func emitEncodeByte(shift int, prefix int, offset int) {
+	emitCode("\tmovl\t%%eax, %%ecx")
+	if shift > 0 {
+		emitCode("\tshrl\t$%d, %%ecx", shift)
+	}
+	if prefix == 0x80 {
+		emitCode("\tandl\t$0x3f, %%ecx")
+	}
+	emitCode("\torl\t$0x%x, %%ecx", prefix)
+	emitCode("\tmovb\t%%cl, %d(%%rdi)", offset)
+}
+
+// convert the rune in %rdi to a string,
+// the address of the string header is returned in %rax
+func emitRuntimeIntstring() {
+	emitCode("_runtime_intstring:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovl\t$16, %%edi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, %%r12")
+	emitCode("\tmovl\t$4, %%edi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, 0(%%r12)")
+	emitCode("\tmovq\t%%rax, %%rdi")
+	emitCode("\tmovq\t%%rbx, %%rsi")
+	emitCode("\tcallq\t_runtime_encoderune")
+	emitCode("\tmovq\t%%rax, 8(%%r12)")
+	emitCode("\tmovq\t%%r12, %%rax")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// decode the string at %rdi to a slice of runes,
+// the address of the slice header is returned in %rax
+func emitRuntimeStringtoslicerune() {
+	loop := makeLabel()
+	done := makeLabel()
+	emitCode("_runtime_stringtoslicerune:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tpushq\t%%r13")
+	emitCode("\tpushq\t%%r14")
+	emitCode("\tmovq\t0(%%rdi), %%rbx")
+	emitCode("\tmovq\t8(%%rdi), %%r12")
+	emitCode("\tmovl\t$24, %%edi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, %%r14")
+	// no more runes than bytes
+	emitCode("\tleaq\t0(,%%r12,4), %%rdi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, 0(%%r14)")
+	emitCode("\tmovq\t%%rax, %%r13")
+	emitLabel(loop)
+	emitCode("\ttestq\t%%r12, %%r12")
+	emitCode("\tjz\t%s", done)
+	emitCode("\tmovq\t%%rbx, %%rdi")
+	emitCode("\tmovq\t%%r12, %%rsi")
+	emitCode("\tcallq\t_runtime_decoderune")
+	emitCode("\tmovl\t%%eax, 0(%%r13)")
+	emitCode("\taddq\t$4, %%r13")
+	emitCode("\taddq\t%%rdx, %%rbx")
+	emitCode("\tsubq\t%%rdx, %%r12")
+	emitCode("\tjmp\t%s", loop)
+	emitLabel(done)
+	emitCode("\tsubq\t0(%%r14), %%r13")
+	emitCode("\tshrq\t$2, %%r13")
+	emitCode("\tmovq\t%%r13, 8(%%r14)")
+	emitCode("\tmovq\t%%r13, 16(%%r14)")
+	emitCode("\tmovq\t%%r14, %%rax")
+	emitCode("\tpopq\t%%r14")
+	emitCode("\tpopq\t%%r13")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// encode the slice of runes at %rdi to a string,
+// the address of the string header is returned in %rax
+func emitRuntimeSlicerunetostring() {
+	loop := makeLabel()
+	done := makeLabel()
+	emitCode("_runtime_slicerunetostring:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tpushq\t%%r13")
+	emitCode("\tpushq\t%%r14")
+	emitCode("\tmovq\t0(%%rdi), %%rbx")
+	emitCode("\tmovq\t8(%%rdi), %%r12")
+	emitCode("\tmovl\t$16, %%edi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, %%r14")
+	// no more than four bytes for a rune
+	emitCode("\tleaq\t0(,%%r12,4), %%rdi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, 0(%%r14)")
+	emitCode("\txorl\t%%r13d, %%r13d")
+	emitLabel(loop)
+	emitCode("\ttestq\t%%r12, %%r12")
+	emitCode("\tjz\t%s", done)
+	emitCode("\tmovq\t0(%%r14), %%rdi")
+	emitCode("\taddq\t%%r13, %%rdi")
+	emitCode("\tmovslq\t0(%%rbx), %%rsi")
+	emitCode("\tcallq\t_runtime_encoderune")
+	emitCode("\taddq\t%%rax, %%r13")
+	emitCode("\taddq\t$4, %%rbx")
+	emitCode("\tdecq\t%%r12")
+	emitCode("\tjmp\t%s", loop)
+	emitLabel(done)
+	emitCode("\tmovq\t%%r13, 8(%%r14)")
+	emitCode("\tmovq\t%%r14, %%rax")
+	emitCode("\tpopq\t%%r14")
+	emitCode("\tpopq\t%%r13")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// find the itab for the type descriptor %rsi in the table of an interface at %rdi.
+// the itab is returned in %rax, or 0 with the name of the missing method in %rdx
+func emitRuntimeLookupitab() {
+	loop := makeLabel()
+	found := makeLabel()
+	emitCode("_runtime_lookupitab:")
+	emitCode("\tmovq\t0(%%rdi), %%rcx")
+	emitCode("\taddq\t$8, %%rdi")
+	emitLabel(loop)
+	emitCode("\tcmpq\t%%rsi, 0(%%rdi)")
+	emitCode("\tje\t%s", found)
+	emitCode("\taddq\t$24, %%rdi")
+	emitCode("\tdecq\t%%rcx")
+	emitCode("\tjnz\t%s", loop)
+	// every dynamic type has an entry
+	emitCode("\tud2")
+	emitLabel(found)
+	emitCode("\tmovq\t8(%%rdi), %%rax")
+	emitCode("\tmovq\t16(%%rdi), %%rdx")
+	emitCode("\tret")
+}
+
+// panic for a failed type assertion. %rdi is the name of the static type, %rsi the descriptor
+// of the dynamic type or 0, %rdx the name of the asserted type, %rcx the position,
+// and %r8 the name of the method the dynamic type does not have or 0
+func emitRuntimePanicassert() {
+	notNil := makeLabel()
+	otherType := makeLabel()
+	emitCode("_runtime_panicassert:")
+	emitCode("\ttestq\t%%rsi, %%rsi")
+	emitCode("\tjne\t%s", notNil)
+	emitCode("\tleaq\t%s(%%rip), %%rdi", runtimeErrorAssertNil)
+	emitCode("\tmovq\t%%rdx, %%rsi")
+	emitCode("\tjmp\t_runtime_throw")
+	emitLabel(notNil)
+	emitCode("\ttestq\t%%r8, %%r8")
+	emitCode("\tje\t%s", otherType)
+	emitCode("\tleaq\t%s(%%rip), %%rdi", runtimeErrorAssertMethod)
+	emitCode("\tmovq\t0(%%rsi), %%rsi")
+	emitCode("\tjmp\t_runtime_throw")
+	emitLabel(otherType)
+	emitCode("\tmovq\t%%rdx, %%r8")
+	emitCode("\tmovq\t0(%%rsi), %%rdx")
+	emitCode("\tmovq\t%%rdi, %%rsi")
+	emitCode("\tleaq\t%s(%%rip), %%rdi", runtimeErrorAssertType)
+	emitCode("\tjmp\t_runtime_throw")
+}
+
+// compare the interface values at %rdi and %rsi, whose first words are itabs if %rdx is not 0.
+// %rax is returned 1 if they are equal. the values of the same uncomparable type
+// panic at the position in %rcx, which is passed to the equality routine of the type
+func emitRuntimeIfaceeq() {
+	equal := makeLabel()
+	notEqual := makeLabel()
+	descriptor := makeLabel()
+	comparable := makeLabel()
+	done := makeLabel()
+	emitCode("_runtime_ifaceeq:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tmovq\t0(%%rdi), %%rax")
+	emitCode("\tcmpq\t0(%%rsi), %%rax")
+	emitCode("\tjne\t%s", notEqual)
+	emitCode("\ttestq\t%%rax, %%rax")
+	emitCode("\tje\t%s", equal)
+	emitCode("\ttestq\t%%rdx, %%rdx")
+	emitCode("\tje\t%s", descriptor)
+	emitCode("\tmovq\t0(%%rax), %%rax")
+	emitLabel(descriptor)
+	emitCode("\tcmpq\t$0, 8(%%rax)")
+	emitCode("\tjne\t%s", comparable)
+	emitCode("\tmovq\t0(%%rax), %%rsi")
+	emitCode("\tleaq\t%s(%%rip), %%rdi", runtimeErrorUncomparable)
+	emitCode("\tcallq\t_runtime_panic")
+	emitLabel(comparable)
+	emitCode("\tmovq\t8(%%rdi), %%rdi")
+	emitCode("\tmovq\t8(%%rsi), %%rsi")
+	emitCode("\tmovq\t%%rcx, %%rdx")
+	emitCode("\tcallq\t*8(%%rax)")
+	emitCode("\tjmp\t%s", done)
+	emitLabel(equal)
+	emitCode("\tmovl\t$1, %%eax")
+	emitCode("\tjmp\t%s", done)
+	emitLabel(notEqual)
+	emitCode("\txorl\t%%eax, %%eax")
+	emitLabel(done)
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// the hash of %rsi bytes at %rdi with the seed in %rdx is returned in %rax,
+// by FNV-1a with the bits of the top folded into the bottom ones used for the buckets
+func emitRuntimeMemhash() {
+	loop := makeLabel()
+	done := makeLabel()
+	emitCode("_runtime_memhash:")
+	emitCode("\tmovabsq\t$-3750763034362895579, %%rax")
+	emitCode("\txorq\t%%rdx, %%rax")
+	emitCode("\tmovabsq\t$1099511628211, %%rcx")
+	emitLabel(loop)
+	emitCode("\ttestq\t%%rsi, %%rsi")
+	emitCode("\tje\t%s", done)
+	emitCode("\tmovzbq\t0(%%rdi), %%rdx")
+	emitCode("\txorq\t%%rdx, %%rax")
+	emitCode("\timulq\t%%rcx, %%rax")
+	emitCode("\tincq\t%%rdi")
+	emitCode("\tdecq\t%%rsi")
+	emitCode("\tjmp\t%s", loop)
+	emitLabel(done)
+	emitCode("\tmovq\t%%rax, %%rdx")
+	emitCode("\tshrq\t$29, %%rdx")
+	emitCode("\txorq\t%%rdx, %%rax")
+	emitCode("\tret")
+}
+
+// the hash of the bytes of the string at %rdi with the seed in %rsi is returned in %rax
+func emitRuntimeStrhash() {
+	emitCode("_runtime_strhash:")
+	emitCode("\tmovq\t%%rsi, %%rdx")
+	emitCode("\tmovq\t8(%%rdi), %%rsi")
+	emitCode("\tmovq\t0(%%rdi), %%rdi")
+	emitCode("\tjmp\t_runtime_memhash")
+}
+
+// the header of a map, which a map value points to:
+//	0: the number of the entries
+//	8: the array of the buckets, each of which is a list of the entries
+//	16: the number of the buckets, a power of two
+//	24: the seed of the hashes, so the order of iterations differs between runs
+//	32: the descriptor of the map type, see mapDescriptor
+// an entry is allocated for each key, and never moved:
+//	0: the next entry in the bucket
+//	8: the hash of the key
+//	16: 1 when the entry is deleted, so the iterations over a snapshot skip it
+//	24: the key, followed by the value at the offset in the descriptor
+
+const (
+	mapBucketsMinimum = 8
+	mapEntryKey       = 24
+)
+
+// make a map of the descriptor at %rdi with room for %rsi entries,
+// the address of the new header is returned in %rax
+func emitRuntimeMakemap() {
+	loop := makeLabel()
+	done := makeLabel()
+	emitCode("_runtime_makemap:")
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovq\t$%d, %%r12", mapBucketsMinimum)
+	emitLabel(loop)
+	emitCode("\tcmpq\t%%rsi, %%r12")
+	emitCode("\tjge\t%s", done)
+	emitCode("\tshlq\t$1, %%r12")
+	emitCode("\tjmp\t%s", loop)
+	emitLabel(done)
+	emitCode("\tmovl\t$40, %%edi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rbx, 32(%%rax)")
+	emitCode("\tmovq\t%%r12, 16(%%rax)")
+	emitCode("\tmovq\t%%rax, %%rbx")
+	emitCode("\trdtsc")
+	emitCode("\tshlq\t$32, %%rdx")
+	emitCode("\torq\t%%rdx, %%rax")
+	emitCode("\tmovq\t%%rax, 24(%%rbx)")
+	emitCode("\tleaq\t0(,%%r12,8), %%rdi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, 8(%%rbx)")
+	emitCode("\tmovq\t%%rbx, %%rax")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// find the entry of the key at %r12 in the map at %rbx, it is returned in %rax or 0.
+// the hash of the key is returned in %r13, and the address of its bucket in %r14
+func emitRuntimeMapfind() {
+	loop := makeLabel()
+	next := makeLabel()
+	done := makeLabel()
+	emitCode(".runtime_mapfind:")
+	emitCode("\tsubq\t$8, %%rsp")
+	emitCode("\tmovq\t32(%%rbx), %%rax")
+	emitCode("\tmovq\t%%r12, %%rdi")
+	emitCode("\tmovq\t24(%%rbx), %%rsi")
+	emitCode("\tcallq\t*24(%%rax)")
+	emitCode("\tmovq\t%%rax, %%r13")
+	emitCode("\tmovq\t16(%%rbx), %%rcx")
+	emitCode("\tdecq\t%%rcx")
+	emitCode("\tandq\t%%r13, %%rcx")
+	emitCode("\tmovq\t8(%%rbx), %%r14")
+	emitCode("\tleaq\t(%%r14,%%rcx,8), %%r14")
+	emitCode("\tmovq\t0(%%r14), %%rax")
+	emitLabel(loop)
+	emitCode("\ttestq\t%%rax, %%rax")
+	emitCode("\tje\t%s", done)
+	emitCode("\tcmpq\t8(%%rax), %%r13")
+	emitCode("\tjne\t%s", next)
+	emitCode("\tpushq\t%%rax")
+	emitCode("\tpushq\t%%rax")
+	emitCode("\tleaq\t%d(%%rax), %%rdi", mapEntryKey)
+	emitCode("\tmovq\t%%r12, %%rsi")
+	emitCode("\tmovq\t32(%%rbx), %%rcx")
+	emitCode("\tcallq\t*32(%%rcx)")
+	emitCode("\tmovq\t%%rax, %%rdx")
+	emitCode("\tpopq\t%%rax")
+	emitCode("\tpopq\t%%rax")
+	emitCode("\ttestq\t%%rdx, %%rdx")
+	emitCode("\tjne\t%s", done)
+	emitLabel(next)
+	emitCode("\tmovq\t0(%%rax), %%rax")
+	emitCode("\tjmp\t%s", loop)
+	emitLabel(done)
+	emitCode("\taddq\t$8, %%rsp")
+	emitCode("\tret")
+}
+
+func emitMapRoutinePrologue(name string) {
+	emitCode("%s:", name)
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	emitCode("\tpushq\t%%r12")
+	emitCode("\tpushq\t%%r13")
+	emitCode("\tpushq\t%%r14")
+}
+
+func emitMapRoutineEpilogue() {
+	emitCode("\tpopq\t%%r14")
+	emitCode("\tpopq\t%%r13")
+	emitCode("\tpopq\t%%r12")
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// the address of the value of the key at %rsi in the map at %rdi is returned in %rax,
+// or 0 when the key is not in the map or the map is nil
+func emitRuntimeMapaccess() {
+	done := makeLabel()
+	emitMapRoutinePrologue("_runtime_mapaccess")
+	emitCode("\txorl\t%%eax, %%eax")
+	emitCode("\ttestq\t%%rdi, %%rdi")
+	emitCode("\tje\t%s", done)
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovq\t%%rsi, %%r12")
+	emitCode("\tcallq\t.runtime_mapfind")
+	emitCode("\ttestq\t%%rax, %%rax")
+	emitCode("\tje\t%s", done)
+	emitCode("\tmovq\t32(%%rbx), %%rcx")
+	emitCode("\taddq\t8(%%rcx), %%rax")
+	emitLabel(done)
+	emitMapRoutineEpilogue()
+}
+
+// the address of the value of the key at %rsi in the map at %rdi is returned in %rax,
+// a new entry with the zero value is added when the key is not in the map.
+// the map grows to twice the buckets when the entries outnumber them.
+// assigning to a nil map panics at the position in %rdx
+func emitRuntimeMapassign() {
+	notNil := makeLabel()
+	insert := makeLabel()
+	found := makeLabel()
+	emitMapRoutinePrologue("_runtime_mapassign")
+	emitCode("\ttestq\t%%rdi, %%rdi")
+	emitCode("\tjne\t%s", notNil)
+	emitCode("\tleaq\t%s(%%rip), %%rdi", runtimeErrorNilMap)
+	emitCode("\tmovq\t%%rdx, %%rcx")
+	emitCode("\tcallq\t_runtime_throw")
+	emitLabel(notNil)
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovq\t%%rsi, %%r12")
+	emitCode("\tcallq\t.runtime_mapfind")
+	emitCode("\ttestq\t%%rax, %%rax")
+	emitCode("\tjne\t%s", found)
+	emitCode("\tmovq\t0(%%rbx), %%rax")
+	emitCode("\tcmpq\t16(%%rbx), %%rax")
+	emitCode("\tjl\t%s", insert)
+	emitCode("\tcallq\t.runtime_mapgrow")
+	emitCode("\tmovq\t16(%%rbx), %%rcx")
+	emitCode("\tdecq\t%%rcx")
+	emitCode("\tandq\t%%r13, %%rcx")
+	emitCode("\tmovq\t8(%%rbx), %%r14")
+	emitCode("\tleaq\t(%%r14,%%rcx,8), %%r14")
+	emitLabel(insert)
+	emitCode("\tmovq\t32(%%rbx), %%rax")
+	emitCode("\tmovq\t16(%%rax), %%rdi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%r13, 8(%%rax)")
+	emitCode("\tmovq\t0(%%r14), %%rcx")
+	emitCode("\tmovq\t%%rcx, 0(%%rax)")
+	emitCode("\tmovq\t%%rax, 0(%%r14)")
+	emitCode("\tincq\t0(%%rbx)")
+	emitCode("\tmovq\t%%rax, %%r13")
+	emitCode("\tleaq\t%d(%%rax), %%rdi", mapEntryKey)
+	emitCode("\tmovq\t%%r12, %%rsi")
+	emitCode("\tmovq\t32(%%rbx), %%rcx")
+	emitCode("\tmovq\t0(%%rcx), %%rcx")
+	emitCode("\trep movsb")
+	emitCode("\tmovq\t%%r13, %%rax")
+	emitLabel(found)
+	emitCode("\tmovq\t32(%%rbx), %%rcx")
+	emitCode("\taddq\t8(%%rcx), %%rax")
+	emitMapRoutineEpilogue()
+}
+
+// double the buckets of the map at %rbx, and link the entries into the new ones
+func emitRuntimeMapgrow() {
+	bucketLoop := makeLabel()
+	entryLoop := makeLabel()
+	nextBucket := makeLabel()
+	done := makeLabel()
+	emitCode(".runtime_mapgrow:")
+	emitCode("\tsubq\t$8, %%rsp")
+	emitCode("\tmovq\t16(%%rbx), %%rdi")
+	emitCode("\tshlq\t$4, %%rdi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t8(%%rbx), %%rsi")
+	emitCode("\tmovq\t16(%%rbx), %%rcx")
+	emitCode("\tleaq\t-1(%%rcx,%%rcx), %%r9")
+	emitCode("\tleaq\t(%%rcx,%%rcx), %%rdx")
+	emitCode("\tmovq\t%%rdx, 16(%%rbx)")
+	emitCode("\tmovq\t%%rax, 8(%%rbx)")
+	emitLabel(bucketLoop)
+	emitCode("\ttestq\t%%rcx, %%rcx")
+	emitCode("\tje\t%s", done)
+	emitCode("\tmovq\t0(%%rsi), %%rdx")
+	emitLabel(entryLoop)
+	emitCode("\ttestq\t%%rdx, %%rdx")
+	emitCode("\tje\t%s", nextBucket)
+	emitCode("\tmovq\t0(%%rdx), %%r10")
+	emitCode("\tmovq\t8(%%rdx), %%r11")
+	emitCode("\tandq\t%%r9, %%r11")
+	emitCode("\tmovq\t(%%rax,%%r11,8), %%r8")
+	emitCode("\tmovq\t%%r8, 0(%%rdx)")
+	emitCode("\tmovq\t%%rdx, (%%rax,%%r11,8)")
+	emitCode("\tmovq\t%%r10, %%rdx")
+	emitCode("\tjmp\t%s", entryLoop)
+	emitLabel(nextBucket)
+	emitCode("\taddq\t$8, %%rsi")
+	emitCode("\tdecq\t%%rcx")
+	emitCode("\tjmp\t%s", bucketLoop)
+	emitLabel(done)
+	emitCode("\taddq\t$8, %%rsp")
+	emitCode("\tret")
+}
+
+// delete the key at %rsi from the map at %rdi, if it is there
+func emitRuntimeMapdelete() {
+	loop := makeLabel()
+	unlink := makeLabel()
+	done := makeLabel()
+	emitMapRoutinePrologue("_runtime_mapdelete")
+	emitCode("\ttestq\t%%rdi, %%rdi")
+	emitCode("\tje\t%s", done)
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovq\t%%rsi, %%r12")
+	emitCode("\tcallq\t.runtime_mapfind")
+	emitCode("\ttestq\t%%rax, %%rax")
+	emitCode("\tje\t%s", done)
+	// the link to the entry is in the bucket or in the entry before it
+	emitLabel(loop)
+	emitCode("\tcmpq\t0(%%r14), %%rax")
+	emitCode("\tje\t%s", unlink)
+	emitCode("\tmovq\t0(%%r14), %%r14")
+	emitCode("\tjmp\t%s", loop)
+	emitLabel(unlink)
+	emitCode("\tmovq\t0(%%rax), %%rcx")
+	emitCode("\tmovq\t%%rcx, 0(%%r14)")
+	emitCode("\tmovq\t$1, 16(%%rax)")
+	emitCode("\tdecq\t0(%%rbx)")
+	emitLabel(done)
+	emitMapRoutineEpilogue()
+}
+
+// start an iteration over the map at %rdi. the entries are returned in an array at %rax,
+// and the number of them in %rdx. the array is a snapshot starting at a random entry,
+// so the entries added during the iteration are not visited
+func emitRuntimeMapiterinit() {
+	bucketLoop := makeLabel()
+	entryLoop := makeLabel()
+	nextBucket := makeLabel()
+	noWrap := makeLabel()
+	filled := makeLabel()
+	done := makeLabel()
+	emitMapRoutinePrologue("_runtime_mapiterinit")
+	emitCode("\txorl\t%%eax, %%eax")
+	emitCode("\txorl\t%%edx, %%edx")
+	emitCode("\ttestq\t%%rdi, %%rdi")
+	emitCode("\tje\t%s", done)
+	emitCode("\tmovq\t%%rdi, %%rbx")
+	emitCode("\tmovq\t0(%%rbx), %%r13")
+	emitCode("\ttestq\t%%r13, %%r13")
+	emitCode("\tje\t%s", done)
+	emitCode("\tleaq\t0(,%%r13,8), %%rdi")
+	emitCode("\tcallq\t_runtime_alloc")
+	emitCode("\tmovq\t%%rax, %%r12")
+	emitCode("\trdtsc")
+	emitCode("\tshlq\t$32, %%rdx")
+	emitCode("\torq\t%%rdx, %%rax")
+	emitCode("\txorl\t%%edx, %%edx")
+	emitCode("\tdivq\t%%r13")
+	emitCode("\tmovq\t%%rdx, %%r14")
+	emitCode("\tmovq\t8(%%rbx), %%rsi")
+	emitCode("\tmovq\t16(%%rbx), %%rcx")
+	emitLabel(bucketLoop)
+	emitCode("\ttestq\t%%rcx, %%rcx")
+	emitCode("\tje\t%s", filled)
+	emitCode("\tmovq\t0(%%rsi), %%rax")
+	emitLabel(entryLoop)
+	emitCode("\ttestq\t%%rax, %%rax")
+	emitCode("\tje\t%s", nextBucket)
+	emitCode("\tmovq\t%%rax, (%%r12,%%r14,8)")
+	emitCode("\tincq\t%%r14")
+	emitCode("\tcmpq\t%%r13, %%r14")
+	emitCode("\tjne\t%s", noWrap)
+	emitCode("\txorl\t%%r14d, %%r14d")
+	emitLabel(noWrap)
+	emitCode("\tmovq\t0(%%rax), %%rax")
+	emitCode("\tjmp\t%s", entryLoop)
+	emitLabel(nextBucket)
+	emitCode("\taddq\t$8, %%rsi")
+	emitCode("\tdecq\t%%rcx")
+	emitCode("\tjmp\t%s", bucketLoop)
+	emitLabel(filled)
+	emitCode("\tmovq\t%%r12, %%rax")
+	emitCode("\tmovq\t%%r13, %%rdx")
+	emitLabel(done)
+	emitMapRoutineEpilogue()
+}
@@ -1,64 +1,168 @@
 package main
 
-import ()
+import (
+	"fmt"
+)
 
 type Symbol interface {
 	emitLeftValue()
 	emitRightValue()
 	getName() string
+	getType() Type
 }
 
 type SymbolBase struct {
 	name  string
-	gtype string
-	size  int
+	gtype Type
 }
 
 /* ================================
  * LocalVariable
  *     implements Symbol
  * ================================ */
+// the slot of an escaping variable holds the address of its heap storage
 type LocalVariable struct {
-	offset int
+	offset   int
+	escapes  bool
+	function *FunctionDefinition // which declares it
 	SymbolBase
 }
 
 // implements Symbol
 func (lv *LocalVariable) emitRightValue() {
-	emitCode("\tpushq\t-%d(%%rbp)", lv.offset)
-	frameHeight += 8
+	if lv.escapes {
+		emitCode("\tmovq\t-%d(%%rbp), %%rax", lv.offset)
+		emitLoad(lv.gtype, "0(%rax)")
+		return
+	}
+	emitLoad(lv.gtype, fmt.Sprintf("-%d(%%rbp)", lv.offset))
 }
 
 // implements Symbol
 func (lv *LocalVariable) emitLeftValue() {
-	emitCode("\tleaq\t-%d(%%rbp), %%rax", lv.offset)
+	if lv.escapes {
+		emitCode("\tmovq\t-%d(%%rbp), %%rax", lv.offset)
+	} else {
+		emitCode("\tleaq\t-%d(%%rbp), %%rax", lv.offset)
+	}
 	emitCode("\tpushq\t%%rax")
 	frameHeight += 8
 }
 
+// set the variable to the zero value of its type,
+// an escaping variable gets new storage
+func (lv *LocalVariable) emitZero() {
+	if lv.escapes {
+		emitAllocate(lv.gtype.size())
+		emitCode("\tmovq\t%%rax, -%d(%%rbp)", lv.offset)
+		return
+	}
+	if isAggregate(lv.gtype) {
+		emitCode("\tleaq\t-%d(%%rbp), %%rdi", lv.offset)
+		emitCode("\tmovq\t$%d, %%rcx", lv.gtype.size())
+		emitCode("\txorl\t%%eax, %%eax")
+		emitCode("\trep stosb")
+		return
+	}
+	emitCode("\tleaq\t-%d(%%rbp), %%rax", lv.offset)
+	emitCode("\txorl\t%%ecx, %%ecx")
+	emitStore(lv.gtype)
+}
+
+// move a parameter passed in the frame to the heap,
+// an aggregate parameter is passed as the address of the caller's value
+func (lv *LocalVariable) emitMoveToHeap() {
+	emitAllocate(lv.gtype.size())
+	emitCode("\tmovq\t-%d(%%rbp), %%rcx", lv.offset)
+	emitCode("\tmovq\t%%rax, -%d(%%rbp)", lv.offset)
+	emitStore(lv.gtype)
+}
+
+// give an escaping variable new storage holding its current value,
+// closures created before keep the old one
+func (lv *LocalVariable) emitRenew() {
+	emitAllocate(lv.gtype.size())
+	emitCode("\tmovq\t-%d(%%rbp), %%rsi", lv.offset)
+	emitCode("\tmovq\t%%rax, -%d(%%rbp)", lv.offset)
+	emitCode("\tmovq\t%%rax, %%rdi")
+	emitCode("\tmovq\t$%d, %%rcx", lv.gtype.size())
+	emitCode("\trep movsb")
+}
+
 // implements Symbol
 func (lv *LocalVariable) getName() string {
 	return lv.name
 }
 
+// implements Symbol
+func (lv *LocalVariable) getType() Type {
+	return lv.gtype
+}
+
+/* ================================
+ * CapturedVariable
+ *     implements Symbol
+ * ================================ */
+// a variable of an enclosing function used in a func literal. the closure holds
+// the address of its heap storage at the index after the code, which is copied
+// from the outer symbol when the closure is made
+type CapturedVariable struct {
+	variable *LocalVariable
+	outer    Symbol
+	function *FunctionDefinition
+	index    int
+}
+
+// load the address of the storage into %rax
+func (cv *CapturedVariable) emitAddress() {
+	emitCode("\tmovq\t-%d(%%rbp), %%rax", cv.function.context.offset)
+	emitCode("\tmovq\t%d(%%rax), %%rax", 8+8*cv.index)
+}
+
+// implements Symbol
+func (cv *CapturedVariable) emitRightValue() {
+	cv.emitAddress()
+	emitLoad(cv.variable.gtype, "0(%rax)")
+}
+
+// implements Symbol
+func (cv *CapturedVariable) emitLeftValue() {
+	cv.emitAddress()
+	emitCode("\tpushq\t%%rax")
+	frameHeight += 8
+}
+
+// implements Symbol
+func (cv *CapturedVariable) getName() string {
+	return cv.variable.name
+}
+
+// implements Symbol
+func (cv *CapturedVariable) getType() Type {
+	return cv.variable.gtype
+}
+
 /* ================================
  * GlobalVariable
  *     implements Symbol
  * ================================ */
+// initval is nil for the zero value, and is the value of the constant expression init
 type GlobalVariable struct {
-	initval Constant
+	init    Ast
+	initval Constant // set by the checker
 	SymbolBase
 }
 
 // implements Symbol
 func (gv *GlobalVariable) emitRightValue() {
-	emitCode("\tpushq\t_%s(%%rip)", gv.name)
+	emitLoad(gv.gtype, fmt.Sprintf("_%s(%%rip)", gv.name))
 }
 
 // implements Symbol
 func (gv *GlobalVariable) emitLeftValue() {
 	// Global Offset Table
 	emitCode("\tpushq\t_%s@GOTPCREL(%%rip)", gv.name)
+	frameHeight += 8
 }
 
 // implements Symbol
@@ -66,16 +170,102 @@ func (gv *GlobalVariable) getName() string {
 	return gv.name
 }
 
+// implements Symbol
+func (gv *GlobalVariable) getType() Type {
+	return gv.gtype
+}
+
+/* ================================
+ * NamedConstant
+ *     implements Symbol
+ * ================================ */
+// the type is nil when it is the type of the value, which may be untyped
+type NamedConstant struct {
+	expr  Ast
+	value Constant // set by the checker
+	SymbolBase
+}
+
+// implements Symbol
+func (nc *NamedConstant) emitRightValue() {
+	nc.value.emitConstant(nc.gtype)
+}
+
+// implements Symbol
+func (nc *NamedConstant) emitLeftValue() {
+	putError("Cannot assign to constant %s.", nc.name)
+}
+
+// implements Symbol
+func (nc *NamedConstant) getName() string {
+	return nc.name
+}
+
+// implements Symbol
+func (nc *NamedConstant) getType() Type {
+	return nc.gtype
+}
+
+/* ================================
+ * FunctionSignature
+ * ================================ */
+type Parameter struct {
+	name  string
+	tok   *Token // of the name, if any
+	gtype Type
+}
+
+// the receiver of a method is nil for functions
+type FunctionSignature struct {
+	fname    string
+	tok      *Token // of the name, or of func of a literal
+	receiver *Parameter
+	params   []*Parameter
+	results  []*Parameter
+}
+
+var functionTable = make(map[string]*FunctionSignature)
+
+func findFunction(name string) *FunctionSignature {
+	return functionTable[name]
+}
+
+// the name in the assembly, a method M of T or *T is T.M,
+// as no type has both
+func (sig *FunctionSignature) label() string {
+	if sig.receiver == nil {
+		return sig.fname
+	}
+	return namedOf(sig.receiver.gtype).name + "." + sig.fname
+}
+
+func (sig *FunctionSignature) hasPointerReceiver() bool {
+	return isPointer(sig.receiver.gtype)
+}
+
+// the type of the function, or of the method with the receiver bound
+func (sig *FunctionSignature) funcType() *FuncType {
+	ft := &FuncType{}
+	for _, param := range sig.params {
+		ft.params = append(ft.params, param.gtype)
+	}
+	for _, result := range sig.results {
+		ft.results = append(ft.results, result.gtype)
+	}
+	return ft
+}
+
 /* ================================ */
 
 type Scope struct {
 	symenv map[string]Symbol
+	types  map[string]Type
 	outer  *Scope
-	offset int
 }
 
+// a type declared in an inner scope shadows the symbols of the same name
 func (sc *Scope) findSymbol(name string) Symbol {
-	for s := sc; s != nil; s = s.outer {
+	for s := sc; s != nil && s.types[name] == nil; s = s.outer {
 		sym := s.symenv[name]
 		if sym != nil {
 			return sym
@@ -90,7 +280,7 @@ func (sc *Scope) setSymbol(name string, sym Symbol) {
 }
 
 func (sc *Scope) isDeclaredSymbol(name string) bool {
-	for s := sc; s != nil; s = s.outer {
+	for s := sc; s != nil && s.types[name] == nil; s = s.outer {
 		sym := s.symenv[name]
 		if sym != nil {
 			return true
@@ -100,66 +290,55 @@ func (sc *Scope) isDeclaredSymbol(name string) bool {
 }
 
 func newLocalScope(outer *Scope) *Scope {
-	var offset int = 8
-	if outer.offset != -1 {
-		offset = outer.offset
-	}
 	return &Scope{
 		outer:  outer,
 		symenv: make(map[string]Symbol),
-		offset: offset,
+		types:  make(map[string]Type),
 	}
 }
 
 var globalScope *Scope = &Scope{
 	outer:  nil,
 	symenv: make(map[string]Symbol),
-	offset: -1,
+	types:  make(map[string]Type),
 }
 var currentScope *Scope
 
 /* ================================ */
 
-func makeSymbol(name string, gtype string) Symbol {
-	var size int = 8
+// gtype is nil when it is inferred from the initializer by the type checker
+func makeSymbol(tok *Token, gtype Type) Symbol {
+	name := tok.sval
 	var sym Symbol
-	switch gtype {
-	case "uint8", "int8", "byte", "bool":
-		size = 2
-	case "uint16", "int16":
-		size = 4
-	case "uint32", "int32", "uint", "int", "rune", "float":
-		size = 8
-	case "uint64", "int64", "uintptr", "double":
-		size = 16
-	}
-
 	if currentScope.outer == nil {
 		// global variable
 		sym = &GlobalVariable{
 			SymbolBase: SymbolBase{
 				name:  name,
 				gtype: gtype,
-				size:  size,
 			},
 		}
 	} else {
 		// local variable
 		sym = &LocalVariable{
+			function: currentFunction,
 			SymbolBase: SymbolBase{
 				name:  name,
 				gtype: gtype,
-				size:  size,
 			},
-			offset: currentScope.offset,
 		}
-		currentScope.offset += size
 	}
-	currentScope.setSymbol(name, sym)
+	declareSymbol(tok, sym)
 	return sym
 }
 
-var localVariableSpace int
+func declareSymbol(tok *Token, sym Symbol) {
+	name := tok.sval
+	if currentScope.symenv[name] != nil || currentScope.types[name] != nil {
+		putErrorAt(tok, "%s redeclared in this block.", name)
+	}
+	currentScope.setSymbol(name, sym)
+}
 
 func beginSymbolBlock() {
 	currentScope = newLocalScope(currentScope)
@@ -172,28 +351,78 @@ func endSymbolBlock() []*LocalVariable {
 	}
 	var lvs []*LocalVariable
 	for _, sym := range currentScope.symenv {
-		lvs = append(lvs, sym.(*LocalVariable))
-	}
-
-	if localVariableSpace < currentScope.offset-8 {
-		localVariableSpace = currentScope.offset - 8
+		if lv, ok := sym.(*LocalVariable); ok {
+			lvs = append(lvs, lv)
+		}
 	}
 	currentScope = currentScope.outer
 	return lvs
 }
 
+func getGlobalSymList() []*GlobalVariable {
+	var gvs []*GlobalVariable
+	for _, sym := range globalScope.symenv {
+		if gv, ok := sym.(*GlobalVariable); ok {
+			gvs = append(gvs, gv)
+		}
+	}
+	return gvs
+}
+
+/* ================================
+ * stack frame layout
+ *     done by the type checker, when the types of all locals are known
+ * ================================ */
+var frameOffset int
+var localVariableSpace int
+
 func beginFunction() {
+	frameOffset = 0
 	localVariableSpace = 0
 }
 
-func endFunction() int {
-	return localVariableSpace
+// parameters are pushed from the registers, each in a 8-byte slot
+func allocateParameter(lv *LocalVariable) {
+	frameOffset += 8
+	lv.offset = frameOffset
+	localVariableSpace = frameOffset
 }
 
-func getGlobalSymList() []*GlobalVariable {
-	var gvs []*GlobalVariable
-	for _, sym := range globalScope.symenv {
-		gvs = append(gvs, sym.(*GlobalVariable))
+// the slot can hold the address of the heap storage,
+// as the variable may be found escaping later in the checking
+func allocateLocalVariable(lv *LocalVariable) {
+	size, align := lv.gtype.size(), lv.gtype.align()
+	if size < 8 {
+		size = 8
 	}
-	return gvs
+	if align < 8 {
+		align = 8
+	}
+	frameOffset = alignTo(frameOffset+size, align)
+	lv.offset = frameOffset
+	if localVariableSpace < frameOffset {
+		localVariableSpace = frameOffset
+	}
+}
+
+// a word used by the generated code, which is not visible in the program
+func allocateHiddenVariable() *LocalVariable {
+	return allocateTemporary(tInt)
+}
+
+// the frame storage of a value of the generated code which does not escape,
+// like a composite literal. it is reused by the next statements of the block
+func allocateTemporary(t Type) *LocalVariable {
+	lv := &LocalVariable{
+		SymbolBase: SymbolBase{
+			gtype: t,
+		},
+	}
+	allocateLocalVariable(lv)
+	return lv
+}
+
+// the area is kept a multiple of 8 for the pushes after it
+func endFunction() int {
+	return alignTo(localVariableSpace, 8)
 }
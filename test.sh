@@ -22,6 +22,40 @@ function test {
 	fi
 }
 
+# the program is rejected with the message
+function test_error {
+	message="$2"
+	expr="$1"
+
+	if result="`echo "$expr" | ./${prog_name} - 2>&1 >/dev/null`"; then
+		echo "Test failed: $message expected but compiled"
+		exit 1
+	elif [[ "$result" != *"$message"* ]];then
+		echo "Test failed: $message expected but got $result"
+		exit 1
+	fi
+}
+
+function run_test_error {
+	# floats
+	test_error 'package main
+func main() {
+	var n uint = 3
+	var f float64 = 1 << n
+}' "Shifted operand of type float64 must be integer."
+	test_error 'package main
+func main() {
+	var n uint = 3
+	f := 2.5
+	f = f * (1 << n)
+}' "Shifted operand of type float64 must be integer."
+	test_error 'package main
+func sum(a, b, c, d, e, f, g int) {
+}
+func main() {
+}' "2:6: Too many parameters in sum."
+}
+
 function run_test_go {
 	make tmp.out
 	./out/tmp.out > ./out/actual.txt
@@ -29,5 +63,6 @@ function run_test_go {
 }
 
 run_test_go
+run_test_error
 
 echo "All tests passed"
@@ -60,6 +60,1146 @@ func f7 (a int) {
 	}
 }
 
+func f8 (a int, b int) {
+	if a < b {
+		printf ("%d\n", 1)
+	} else if a == b {
+		printf ("%d\n", 2)
+	} else {
+		printf ("%d\n", 3)
+	}
+	if a != b && !(a > b) || a >= 10 {
+		printf ("%d\n", a)
+	}
+	if b = b + 1; a <= b {
+		printf ("%d\n", b)
+	}
+}
+
+func f9 (n int) {
+	var sum int
+	var i int
+	for i = 0; i < n; i = i + 1 {
+		if i == 3 {
+			continue
+		}
+		sum = sum + i
+	}
+	printf ("%d\n", sum)
+	for sum > 5 {
+		sum = sum - 5
+	}
+	printf ("%d\n", sum)
+	for {
+		if sum == 0 {
+			break
+		}
+		sum = sum - 1
+	}
+	printf ("%d\n", sum)
+	var count int
+outer:
+	for i = 0; i < n; i = i + 1 {
+		var j int
+		for j = 0; ; j = j + 1 {
+			if j == i {
+				continue outer
+			}
+			if i == 4 {
+				break outer
+			}
+			count = count + 1
+		}
+	}
+	printf ("%d\n", count)
+}
+
+func fib (n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib (n - 1) + fib (n - 2)
+}
+
+func max (a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func f10 () {
+	var x int
+	x = max (3, 8) * 2
+	printf ("%d\n", x)
+	printf ("%d\n", fib (10) + max (1, 0))
+}
+
+func sumdiff (a int, b int) (int, int) {
+	return a + b, a - b
+}
+
+func minmax (a, b int) (lo, hi int) {
+	lo = a
+	hi = b
+	if a > b {
+		lo, hi = b, a
+	}
+	return
+}
+
+func forward (a int, b int) (int, int) {
+	return sumdiff (a, b)
+}
+
+func f11 () {
+	q, r := sumdiff (17, 5)
+	printf ("%d %d\n", q, r)
+	lo, hi := minmax (9, 4)
+	printf ("%d %d\n", lo, hi)
+	lo, hi = hi, lo
+	printf ("%d %d\n", lo, hi)
+	_, r = forward (23, 7)
+	q, s := forward (100, 9)
+	printf ("%d %d %d\n", q, r, s)
+}
+
+var (
+	ga = 7
+	gb, gc int = 8, 9
+)
+
+func f12 () {
+	x := 40
+	var y = x + 2
+	var (
+		z    int
+		u, v = sumdiff (y, 1)
+	)
+	printf ("%d %d %d %d %d\n", x, y, z, u, v)
+	{
+		x := 1
+		x, w := x + 1, 5
+		printf ("%d %d\n", x, w)
+	}
+	printf ("%d %d\n", x, ga + gb + gc)
+}
+
+func neg (x int8) int8 {
+	return 0 - x
+}
+
+func f13 () {
+	var small int8 = 100
+	var big int = 2000000000
+	var flag bool = small < 127
+	var u uint8 = 200
+	printf ("%d %ld %d %d\n", neg (small), big + big, flag, u)
+	if flag == (1 < 2) || !flag {
+		printf ("%d\n", small)
+	}
+}
+
+func f14 () {
+	var a int8 = 127
+	var b uint8 = 255
+	var c int32 = 2147483647
+	var d int = 2147483647
+	var e uint64 = 18446744073709551615
+	var f uint32 = 0
+	var g int16 = 300
+	a = a + 1
+	b = b + 1
+	c = c + 1
+	d = d + 1
+	f = f - 1
+	g = g * 300
+	printf ("%d %d %d %ld\n", a, b, c, d)
+	printf ("%lu %u %d\n", e + 1, f, g)
+	var h int8 = 100
+	h = h * 2
+	printf ("%d %d %lu\n", h, h / 3, e / 2)
+	var u uint8 = 200
+	var v uint8 = 100
+	printf ("%d %d %d\n", u > v, e > 1, a < 0)
+	var big uint64 = 3000000000
+	printf ("%lu\n", big * 4)
+}
+
+func f15 () {
+	var a int = 7
+	var b int = -2
+	printf ("%d %d %d %d\n", a / b, a % b, -a / 2, -a % 2)
+	printf ("%d %d %d %d %d\n", a & 3, a | 8, a ^ 5, a &^ 6, ^a)
+	printf ("%d %d %d\n", a << 2, -a >> 1, 1 + 2 * 3 << 1)
+	var m int64 = -9223372036854775807 - 1
+	var n int64 = -1
+	printf ("%ld %ld\n", m / n, m % n)
+	var s int8 = -128
+	var t int8 = -1
+	printf ("%d %d %d\n", s / t, s % t, -s)
+	var u uint8 = 240
+	var k uint = 65
+	printf ("%d %d %d %d\n", u >> 4, u << 1, ^u, u >> k)
+	printf ("%d %d %d\n", s >> k, a << k, +a - -b)
+	var w uint32 = 1
+	printf ("%u %d\n", w << 31, 5 | 2 ^ 1 & 3)
+}
+
+func f16 () {
+	var a int = 10
+	a += 5
+	a -= 3
+	a *= 4
+	a /= 5
+	a %= 7
+	printf ("%d\n", a)
+	var b uint8 = 250
+	b += 10
+	b <<= 2
+	b |= 1
+	b ^= 3
+	b &^= 16
+	b >>= 1
+	b &= 255
+	printf ("%d\n", b)
+	var sum int
+	for i := 0; i < 5; i++ {
+		sum += i
+	}
+	for j := 10; j > 0; j -= 3 {
+		sum--
+	}
+	gi++
+	printf ("%d %d\n", sum, gi)
+}
+
+func swap (a *int, b *int) {
+	var t int = *a
+	*a = *b
+	*b = t
+}
+
+func counter (start int) *int {
+	c := start
+	return &c
+}
+
+func bump (n int) int {
+	p := &n
+	*p += 10
+	return n
+}
+
+func f17 () {
+	var x int = 1
+	var y int = 2
+	swap (&x, &y)
+	printf ("%d %d\n", x, y)
+	p := counter (5)
+	q := counter (7)
+	*p += 1
+	(*q)++
+	printf ("%d %d %d\n", *p, *q, bump (1))
+	var np *int
+	printf ("%d %d %d\n", np == nil, p != nil, p == q)
+	r := new (int8)
+	*r = 127
+	*r += 1
+	pp := &r
+	**pp -= 1
+	printf ("%d\n", *r)
+	var s *int
+	for i := 0; i < 3; i++ {
+		v := i * 10
+		if i == 1 {
+			s = &v
+		}
+	}
+	printf ("%d\n", *s)
+}
+
+var garr [4]int16
+
+func sumArray (a [5]int) int {
+	var s int
+	for i := 0; i < len (a); i++ {
+		s += a[i]
+	}
+	a[0] = 100
+	return s
+}
+
+func makeArray (n int) [3]int {
+	var r [3]int
+	for i := 0; i < 3; i++ {
+		r[i] = n * i
+	}
+	return r
+}
+
+var order int
+
+func step (n int, v int) int {
+	order = order * 10 + n
+	return v
+}
+
+func f18 () {
+	var a [5]int
+	for i := 0; i < 5; i++ {
+		a[i] = i * i
+	}
+	b := a
+	b[0] = 7
+	printf ("%d %d %d\n", a[0], b[0], sumArray (a))
+	printf ("%d %d\n", a[0], len (b))
+	c := [...]int8{1, 2, 127}
+	c[2]++
+	m := makeArray (4)
+	printf ("%d %d %d %d\n", c[2], len (c), m[2], makeArray (5)[1])
+	var grid [2][3]int
+	grid[1][2] = 12
+	g2 := grid
+	g2[1] = [3]int{4, 5, 6}
+	printf ("%d %d %d\n", grid[1][2], g2[1][2], g2[1][0])
+	p := &a
+	p[1] = 11
+	garr[3] = 300
+	garr[2] += garr[3]
+	printf ("%d %d %d\n", a[1], garr[2], len (p))
+	x := [2]int{1, 2}
+	y := [2]int{3, 4}
+	x, y = y, x
+	printf ("%d %d\n", x[0], y[0])
+	a[step (1, 2)] = step (2, 9)
+	printf ("%d %d\n", order, a[2])
+}
+
+func sumSlice (s []int) int {
+	total := 0
+	for _, v := range s {
+		total += v
+	}
+	return total
+}
+
+func squares (n int) []int {
+	var s []int
+	for i := 0; i < n; i++ {
+		s = append (s, i * i)
+	}
+	return s
+}
+
+func f19 () {
+	s := make ([]int, 3, 5)
+	s[1] = 4
+	printf ("%d %d %d\n", len (s), cap (s), s[1])
+	s = append (s, 7, 8)
+	t := append (s, 9)
+	t[0] = 1
+	printf ("%d %d %d %d %d\n", len (s), len (t), cap (t), s[0], t[5])
+	u := s[1:4]
+	u[0] = 40
+	printf ("%d %d %d %d\n", len (u), cap (u), s[1], u[2])
+	v := s[2:3:4]
+	printf ("%d %d\n", len (v), cap (v))
+	var a [6]int16
+	w := a[2:]
+	w[1] = 33
+	printf ("%d %d %d\n", a[3], len (w), cap (w))
+	var n []int
+	printf ("%d %d %d\n", len (n), sumSlice (squares (5)), sumSlice (n))
+	if n == nil && s != nil {
+		printf ("nil\n")
+	}
+	lit := []int{5, 6, 7}
+	n = append (n, lit...)
+	n = append (n, n...)
+	printf ("%d %d %d\n", len (n), n[3], n[5])
+	dst := make ([]int, 2)
+	printf ("%d %d %d\n", copy (dst, lit), dst[0], dst[1])
+	printf ("%d\n", copy (lit, lit[1:]))
+	for i, x := range lit {
+		printf ("%d:%d ", i, x)
+	}
+	for i := range a {
+		a[i] = 3
+		a[i] += a[i]
+	}
+	total := 0
+	for range lit {
+		total++
+	}
+	var i, x int
+	for i, x = range [3]int{1, 2, 3} {
+		total += x
+	}
+	printf ("%d %d %d\n", a[5], total, i)
+	var funcs [3]*int
+	for i := range funcs {
+		funcs[i] = &i
+	}
+	printf ("%d %d\n", *funcs[0], *funcs[2])
+	bytes := []uint8{250, 251}
+	bytes[1] += 10
+	printf ("%d %d\n", bytes[1], len (bytes[:0]))
+}
+
+var gstr string = "global"
+var gempty string
+
+func greet (name string) string {
+	return "hello, " + name
+}
+
+func countRunes (s string) int {
+	n := 0
+	for range s {
+		n++
+	}
+	return n
+}
+
+func f20 () {
+	s := greet ("gopher")
+	printf ("%s %d\n", s, len (s))
+	t := s[7:]
+	s += "!"
+	printf ("%s %s %d %d\n", s, t, s[0], "abc"[2])
+	printf ("%d %d %d %d\n", s == "hello, gopher!", t != "gopher", "abc" < "abd", "ab" < "a")
+	printf ("%d %d %d\n", "b" > "abc", t <= "gopher", "" >= gempty)
+	printf ("%s %d %d\n", gstr, len (gstr), len (gempty))
+	b := []byte (t)
+	b[0] = 'G'
+	printf ("%s %s %d\n", string (b), t, len (b))
+	u := "héllo, 世界"
+	r := []rune (u)
+	printf ("%d %d %d\n", len (u), len (r), r[1])
+	r[7] = 'W'
+	printf ("%s %d\n", string (r), countRunes (u))
+	for i, c := range "aé世" {
+		printf ("%d:%d ", i, c)
+	}
+	printf ("%s%s%s\n", string ('x'), string (r[1]), string (-1))
+	var joined string
+	for i := 0; i < 3; i++ {
+		joined = joined + string ('a' + i)
+	}
+	printf ("%s %s\n", joined, u[7:])
+}
+
+func movePoint (p Point, dx int) Point {
+	p.x += dx
+	return p
+}
+
+func walkPoint (n int) (Point, int) {
+	if n == 0 {
+		return Point{}, 0
+	}
+	p, depth := walkPoint (n - 1)
+	return movePoint (p, n), depth + 1
+}
+
+type Point struct {
+	x, y int
+}
+
+type Named struct {
+	name string
+	id   int8
+}
+
+type Rect struct {
+	Point
+	*Named
+	w, h int16
+}
+
+type Node struct {
+	value int
+	next  *Node
+}
+
+var gpoint Point
+
+func f21 () {
+	p := Point{1, 2}
+	q := Point{y: 5}
+	printf ("%d %d %d %d\n", p.x, p.y, q.x, q.y)
+	q = movePoint (p, 10)
+	printf ("%d %d %d\n", p.x, q.x, q.y)
+	pp := &p
+	pp.y = 7
+	pp.x++
+	printf ("%d %d %d %d\n", p.x, p.y, p == Point{2, 7}, p != q)
+	r := Rect{Point: Point{3, 4}, Named: &Named{"box", 9}, w: 5}
+	r.x += r.y
+	r.h = r.w * 2
+	printf ("%d %d %d %d ", r.x, r.Point.y, r.w, r.h)
+	printf ("%s %d\n", r.name, r.id)
+	r2 := r
+	r2.name = "moved"
+	printf ("%s %d %d\n", r.name, r2 == r, Named{"a", 1} == Named{"a", 1})
+	var list *Node
+	for i := 1; i <= 3; i++ {
+		list = &Node{i * i, list}
+	}
+	for n := list; n != nil; n = n.next {
+		printf ("%d ", n.value)
+	}
+	pts := []Point{{1, 1}, {y: 2}}
+	pts = append (pts, Point{3, 3})
+	pts[1].x = 9
+	ptrs := [2]*Point{{4, 4}, &pts[0]}
+	ptrs[1].y = 8
+	printf ("%d %d %d %d %d\n", len (pts), pts[1].x, pts[0].y, ptrs[0].x, ptrs[1].y)
+	anon := struct {
+		a    int8
+		b, c int
+	}{1, 2, 3}
+	var zero struct {
+		a    int8
+		b, c int
+	}
+	printf ("%d %d %d %d\n", anon.a, anon.b + anon.c, anon == zero, zero.c)
+	gpoint.y = 6
+	printf ("%d %d\n", gpoint.x, gpoint.y)
+	type pair struct {
+		key   string
+		value [2]int
+	}
+	a := pair{"k", [2]int{1, 2}}
+	b := a
+	b.value[1] = 3
+	printf ("%d %d %s\n", a == b, a.value[1] + b.value[1], b.key)
+	var last, first *Point
+	total := 0
+	for i := 0; i < 4; i++ {
+		last = &Point{i, i}
+		if first == nil {
+			first = last
+		}
+		total += Point{i, 1}.x
+	}
+	p, q = q, p
+	w, depth := walkPoint (4)
+	printf ("%d %d %d %d ", first.x, last.x, first != last, total)
+	printf ("%d %d %d %d\n", p.x, q.x, w.x, depth)
+}
+
+func (p Point) Sum () int {
+	return p.x + p.y
+}
+
+func (p *Point) Scale (k int) {
+	p.x *= k
+	p.y *= k
+}
+
+func (p Point) Split () (int, int) {
+	return p.x, p.y
+}
+
+func (r *Rect) Area () int16 {
+	return r.w * r.h
+}
+
+func (n Named) Length () int {
+	return len (n.name) + 10
+}
+
+type Counter int
+
+func (c *Counter) Inc () {
+	*c += 1
+}
+
+func (c Counter) Twice () Counter {
+	return c + c
+}
+
+type Shape struct {
+	*Rect
+	label string
+}
+
+func f22 () {
+	p := Point{3, 4}
+	p.Scale (2)
+	pp := &p
+	printf ("%d %d %d\n", p.Sum (), pp.Sum (), Named{"ab", 1}.Length ())
+	a, b := pp.Split ()
+	sum := p.Sum
+	move := p.Scale
+	p.x = 100
+	move (3)
+	printf ("%d %d %d %d %d\n", a, b, sum (), p.x, p.y)
+	var c Counter
+	c.Inc ()
+	c.Inc ()
+	inc := c.Inc
+	inc ()
+	printf ("%d %d\n", c, c.Twice ())
+	r := Rect{Point: Point{1, 2}, w: 3, h: 4}
+	s := Shape{&r, "box"}
+	s.Scale (10)
+	printf ("%d %d %d %d\n", r.Sum (), s.Sum (), s.Area (), s.Rect.Point.x)
+	f := Point.Sum
+	g := (*Point).Scale
+	h := (*Point).Sum
+	g (&p, 2)
+	printf ("%d %d\n", f (Point{5, 6}), h (&p))
+	twice := Counter.Twice
+	inc2 := (*Counter).Inc
+	inc2 (&c)
+	ptwice := (*Counter).Twice
+	printf ("%d %d\n", twice (c), ptwice (&c))
+	rsum := Rect.Sum
+	scale := (*Shape).Scale
+	scale (&s, 2)
+	printf ("%d %d %d\n", rsum (r), Shape.Sum (s), r.x)
+}
+
+type Sizer interface {
+	Size () int
+}
+
+type Describer interface {
+	Sizer
+	Name () string
+}
+
+func (p Point) Size () int {
+	return p.x * p.y
+}
+
+func (n Named) Name () string {
+	return n.name
+}
+
+func (c Counter) Size () int {
+	return int (c) * 10
+}
+
+func (c *Counter) Name () string {
+	return "counter"
+}
+
+type MyErr struct {
+	code int
+}
+
+func (e *MyErr) Error () string {
+	return "failed"
+}
+
+func checkSign (n int) error {
+	if n < 0 {
+		return &MyErr{n}
+	}
+	return nil
+}
+
+func describe (x any) string {
+	switch v := x.(type) {
+	case nil:
+		return "nil"
+	case int:
+		if v > 10 {
+			return "big int"
+		}
+		return "int"
+	case string:
+		return v + "!"
+	case Point, *Point:
+		return "point"
+	case Describer:
+		return v.Name ()
+	case error:
+		return v.Error ()
+	default:
+		return "other"
+	}
+}
+
+func totalSize (sizers []Sizer) int {
+	total := 0
+	for _, s := range sizers {
+		total += s.Size ()
+	}
+	return total
+}
+
+type Pair struct {
+	first  any
+	second Sizer
+}
+
+type Wrapped struct {
+	Sizer
+	n int
+}
+
+func f23 () {
+	p := Point{2, 3}
+	var s Sizer = p
+	p.x = 10
+	c := Counter (4)
+	r := Rect{Point: Point{3, 4}, Named: &Named{"rect", 1}, w: 5}
+	printf ("%d %d %d\n", s.Size (), Sizer (c).Size (), totalSize ([]Sizer{p, c, &c, r, &r}))
+	var d Describer = &r
+	s = d
+	size := d.Size
+	r.Point.x = 5
+	printf ("%s %d %d %s\n", d.Name (), s.Size (), size (), Describer (&c).Name ())
+	printf ("%s %s %s %s ", describe (nil), describe (3), describe (42), describe ("hi"))
+	printf ("%s %s %s %s ", describe (p), describe (&p), describe (d), describe (checkSign (-1)))
+	printf ("%s %s\n", describe (c), describe ([]int{1}))
+	var x any = 7
+	n, ok := x.(int)
+	str, ok2 := x.(string)
+	printf ("%d %d %d %d ", n, ok, len (str), ok2)
+	d2, ok3 := s.(Describer)
+	_, ok4 := Sizer (p).(Describer)
+	printf ("%d %d %s %d\n", x.(int) + 1, ok3, d2.Name (), ok4)
+	var e error
+	printf ("%d %d ", e == nil, checkSign (1) == nil)
+	e = checkSign (-5)
+	me, ok5 := e.(*MyErr)
+	printf ("%d %d %d %s\n", e != nil, ok5, me.code, e.Error ())
+	var y any = 7
+	var z any
+	printf ("%d %d %d %d ", x == y, x == 8, z == nil, y != z)
+	printf ("%d %d %d\n", any ("a") == "a", any (Point{1, 2}) == Point{1, 2}, any (c) == any (Counter (4)))
+	pair := Pair{1, Point{1, 1}}
+	other := pair
+	printf ("%d ", pair == other)
+	other.second = c
+	printf ("%d %d\n", pair == other, pair.second.Size () + other.second.Size ())
+	values := []any{1, "two", Point{1, 2}, &c, nil}
+	for i, v := range values {
+		if sz, ok := v.(Sizer); ok {
+			printf ("%d:%d ", i, sz.Size ())
+		} else {
+			printf ("%d:- ", i)
+		}
+	}
+	var sz Sizer
+	printf ("%d\n", sz == nil)
+	w := Wrapped{p, 1}
+	sz = w
+	wsize := w.Size
+	w.Sizer = c
+	measure := Sizer.Size
+	printf ("%d %d %d %d %s\n", w.Size (), sz.Size (), wsize (), measure (w), Describer.Name (d))
+}
+
+type Tally map[string]int
+
+func (t Tally) add (words []string) {
+	for _, w := range words {
+		t[w]++
+	}
+}
+
+type Cell struct {
+	row, col int
+}
+
+func sumValues (m map[Cell]int) int {
+	total := 0
+	for _, v := range m {
+		total += v
+	}
+	return total
+}
+
+func f24 () {
+	ages := map[string]int{"ann": 31, "bob": 25}
+	ages["cy"] = 40
+	ages["bob"] += 1
+	age, ok := ages["dee"]
+	if !ok {
+		printf ("%d %d %d %d ", len (ages), ages["ann"], ages["bob"], age)
+	}
+	delete (ages, "ann")
+	if _, ok := ages["ann"]; !ok {
+		printf ("%d\n", len (ages))
+	}
+	t := Tally{}
+	t.add ([]string{"x", "y", "x", "z", "x"})
+	keys := 0
+	for k, v := range t {
+		keys += len (k) * v
+	}
+	printf ("%d %d %d %d\n", len (t), t["x"], t["w"], keys)
+	grid := make (map[Cell]int)
+	for i := 0; i < 100; i++ {
+		grid[Cell{i % 10, i / 10}] = i
+	}
+	for i := 0; i < 100; i += 3 {
+		delete (grid, Cell{i % 10, i / 10})
+	}
+	printf ("%d %d %d ", len (grid), grid[Cell{4, 2}], sumValues (grid))
+	var none map[string][]int
+	printf ("%d %d ", len (none), len (none["a"]))
+	if none == nil {
+		groups := map[int][]string{1: {"a"}, 2: {"b", "c"}}
+		groups[1] = append (groups[1], "d")
+		printf ("%d %s\n", len (groups[1]) + len (groups[2]), groups[1][1])
+	}
+}
+
+type Transform func (int) int
+
+func chain (fs []Transform) Transform {
+	return func (x int) int {
+		for _, f := range fs {
+			x = f (x)
+		}
+		return x
+	}
+}
+
+func makeCounter () (func () int, func ()) {
+	n := 0
+	return func () int {
+		n++
+		return n
+	}, func () {
+		n = 0
+	}
+}
+
+func f25 () {
+	next, reset := makeCounter ()
+	next ()
+	next ()
+	printf ("%d ", next ())
+	reset ()
+	printf ("%d ", next ())
+	base := 10
+	addBase := func (x int) int { return x + base }
+	base = 100
+	double := Transform (func (x int) int { return x * 2 })
+	printf ("%d ", chain ([]Transform{addBase, double}) (1))
+	var fib func (int) int
+	fib = func (n int) int {
+		if n < 2 {
+			return n
+		}
+		return fib (n - 1) + fib (n - 2)
+	}
+	printf ("%d\n", fib (15))
+	var squares []func () int
+	for i := 0; i < 4; i++ {
+		squares = append (squares, func () int { return i * i })
+	}
+	total := 0
+	for _, sq := range squares {
+		total = total * 10 + sq ()
+	}
+	var c Counter
+	name := c.Name
+	var none func ()
+	if none == nil {
+		printf ("%d %s %d\n", total, name (), func (s string) int { return len (s) } ("abc"))
+	}
+}
+
+func weekday (d int) string {
+	switch d {
+	case 0, 6:
+		return "weekend"
+	case 1:
+		return "monday"
+	case 2, 3, 4:
+		return "midweek"
+	default:
+		return "?"
+	case 5:
+		return "friday"
+	}
+}
+
+func sign (n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func f26 () {
+	for d := 0; d < 8; d += 3 {
+		printf ("%s ", weekday (d))
+	}
+	printf ("%d %d %d\n", sign (-7), sign (0), sign (9))
+	steps := 0
+	for n := 0; n < 4; n++ {
+		switch n {
+		case 0:
+			steps += 1
+			fallthrough
+		case 1:
+			steps += 10
+		case 2:
+			continue
+		default:
+			steps += 100
+		}
+		steps += 1000
+	}
+	switch s := "ab"; s + s {
+	case "a", "abab":
+		printf ("%d ", steps)
+	case "ab":
+		printf ("wrong ")
+	}
+	switch c := "x"[0]; c {
+	case 'x', 'y':
+		printf ("%c\n", c)
+	}
+}
+
+type Level uint8
+
+const (
+	Debug Level = iota + 1
+	Info
+	_
+	Error
+)
+
+const (
+	KiB = 1 << (10 * (iota + 1))
+	MiB
+)
+
+const banner = "v" + "1"
+const wide = 1 << 80
+
+var blocks [len (banner) * 2]int
+var limit = MiB / KiB
+
+func f27 () {
+	const local = wide >> 78
+	printf ("%d %d %d %d ", Debug, Info, Error, local)
+	printf ("%d %d %s %d\n", KiB, limit, banner, len (blocks))
+	var top Level = ^Level (0)
+	const neg = -7 / 2
+	printf ("%d %d %d %ld\n", top, neg, -7 % 2, wide >> 20)
+	const eight = 1.0 << 3
+	var shifted int64 = 1.0 << 33
+	printf ("%d %ld\n", eight, shifted)
+}
+
+type UserID = int
+
+type Cents int64
+
+type Money Cents
+
+func (c Cents) dollars () int {
+	return int (c / 100)
+}
+
+func f28 () {
+	var id UserID = 42
+	n := id + 1
+	price := Cents (1999)
+	m := Money (price)
+	printf ("%d %d %d ", n, price.dollars (), Cents (m) % 100)
+	wide := 70000
+	printf ("%d %d %d ", int8 (wide), uint8 (wide), int16 (wide))
+	var small int8 = -3
+	printf ("%d %d\n", uint16 (small), int64 (small) * 2)
+	{
+		type Cents string
+		var label Cents = "local"
+		UserID := len (label)
+		printf ("%s %d\n", label, UserID)
+	}
+}
+
+type Celsius float64
+
+func (c Celsius) fahrenheit () Celsius {
+	return c * 9 / 5 + 32
+}
+
+type Sample struct {
+	weight float32
+	value float64
+}
+
+const Pi = 3.14159265358979323846
+const Scale float32 = 0.1
+
+var grate float64 = 1.5e-2
+
+func blend (a float64, n int, b float32, m int) (float64, int) {
+	return a * float64 (n) + float64 (b), n + m
+}
+
+func weigh (a, b, c, d int, x, y float64, z float32) float64 {
+	return float64 (a * b + c * d) * x + y - float64 (z)
+}
+
+func f29 () {
+	x := 1.5
+	var y float32 = 2.25
+	printf ("%.3f %.3f %.3f %.3f %.3f ", x + 2, x - 4, x * 3, x / 4, -x)
+	printf ("%.4f %.4f\n", y * 2, float64 (y) / 3)
+	printf ("%.2f %.3f %.5f %.4f %g\n", 1e3, .125, 0x1.8p3, Pi, grate)
+	r, n := blend (2.5, 4, 0.5, 3)
+	printf ("%.2f %d %.2f\n", r, n, Celsius (100).fahrenheit ())
+	conv := Celsius.fahrenheit
+	printf ("%.1f %.8f\n", conv (-40), float64 (Scale))
+	big := uint64 (1) << 63 + 1024
+	f := float64 (big)
+	printf ("%ld %ld %lu %lu\n", int64 (-2.75 * x), int64 (f / 4), uint64 (f), uint64 (f * 1.5))
+	var zero float64
+	nan := zero / zero
+	printf ("%d %d %d %d %d\n", nan == nan, nan != nan, nan < 1, x >= 1.5, 1 / zero > 1e308)
+	var a, b interface{} = zero, -zero
+	m := map[float64]int{zero: 1}
+	m[-zero]++
+	s := Sample {0.5, 2}
+	t := s
+	t.value += nan
+	printf ("%d %d %d %d %d\n", a == b, len (m), m[0], s == Sample {0.5, 2}, s == t)
+	sum := float32 (0)
+	for i := 0; i < 10; i++ {
+		sum += 0.1
+	}
+	sum++
+	printf ("%.7f %d %d\n", sum, int (sum), 7.0 / 2 == 3.5)
+	var unsigned float64 = -0.0
+	const product = -1.0 * 0
+	printf ("%d %d %.2f\n", 1 / unsigned > 0, 1 / (product - zero) > 0, weigh (1, 2, 3, 4, 0.5, 1, 0.25))
+}
+
+var verbose bool = true
+var quiet = false
+
+const debug = !true || 1 > 2
+
+type Flags struct {
+	on   bool
+	mask uint8
+}
+
+func between (lo int, x int, hi int) bool {
+	return lo <= x && x <= hi
+}
+
+func either (a bool, b bool) (bool, bool) {
+	return a || b, a != b
+}
+
+func f30 () {
+	a, b := 3, 5
+	ok := a < b
+	printf ("%d %d %d %d\n", ok, !ok, ok == true, between (1, a, 2) || between (4, b, 6))
+	x, y := either (verbose, quiet)
+	printf ("%d %d %d %d %d\n", x, y, verbose && !quiet, debug, "abc" < "abd")
+	if debug {
+		printf ("debug\n")
+	} else if verbose && (a > b || !quiet) {
+		printf ("verbose\n")
+	}
+	var zero float64
+	nan := zero / zero
+	if nan < 1 || nan >= 1 || nan == nan {
+		printf ("ordered\n")
+	} else if !(nan != nan) {
+		printf ("equal\n")
+	} else {
+		printf ("unordered\n")
+	}
+	count := 0
+	for done := false; !done; {
+		count++
+		done = count >= 3 && !quiet
+	}
+	f := Flags{on: true, mask: 3}
+	g := f
+	g.on = !g.on
+	m := map[bool]int{true: 1}
+	m[a > b] += 2
+	printf ("%d %d %d %d %d\n", count, f == g, f.on != g.on, m[true], m[false])
+	{
+		true := 0
+		false := true + 1
+		printf ("%d %d\n", true, false)
+	}
+	for i := 0; i < 4; i++ {
+		switch {
+		case i == 0 || i == 3 && ok:
+			printf ("edge%d ", i)
+		case !ok, i > 5:
+			printf ("never ")
+		default:
+			printf ("inner%d ", i)
+		}
+	}
+	quiet = true
+	printf ("%d\n", quiet)
+}
+
+const mask = 0b1111_0000
+const header = `name	value
+"quoted" \n stays`
+const rotated = (3 + 4i) * 1i
+
+func f31 () {
+	printf ("%d %d %d %d %d ", 0x_FF, 0o17, 0O17, mask, 017)
+	printf ("%d %d\n", 1_000_000, 0X1F)
+	printf ("%.4f %.4f %.1f %.1f %.3f\n", 0x1p-2, 1_0.2_5, 1e1_0, 0789.5, 0x.8p1)
+	s := "\a\b\f\v\\\"\x41\101\u00e9\U0001F600\xff"
+	printf ("%d", len (s))
+	for i := 0; i < len (s); i++ {
+		printf (" %d", s[i])
+	}
+	printf ("\n%d %s|\n", len (header), header)
+	printf ("%d %d %d %d %d ", '\u00e9', '\'', '\x7f', '\377', '\\')
+	printf ("%d %d %d\n", '\U00101234', '\t', len ("\u4e16\u754c"))
+	var unit int = rotated * -1i / (3 + 4i) * 5
+	printf ("%d %.2f %d %d\n", unit, float64 (0x1p-2i * 1_0i), rotated == -4 + 3i, 2i != 2)
+}
+
+type Café struct {
+	größe int
+	名前  string
+}
+
+func (c Café) 数量 () int {
+	return c.größe * 2
+}
+
+var π = 3
+
+func 加 (a int, b int) int {
+	return a + b
+}
+
+func f32 () {
+	c := Café{größe: 21, 名前: "ok"}
+	var i interface{} = c
+	_, ok := i.(Café)
+	f := Café.数量
+	printf ("%d %d %d %d %s ", c.数量 (), 加 (π, 1), ok, f (c), c.名前)
+	x٣, ǅ := 4, 'é'
+	s := "日本語"
+	printf ("%d %d %d %d\n", x٣, ǅ, len (s), '語')
+}
+
 func main () {
 	printf ("%d\n", 2 + 5)
 	printf ("%d\n", 10 - 4)
@@ -74,4 +1214,31 @@ func main () {
 	f5 (1, 2)
 	f6 (1, 2)
 	f7 (1)
+	f8 (1, 2)
+	f8 (2, 2)
+	f8 (10, 2)
+	f9 (6)
+	f10 ()
+	f11 ()
+	f12 ()
+	f13 ()
+	f14 ()
+	f15 ()
+	f16 ()
+	f17 ()
+	f18 ()
+	f19 ()
+	f20 ()
+	f21 ()
+	f22 ()
+	f23 ()
+	f24 ()
+	f25 ()
+	f26 ()
+	f27 ()
+	f28 ()
+	f29 ()
+	f30 ()
+	f31 ()
+	f32 ()
 }
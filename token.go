@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type TokenType string
@@ -10,6 +13,8 @@ type TokenType string
 const (
 	T_EOF         TokenType = "EOF"
 	T_INT         TokenType = "int"
+	T_FLOAT       TokenType = "float"
+	T_IMAGINARY   TokenType = "imaginary"
 	T_STRING      TokenType = "string"
 	T_RUNE        TokenType = "rune"
 	T_IDENTIFIER  TokenType = "identifier"
@@ -45,6 +50,33 @@ var keywordList = []string{
 	"var",
 }
 
+// multi-character punctuations, longest first
+var punctuationList = []string{
+	"...",
+	"<<=",
+	">>=",
+	"&^=",
+	":=",
+	"+=",
+	"-=",
+	"*=",
+	"%=",
+	"&=",
+	"|=",
+	"^=",
+	"++",
+	"--",
+	"<<",
+	">>",
+	"&^",
+	"&&",
+	"||",
+	"==",
+	"!=",
+	"<=",
+	">=",
+}
+
 var tStream *TokenStream
 var bStream *ByteStream
 
@@ -118,6 +150,14 @@ func (tok *Token) isTypeInt() bool {
 	return tok != nil && tok.typ == T_INT
 }
 
+func (tok *Token) isTypeFloat() bool {
+	return tok != nil && tok.typ == T_FLOAT
+}
+
+func (tok *Token) isTypeImaginary() bool {
+	return tok != nil && tok.typ == T_IMAGINARY
+}
+
 func (tok *Token) isTypeRune() bool {
 	return tok != nil && tok.typ == T_RUNE
 }
@@ -145,7 +185,7 @@ var semicolon = &Token{
 
 func autoSemicolonInsert(last *Token) bool {
 	return last.isTypeIdentifier() ||
-		last.isTypeInt() || last.isTypeRune() || last.isTypeString() ||
+		last.isTypeInt() || last.isTypeFloat() || last.isTypeImaginary() || last.isTypeRune() || last.isTypeString() ||
 		last.isKeyword("break") || last.isKeyword("continue") || last.isKeyword("fallthrough") || last.isKeyword("return") ||
 		last.isPunct("++") || last.isPunct("--") || last.isPunct(")") || last.isPunct("]") || last.isPunct("}")
 }
@@ -229,41 +269,177 @@ func consumeToken(expected string) {
 	tStream.consumeToken(expected)
 }
 
+// nothing is rendered while tokenizing
 func renderTokens() {
-	tStream.renderTokens()
+	if tStream != nil {
+		tStream.renderTokens()
+	}
 }
 
 /* ================================ */
 
 func isPunctuation(b byte) bool {
 	switch b {
-	case '+', '-', '(', ')', '=', '{', '}', '*', '[', ']', ',', ':', '.', '!', '<', '>', '&', '|', '%', '/':
+	case '+', '-', '(', ')', '=', '{', '}', '*', '[', ']', ',', ':', ';', '.', '!', '<', '>', '&', '|', '%', '/', '^':
 		return true
 	default:
 		return false
 	}
 }
 
+func readPunctuation(b byte) string {
+	rest := bStream.source[bStream.index:]
+	for _, p := range punctuationList {
+		if p[0] == b && strings.HasPrefix(rest, p[1:]) {
+			for i := 1; i < len(p); i++ {
+				bStream.getc()
+			}
+			return p
+		}
+	}
+	return string([]byte{b})
+}
+
 func isNumber(b byte) bool {
 	ret := '0' <= b && b <= '9'
 	return ret
 }
 
-func readNumber(b byte) string {
-	var chars = []byte{b}
-	for {
-		c, err := bStream.getc()
-		if err != nil {
-			return string(chars)
+func isHexNumber(b byte) bool {
+	return isNumber(b) || 'a' <= b && b <= 'f' || 'A' <= b && b <= 'F'
+}
+
+// a number with a 0x, 0o or 0b prefix, or an octal one with a leading 0, and '_' between the digits.
+// it is a float with a fraction or an exponent, like 1.5, .5, 1e-3 or 0x1.8p3,
+// and imaginary with an i suffix. the literal is validated by checkNumber
+func readNumber(b byte) (string, TokenType) {
+	chars := []byte{b}
+	typ := T_INT
+	digit := isDecimalDigit
+	if b == '.' {
+		typ = T_FLOAT
+	}
+	if c := bStream.peekc(); b == '0' && strings.IndexByte("xXoObB", c) >= 0 {
+		bStream.getc()
+		chars = append(chars, c)
+		if c == 'x' || c == 'X' {
+			digit = isHexDigit
 		}
-		if isNumber(c) {
+	}
+	chars = readWhile(chars, digit)
+	if typ == T_INT && bStream.peekc() == '.' {
+		typ = T_FLOAT
+		bStream.getc()
+		chars = readWhile(append(chars, '.'), digit)
+	}
+	if c := bStream.peekc(); c != 0 && strings.IndexByte("eEpP", c) >= 0 {
+		typ = T_FLOAT
+		bStream.getc()
+		chars = append(chars, c)
+		if c := bStream.peekc(); c == '+' || c == '-' {
+			bStream.getc()
 			chars = append(chars, c)
+		}
+		chars = readWhile(chars, isDecimalDigit)
+	}
+	if bStream.peekc() == 'i' {
+		typ = T_IMAGINARY
+		bStream.getc()
+		chars = append(chars, 'i')
+	}
+	return string(chars), typ
+}
+
+func isDecimalDigit(b byte) bool {
+	return isNumber(b) || b == '_'
+}
+
+func isHexDigit(b byte) bool {
+	return isHexNumber(b) || b == '_'
+}
+
+var baseNames = map[int]string{2: "binary", 8: "octal", 10: "decimal", 16: "hexadecimal"}
+
+// report a malformed number at the position of the token
+func checkNumber(tok *Token) {
+	lit := strings.TrimSuffix(tok.sval, "i")
+	base, prefix := 10, 0
+	if len(lit) >= 2 && lit[0] == '0' {
+		switch lit[1] {
+		case 'x', 'X':
+			base, prefix = 16, 2
+		case 'o', 'O':
+			base, prefix = 8, 2
+		case 'b', 'B':
+			base, prefix = 2, 2
+		}
+	}
+	exponents := "eEpP"
+	if base == 16 {
+		// e is a digit
+		exponents = "pP"
+	}
+	mantissa, exponent := lit, ""
+	if i := strings.IndexAny(lit[prefix:], exponents); i >= 0 {
+		mantissa, exponent = lit[:prefix+i], lit[prefix+i:]
+	}
+	name := baseNames[base]
+	if strings.Trim(mantissa[prefix:], "._") == "" && prefix > 0 {
+		putErrorAt(tok, "%s%s literal has no digits.", strings.ToUpper(name[:1]), name[1:])
+	}
+	for i := prefix; i < len(mantissa); i++ {
+		c := mantissa[i]
+		if c == '.' && (base == 2 || base == 8) {
+			putErrorAt(tok, "Invalid radix point in %s literal.", name)
+		}
+		if isNumber(c) && int(c-'0') >= base {
+			putErrorAt(tok, "Invalid digit '%c' in %s literal.", c, name)
+		}
+	}
+	legacyOctal := base == 10 && len(mantissa) > 1 && mantissa[0] == '0' && !strings.Contains(mantissa, ".")
+	if legacyOctal && exponent == "" && tok.typ == T_INT {
+		if i := strings.IndexAny(mantissa, "89"); i >= 0 {
+			putErrorAt(tok, "Invalid digit '%c' in octal literal.", mantissa[i])
+		}
+	}
+	if exponent != "" {
+		if e := exponent[0]; base != 16 && (e == 'p' || e == 'P') {
+			putErrorAt(tok, "'%c' exponent requires hexadecimal mantissa.", e)
+		} else if base != 10 && base != 16 {
+			putErrorAt(tok, "'%c' exponent requires decimal mantissa.", e)
+		}
+		if strings.Trim(exponent[1:], "+-_") == "" {
+			putErrorAt(tok, "Exponent has no digits.")
+		}
+	} else if base == 16 && strings.Contains(mantissa, ".") {
+		putErrorAt(tok, "Hexadecimal mantissa requires a 'p' exponent.")
+	}
+	for i := 0; i < len(lit); i++ {
+		if lit[i] != '_' {
 			continue
-		} else {
-			bStream.ungetc()
-			return string(chars)
 		}
+		afterPrefix := prefix > 0 && i == prefix
+		if !(afterPrefix || i > 0 && isDigitOf(lit[i-1], base)) || i+1 >= len(lit) || !isDigitOf(lit[i+1], base) {
+			putErrorAt(tok, "'_' must separate successive digits.")
+		}
+	}
+}
+
+// the digits around a separator
+func isDigitOf(b byte, base int) bool {
+	if base == 16 {
+		return isHexNumber(b)
+	}
+	return isNumber(b)
+}
+
+// append the following bytes while they satisfy the function
+func readWhile(chars []byte, isFunc func(byte) bool) []byte {
+	for isFunc(bStream.peekc()) {
+		c, _ := bStream.getc()
+		chars = append(chars, c)
 	}
+	return chars
 }
 
 func skip(isFunc func(byte) bool) {
@@ -297,27 +473,26 @@ func skipNewLine() {
 	skip(isNewLine)
 }
 
-func isAlphabet(b byte) bool {
-	return ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z')
+// letters and digits are the Unicode classes of the spec, and '_' is a letter
+func isLetter(r rune) bool {
+	return r == '_' || 'A' <= r && r <= 'Z' || 'a' <= r && r <= 'z' || r >= utf8.RuneSelf && unicode.IsLetter(r)
 }
 
-func isName(b byte) bool {
-	return b == '_' || isAlphabet(b) || isNumber(b)
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9' || r >= utf8.RuneSelf && unicode.IsDigit(r)
 }
 
+// a name from its first byte, which begins a letter
 func readName(b byte) string {
-	var bytes = []byte{b}
+	bStream.ungetc()
+	start := bStream.index
 	for {
-		c, err := bStream.getc()
-		if err != nil {
-			return string(bytes)
+		r, size := bStream.peekRune()
+		if !isLetter(r) && !isDigit(r) {
+			return bStream.source[start:bStream.index]
 		}
-		if isName(c) {
-			bytes = append(bytes, c)
-			continue
-		} else {
-			bStream.ungetc()
-			return string(bytes)
+		for i := 0; i < size; i++ {
+			bStream.getc()
 		}
 	}
 }
@@ -331,58 +506,159 @@ func isKeyword(word string) bool {
 	return false
 }
 
+// an interpreted string literal after the opening quote.
+// \x and octal escapes are bytes, and the others are encoded in UTF-8
 func readString() string {
+	pos := bStream.SourceFile
 	var bytes = []byte{}
 	for {
 		c, err := bStream.getc()
 		if err != nil {
-			panic("invalid string literal")
+			putErrorAt(&Token{SourceFile: pos}, "String literal not terminated.")
 		}
-		if c == '\\' {
-			c, err = bStream.getc()
-			if err != nil {
-				panic("invalid string literal")
-			}
-			switch c {
-			case 'n':
-				bytes = append(bytes, '\\', 'n')
-			case 'r':
-				bytes = append(bytes, '\\', 'r')
-			case 't':
-				bytes = append(bytes, '\\', 't')
-			default:
-				bytes = append(bytes, c)
+		switch {
+		case c == '"':
+			return string(bytes)
+		case isNewLine(c):
+			putErrorAt(&Token{SourceFile: pos}, "Newline in string.")
+		case c == '\\':
+			value, isByte := readEscape('"')
+			if isByte {
+				bytes = append(bytes, byte(value))
+			} else {
+				bytes = append(bytes, string(value)...)
 			}
-			continue
-		} else if c == '"' {
+		default:
+			bytes = append(bytes, c)
+		}
+	}
+}
+
+// a raw string literal after the opening back quote, which may span lines.
+// carriage returns are discarded
+func readRawString() string {
+	pos := bStream.SourceFile
+	var bytes = []byte{}
+	for {
+		c, err := bStream.getc()
+		if err != nil {
+			putErrorAt(&Token{SourceFile: pos}, "Raw string literal not terminated.")
+		}
+		switch c {
+		case '`':
 			return string(bytes)
-		} else {
+		case '\r':
+		default:
 			bytes = append(bytes, c)
-			continue
 		}
 	}
 }
 
-func expect(b byte) {
+// the value of an escape sequence after the backslash in a literal quoted by the quote,
+// which is a byte for \x and octal escapes
+func readEscape(quote byte) (rune, bool) {
+	pos := &Token{SourceFile: bStream.SourceFile}
 	c, err := bStream.getc()
 	if err != nil {
-		panic("unexpected EOF")
+		putErrorAt(pos, "Escape sequence not terminated.")
+	}
+	switch c {
+	case 'a':
+		return '\a', false
+	case 'b':
+		return '\b', false
+	case 'f':
+		return '\f', false
+	case 'n':
+		return '\n', false
+	case 'r':
+		return '\r', false
+	case 't':
+		return '\t', false
+	case 'v':
+		return '\v', false
+	case '\\', quote:
+		return rune(c), false
+	case 'x':
+		return readEscapeDigits(pos, 2, 16), true
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		bStream.ungetc()
+		value := readEscapeDigits(pos, 3, 8)
+		if value > 255 {
+			putErrorAt(pos, "Octal escape value %d > 255.", value)
+		}
+		return value, true
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		value := readEscapeDigits(pos, size, 16)
+		if !utf8.ValidRune(value) {
+			putErrorAt(pos, "Escape sequence is invalid Unicode code point.")
+		}
+		return value, false
+	}
+	putErrorAt(pos, "Unknown escape sequence.")
+	return 0, false
+}
+
+// the value of exactly the number of digits in the base
+func readEscapeDigits(pos *Token, count int, base int) rune {
+	var value rune
+	for i := 0; i < count; i++ {
+		c, err := bStream.getc()
+		if err != nil {
+			putErrorAt(pos, "Escape sequence not terminated.")
+		}
+		digit := strings.IndexByte("0123456789abcdef", lowerByte(c))
+		if digit < 0 || digit >= base {
+			putErrorAt(pos, "Invalid character %q in escape sequence.", c)
+		}
+		value = value*rune(base) + rune(digit)
 	}
-	if c != b {
-		putError("char '%c' expected, but got '%c'\n", b, c)
+	return value
+}
+
+func lowerByte(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
 	}
+	return b
 }
 
+// a rune literal after the opening quote, whose value is encoded in UTF-8
 func readChar() string {
+	pos := &Token{SourceFile: bStream.SourceFile}
 	c, err := bStream.getc()
-	if err != nil {
-		panic("invalid char literal")
+	var value rune
+	switch {
+	case err != nil || isNewLine(c):
+		putErrorAt(pos, "Rune literal not terminated.")
+	case c == '\'':
+		putErrorAt(pos, "Empty rune literal or unescaped ' in rune literal.")
+	case c == '\\':
+		value, _ = readEscape('\'')
+	default:
+		// the encoding is checked by getc
+		var size int
+		value, size = utf8.DecodeRuneInString(bStream.source[bStream.index-1:])
+		for i := 1; i < size; i++ {
+			bStream.getc()
+		}
 	}
-	if c == '\\' {
+	for count := 0; ; count++ {
 		c, err = bStream.getc()
+		if err != nil || isNewLine(c) {
+			putErrorAt(pos, "Rune literal not terminated.")
+		}
+		if c == '\'' {
+			if count > 0 {
+				putErrorAt(pos, "More than one character in rune literal.")
+			}
+			return string(value)
+		}
 	}
-	expect('\'')
-	return string([]byte{c})
 }
 
 func skipLine() {
@@ -426,26 +702,35 @@ func tokenize(filename string) {
 			column:   0,
 		},
 	}
+	if strings.HasPrefix(s, "\uFEFF") {
+		// a byte order mark is ignored at the beginning
+		bStream.index = len("\uFEFF")
+	}
 	for {
 		c, err := bStream.getc()
 		if err != nil {
 			tStream = newTokenStream(r)
 			return
 		}
+		pos := bStream.SourceFile
 		var tok *Token
 		switch {
 		case c == 0:
 			tStream = newTokenStream(r)
 			return
-		case isNumber(c):
-			sval := readNumber(c)
-			tok = &Token{typ: T_INT, sval: sval}
+		case isNumber(c) || c == '.' && isNumber(bStream.peekc()):
+			sval, typ := readNumber(c)
+			tok = &Token{typ: typ, sval: sval, SourceFile: pos}
+			checkNumber(tok)
 		case c == '\'':
 			sval := readChar()
 			tok = &Token{typ: T_RUNE, sval: sval}
 		case c == '"':
 			sval := readString()
 			tok = &Token{typ: T_STRING, sval: sval}
+		case c == '`':
+			sval := readRawString()
+			tok = &Token{typ: T_STRING, sval: sval}
 		case c == ' ' || c == '\t':
 			skipSpace()
 			continue
@@ -474,10 +759,14 @@ func tokenize(filename string) {
 				tok = &Token{typ: T_PUNCTUATION, sval: "/"}
 			}
 		case isPunctuation(c):
-			tok = &Token{typ: T_PUNCTUATION, sval: fmt.Sprintf("%c", c)}
-		case c == '=':
-			tok = &Token{typ: T_PUNCTUATION, sval: fmt.Sprintf("%c", c)}
+			sval := readPunctuation(c)
+			tok = &Token{typ: T_PUNCTUATION, sval: sval}
 		default:
+			if r, _ := utf8.DecodeRuneInString(bStream.source[bStream.index-1:]); isDigit(r) {
+				putErrorAt(&Token{SourceFile: pos}, "Identifier cannot begin with digit %#U.", r)
+			} else if !isLetter(r) {
+				putErrorAt(&Token{SourceFile: pos}, "Invalid character %#U.", r)
+			}
 			sval := readName(c)
 			if isKeyword(sval) {
 				tok = &Token{typ: T_KEYWORD, sval: sval}
@@ -485,6 +774,7 @@ func tokenize(filename string) {
 				tok = &Token{typ: T_IDENTIFIER, sval: sval}
 			}
 		}
+		tok.SourceFile = pos
 		r = append(r, tok)
 	}
 }
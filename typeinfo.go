@@ -0,0 +1,428 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+/* ================================
+ * runtime type information
+ * ================================ */
+// the descriptor of a dynamic type has its name for the messages of panics,
+// and the routine comparing two values of it, which is 0 for an uncomparable type:
+//	.type.N:
+//	.quad .type.N.name, .type.N.equal
+// the itab of a dynamic type for a non-empty interface:
+//	.itab.N.K:
+//	.quad .type.N, <the code of the methods sorted by the names>
+// the table of an interface to look up the itabs at run time has an entry for every dynamic type,
+// with the itab or 0 and the name of the method the type does not have:
+//	.iface.K:
+//	.quad <the number of the entries>
+//	.quad .type.N, .itab.N.K, 0 ...
+// the dynamic types are the ones converted to an interface in the program,
+// so they are all known after the checking.
+// the descriptor of a map type has the layout of its entries, and the routines
+// hashing and comparing two keys at their addresses:
+//	.maptype.N:
+//	.quad <the key size>, <the offset of the value>, <the entry size>, .maptype.N.hash, .maptype.N.equal
+
+type typeDescriptor struct {
+	gtype Type
+	index int
+}
+
+type interfaceDescriptor struct {
+	gtype Type
+	index int
+}
+
+type mapDescriptor struct {
+	gtype *MapType
+	index int
+}
+
+var typeDescriptors []*typeDescriptor
+var interfaceDescriptors []*interfaceDescriptor
+var mapDescriptors []*mapDescriptor
+
+// the interface methods used as func values, by the interface and the method name
+var interfaceMethodValues = make(map[string]*interfaceMethodValue)
+
+// the interface methods of the method expressions like I.M, by the label of their code
+var interfaceMethodExpressions = make(map[string]*interfaceMethodValue)
+
+type interfaceMethodValue struct {
+	id    *interfaceDescriptor
+	index int
+}
+
+// no type can be added after the descriptors are emitted
+var typeInfoEmitted bool
+
+func descriptorOf(t Type) *typeDescriptor {
+	for _, td := range typeDescriptors {
+		if identical(td.gtype, t) {
+			return td
+		}
+	}
+	if typeInfoEmitted {
+		putError("internal error: type descriptor of %s is not registered.", t)
+	}
+	td := &typeDescriptor{gtype: t, index: len(typeDescriptors)}
+	typeDescriptors = append(typeDescriptors, td)
+	return td
+}
+
+func interfaceDescriptorOf(t Type) *interfaceDescriptor {
+	for _, id := range interfaceDescriptors {
+		if identical(id.gtype.underlying(), t.underlying()) {
+			return id
+		}
+	}
+	if typeInfoEmitted {
+		putError("internal error: interface descriptor of %s is not registered.", t)
+	}
+	id := &interfaceDescriptor{gtype: t, index: len(interfaceDescriptors)}
+	interfaceDescriptors = append(interfaceDescriptors, id)
+	return id
+}
+
+func mapDescriptorOf(t Type) *mapDescriptor {
+	mt := mapOf(t)
+	for _, md := range mapDescriptors {
+		if identical(md.gtype, mt) {
+			return md
+		}
+	}
+	if typeInfoEmitted {
+		putError("internal error: map descriptor of %s is not registered.", t)
+	}
+	md := &mapDescriptor{gtype: mt, index: len(mapDescriptors)}
+	mapDescriptors = append(mapDescriptors, md)
+	return md
+}
+
+func (td *typeDescriptor) label() string {
+	return fmt.Sprintf(".type.%d", td.index)
+}
+
+func (id *interfaceDescriptor) label() string {
+	return fmt.Sprintf(".iface.%d", id.index)
+}
+
+func (md *mapDescriptor) label() string {
+	return fmt.Sprintf(".maptype.%d", md.index)
+}
+
+// the offset of the value in an entry of the map, after the key
+func mapValueOffset(mt *MapType) int {
+	return mapEntryKey + alignTo(mt.key.size(), 8)
+}
+
+func itabLabel(td *typeDescriptor, id *interfaceDescriptor) string {
+	return fmt.Sprintf(".itab.%d.%d", td.index, id.index)
+}
+
+// the first word of an interface value of the dynamic type
+func typeWordOf(t Type, to Type) string {
+	if isEmptyInterface(to) {
+		return descriptorOf(t).label()
+	}
+	return itabLabel(descriptorOf(t), interfaceDescriptorOf(to))
+}
+
+func useInterfaceMethodValue(t Type, name string) string {
+	id := interfaceDescriptorOf(t)
+	label := fmt.Sprintf("%s.%s.fm", id.label(), name)
+	interfaceMethodValues[label] = &interfaceMethodValue{
+		id:    id,
+		index: t.underlying().(*InterfaceType).methodIndex(name),
+	}
+	return label
+}
+
+// the code of I.M takes the interface value for the receiver, the label is returned
+func useInterfaceMethodExpression(t Type, name string) string {
+	id := interfaceDescriptorOf(t)
+	code := fmt.Sprintf("%s.%s", id.label(), name)
+	interfaceMethodExpressions[code] = &interfaceMethodValue{
+		id:    id,
+		index: t.underlying().(*InterfaceType).methodIndex(name),
+	}
+	return code
+}
+
+// the name printed by the runtime, qualified by the package as the go runtime does
+func runtimeTypeName(t Type) string {
+	switch u := t.(type) {
+	case *NamedType:
+		if u == tError {
+			return u.name
+		}
+		return "main." + u.name
+	case *PointerType:
+		return "*" + runtimeTypeName(u.elem)
+	case *SliceType:
+		return "[]" + runtimeTypeName(u.elem)
+	case *ArrayType:
+		return fmt.Sprintf("[%d]%s", u.length, runtimeTypeName(u.elem))
+	case *MapType:
+		return "map[" + runtimeTypeName(u.key) + "]" + runtimeTypeName(u.elem)
+	}
+	return t.String()
+}
+
+// whether the value itself is the second word of an interface value
+func isPointerShaped(t Type) bool {
+	return isPointer(t) || isMap(t)
+}
+
+func emitTypeInfo() {
+	typeInfoEmitted = true
+	emitCode(".balign\t8")
+	for _, td := range typeDescriptors {
+		emitCode("%s:", td.label())
+		if isComparable(td.gtype) {
+			emitCode(".quad\t%s.name, %s.equal", td.label(), td.label())
+		} else {
+			emitCode(".quad\t%s.name, 0", td.label())
+		}
+		emitCode("%s.name:", td.label())
+		emitCode(".string \"%s\"", quoteAssembly(runtimeTypeName(td.gtype)))
+		emitCode(".balign\t8")
+	}
+	for _, md := range mapDescriptors {
+		mt := md.gtype
+		emitCode("%s:", md.label())
+		emitCode(".quad\t%d, %d, %d, %s.hash, %s.equal", mt.key.size(), mapValueOffset(mt),
+			mapValueOffset(mt)+mt.elem.size(), md.label(), md.label())
+	}
+	for _, id := range interfaceDescriptors {
+		it := id.gtype.underlying().(*InterfaceType)
+		emitCode("%s:", id.label())
+		emitCode(".quad\t%d", len(typeDescriptors))
+		for _, td := range typeDescriptors {
+			missing, _ := missingMethod(td.gtype, it)
+			if missing == "" {
+				emitCode(".quad\t%s, %s, 0", td.label(), itabLabel(td, id))
+			} else {
+				emitCode(".quad\t%s, 0, %s.missing.%d", td.label(), id.label(), td.index)
+			}
+		}
+		for _, td := range typeDescriptors {
+			missing, _ := missingMethod(td.gtype, it)
+			if missing != "" {
+				emitCode("%s.missing.%d:", id.label(), td.index)
+				emitCode(".string \"%s\"", missing)
+				continue
+			}
+			emitCode(".balign\t8")
+			emitCode("%s:", itabLabel(td, id))
+			emitCode(".quad\t%s", td.label())
+			for _, method := range it.methodSet() {
+				emitCode(".quad\t%s", itabMethodCode(td, method.name))
+			}
+		}
+		emitCode(".balign\t8")
+	}
+	for _, code := range sortedMethodValueLabels(interfaceMethodExpressions) {
+		emitCode("_%s.f:", code)
+		emitCode(".quad\t_%s", code)
+	}
+}
+
+// the code of the method of the dynamic type called with the second word of an interface value.
+// the word is a pointer to the value, but for a pointer type, which is a pointer to its element.
+// a promoted method is called through a wrapper finding the receiver from the word
+func itabMethodCode(td *typeDescriptor, name string) string {
+	path, sig, _, _ := lookupSelector(td.gtype, name)
+	if len(path) == 0 {
+		return "_" + methodCode(sig, true)
+	}
+	return fmt.Sprintf("%s.%s", td.label(), name)
+}
+
+// the equality routines of the descriptors, the wrappers of the promoted methods in the itabs,
+// the code of the interface methods used as func values and method expressions, and the key routines of the maps
+func emitTypeInfoWrappers() {
+	emitCode(".text")
+	for _, td := range typeDescriptors {
+		if isComparable(td.gtype) {
+			emitEqualityRoutine(td)
+		}
+	}
+	for _, md := range mapDescriptors {
+		emitHashRoutine(md)
+		emitValueEqualityRoutine(md.label()+".equal", md.gtype.key)
+	}
+	for _, td := range typeDescriptors {
+		for _, id := range interfaceDescriptors {
+			it := id.gtype.underlying().(*InterfaceType)
+			if !implements(td.gtype, it) {
+				continue
+			}
+			for _, method := range it.methodSet() {
+				emitPromotedMethodWrapper(td, method.name)
+			}
+		}
+	}
+	for _, label := range sortedMethodValueLabels(interfaceMethodValues) {
+		mv := interfaceMethodValues[label]
+		sig := mv.id.gtype.underlying().(*InterfaceType).methodSet()[mv.index].gtype
+		emitCode("%s:", label)
+		for i := len(sig.params); i > 0; i-- {
+			emitCode("\tmovq\t%%%s, %%%s", regs[i-1], regs[i])
+		}
+		emitCode("\tmovq\t8(%%r10), %%rax")
+		emitCode("\tmovq\t8(%%rax), %%rdi")
+		emitCode("\tmovq\t0(%%rax), %%r11")
+		emitCode("\tjmp\t*%d(%%r11)", 8+8*mv.index)
+	}
+	for _, code := range sortedMethodValueLabels(interfaceMethodExpressions) {
+		emitCode("_%s:", code)
+		emitInterfaceDispatch(interfaceMethodExpressions[code].index)
+	}
+}
+
+// compare the second words of two interface values of the type in %rdi and %rsi,
+// %rax is returned 1 if they are equal. %rdx is the position of the comparison
+func emitEqualityRoutine(td *typeDescriptor) {
+	if !isPointerShaped(td.gtype) {
+		emitValueEqualityRoutine(td.label()+".equal", td.gtype)
+		return
+	}
+	emitCode("%s.equal:", td.label())
+	emitCode("\txorl\t%%eax, %%eax")
+	emitCode("\tcmpq\t%%rsi, %%rdi")
+	emitCode("\tsete\t%%al")
+	emitCode("\tret")
+}
+
+// compare the values of the type at %rdi and %rsi
+func emitValueEqualityRoutine(label string, gtype Type) {
+	emitCode("%s:", label)
+	emitCode("\tpushq\t%%rbp")
+	emitCode("\tmovq\t%%rsp, %%rbp")
+	emitCode("\tpushq\t%%rbx")
+	frameHeight = 24
+	emitCode("\tmovq\t%%rdi, %%rax")
+	emitCode("\tmovq\t%%rsi, %%rbx")
+	emitCode("\tmovq\t%%rdx, %%rcx")
+	emitEquality(gtype)
+	emitCode("\tpopq\t%%rbx")
+	emitCode("\tleave")
+	emitCode("\tret")
+}
+
+// hash the key at %rdi with the seed in %rsi into %rax. the bytes of a key are hashed
+// when they decide its equality, and the bytes of the strings in it otherwise
+func emitHashRoutine(md *mapDescriptor) {
+	key := md.gtype.key
+	emitCode("%s.hash:", md.label())
+	switch {
+	case isBytewiseComparable(key):
+		emitCode("\tmovq\t%%rsi, %%rdx")
+		emitCode("\tmovq\t$%d, %%rsi", key.size())
+		emitCode("\tjmp\t_runtime_memhash")
+	case isString(key):
+		emitCode("\tjmp\t_runtime_strhash")
+	default:
+		emitCode("\tpushq\t%%rbp")
+		emitCode("\tmovq\t%%rsp, %%rbp")
+		emitCode("\tpushq\t%%rbx")
+		emitCode("\tsubq\t$8, %%rsp")
+		emitCode("\tmovq\t%%rdi, %%rbx")
+		emitCode("\tmovq\t%%rsi, %%rax")
+		emitPartHash(key, 0)
+		emitCode("\tmovq\t-8(%%rbp), %%rbx")
+		emitCode("\tleave")
+		emitCode("\tret")
+	}
+}
+
+// mix the part of the key at the offset from %rbx into the hash in %rax
+func emitPartHash(t Type, offset int) {
+	switch u := t.underlying().(type) {
+	case *ArrayType:
+		if !isBytewiseComparable(u) {
+			for i := 0; i < u.length; i++ {
+				emitPartHash(u.elem, offset+i*u.elem.size())
+			}
+			return
+		}
+	case *StructType:
+		if !isBytewiseComparable(u) {
+			for _, field := range u.fields {
+				emitPartHash(field.gtype, offset+field.offset)
+			}
+			return
+		}
+	}
+	if isFloat(t) {
+		// adding 0 turns -0 into 0, which are equal keys
+		emitCode("\tmovs%s\t%d(%%rbx), %%xmm0", floatSuffix(t)[1:], offset)
+		emitCode("\txorps\t%%xmm1, %%xmm1")
+		emitCode("\tadd%s\t%%xmm1, %%xmm0", floatSuffix(t))
+		emitCode("\tmovs%s\t%%xmm0, -16(%%rbp)", floatSuffix(t)[1:])
+		emitCode("\tleaq\t-16(%%rbp), %%rdi")
+	} else {
+		emitCode("\tleaq\t%d(%%rbx), %%rdi", offset)
+	}
+	if isString(t) {
+		emitCode("\tmovq\t%%rax, %%rsi")
+		emitCode("\tcallq\t_runtime_strhash")
+		return
+	}
+	emitCode("\tmovq\t$%d, %%rsi", t.size())
+	emitCode("\tmovq\t%%rax, %%rdx")
+	emitCode("\tcallq\t_runtime_memhash")
+}
+
+var emittedPromotedWrappers = make(map[string]bool)
+
+func emitPromotedMethodWrapper(td *typeDescriptor, name string) {
+	label := itabMethodCode(td, name)
+	if label[0] != '.' || emittedPromotedWrappers[label] {
+		return
+	}
+	emittedPromotedWrappers[label] = true
+	emitCode("%s:", label)
+	emitPromotedMethodCall(td.gtype, name)
+}
+
+// call the promoted method of the type with the address of its value in %rdi,
+// which is the receiver of the method found through the embedded fields
+func emitPromotedMethodCall(t Type, name string) {
+	path, sig, imethod, _ := lookupSelector(t, name)
+	for _, field := range path {
+		emitCode("\taddq\t$%d, %%rdi", field.offset)
+		if isPointer(field.gtype) {
+			emitCode("\tmovq\t0(%%rdi), %%rdi")
+		}
+	}
+	if imethod != nil {
+		// %rdi is the address of the embedded interface value
+		it := path[len(path)-1].gtype.underlying().(*InterfaceType)
+		emitInterfaceDispatch(it.methodIndex(name))
+		return
+	}
+	emitCode("\tjmp\t_%s", methodCode(sig, true))
+}
+
+// call the method of the index through the itab of the interface value at %rdi,
+// with the second word of it for the receiver
+func emitInterfaceDispatch(index int) {
+	emitCode("\tmovq\t0(%%rdi), %%r11")
+	emitCode("\tmovq\t8(%%rdi), %%rdi")
+	emitCode("\tjmp\t*%d(%%r11)", 8+8*index)
+}
+
+func sortedMethodValueLabels(m map[string]*interfaceMethodValue) []string {
+	var labels []string
+	for label := range m {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
@@ -0,0 +1,955 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+/*** interface definitioins ***/
+type Type interface {
+	String() string
+	size() int
+	align() int
+	underlying() Type
+}
+
+/* ================================
+ * BasicType
+ *     implements Type
+ * ================================ */
+type BasicKind int
+
+const (
+	KIND_INTEGER BasicKind = iota
+	KIND_FLOAT
+	KIND_COMPLEX
+	KIND_BOOLEAN
+	KIND_STRING
+	KIND_NIL
+)
+
+type BasicType struct {
+	name     string
+	kind     BasicKind
+	sz       int
+	unsigned bool
+	untyped  bool
+}
+
+// implements Type
+func (bt *BasicType) String() string {
+	return bt.name
+}
+
+// implements Type
+func (bt *BasicType) size() int {
+	return bt.sz
+}
+
+// implements Type
+func (bt *BasicType) align() int {
+	if bt.kind == KIND_STRING {
+		return 8
+	}
+	return bt.sz
+}
+
+// implements Type
+func (bt *BasicType) underlying() Type {
+	return bt
+}
+
+/* ================================
+ * NamedType
+ *     implements Type
+ * ================================ */
+type NamedType struct {
+	name    string
+	base    Type
+	methods map[string]*FunctionSignature
+}
+
+// implements Type
+func (nt *NamedType) String() string {
+	return nt.name
+}
+
+// implements Type
+func (nt *NamedType) size() int {
+	return nt.base.size()
+}
+
+// implements Type
+func (nt *NamedType) align() int {
+	return nt.base.align()
+}
+
+// implements Type
+func (nt *NamedType) underlying() Type {
+	return nt.base.underlying()
+}
+
+/* ================================
+ * PointerType
+ *     implements Type
+ * ================================ */
+type PointerType struct {
+	elem Type
+}
+
+// implements Type
+func (pt *PointerType) String() string {
+	return "*" + pt.elem.String()
+}
+
+// implements Type
+func (pt *PointerType) size() int {
+	return 8
+}
+
+// implements Type
+func (pt *PointerType) align() int {
+	return 8
+}
+
+// implements Type
+func (pt *PointerType) underlying() Type {
+	return pt
+}
+
+/* ================================
+ * ArrayType
+ *     implements Type
+ * ================================ */
+type ArrayType struct {
+	elem   Type
+	length int
+}
+
+// implements Type
+func (at *ArrayType) String() string {
+	return fmt.Sprintf("[%d]%s", at.length, at.elem)
+}
+
+// implements Type
+func (at *ArrayType) size() int {
+	return at.elem.size() * at.length
+}
+
+// implements Type
+func (at *ArrayType) align() int {
+	return at.elem.align()
+}
+
+// implements Type
+func (at *ArrayType) underlying() Type {
+	return at
+}
+
+/* ================================
+ * SliceType
+ *     implements Type
+ * ================================ */
+type SliceType struct {
+	elem Type
+}
+
+// implements Type
+func (st *SliceType) String() string {
+	return "[]" + st.elem.String()
+}
+
+// implements Type
+func (st *SliceType) size() int {
+	return 24
+}
+
+// implements Type
+func (st *SliceType) align() int {
+	return 8
+}
+
+// implements Type
+func (st *SliceType) underlying() Type {
+	return st
+}
+
+/* ================================
+ * MapType
+ *     implements Type
+ * ================================ */
+// a map is a pointer to the header of its hash table in the runtime, or nil
+type MapType struct {
+	key  Type
+	elem Type
+}
+
+// implements Type
+func (mt *MapType) String() string {
+	return "map[" + mt.key.String() + "]" + mt.elem.String()
+}
+
+// implements Type
+func (mt *MapType) size() int {
+	return 8
+}
+
+// implements Type
+func (mt *MapType) align() int {
+	return 8
+}
+
+// implements Type
+func (mt *MapType) underlying() Type {
+	return mt
+}
+
+/* ================================
+ * StructType
+ *     implements Type
+ * ================================ */
+// an embedded field is named after its type
+type Field struct {
+	name     string
+	gtype    Type
+	offset   int
+	embedded bool
+}
+
+// the layout is done when it is first needed,
+// as the field types may be declared later
+type StructType struct {
+	fields []*Field
+	sz     int
+	al     int
+	state  int // one of the layout states below
+}
+
+const (
+	layoutPending = iota
+	layoutRunning
+	layoutDone
+)
+
+func newStructType(fields []*Field) *StructType {
+	return &StructType{
+		fields: fields,
+	}
+}
+
+// place the fields at the offsets aligned for their types, like C
+func (st *StructType) layout() {
+	switch st.state {
+	case layoutDone:
+		return
+	case layoutRunning:
+		putError("Invalid recursive type %s.", st)
+	}
+	st.state = layoutRunning
+	st.sz = 0
+	st.al = 1
+	for _, field := range st.fields {
+		field.offset = alignTo(st.sz, field.gtype.align())
+		st.sz = field.offset + field.gtype.size()
+		if field.gtype.align() > st.al {
+			st.al = field.gtype.align()
+		}
+	}
+	st.sz = alignTo(st.sz, st.al)
+	st.state = layoutDone
+}
+
+// implements Type
+func (st *StructType) String() string {
+	str := "struct {"
+	for i, field := range st.fields {
+		if i > 0 {
+			str += ";"
+		}
+		if field.embedded {
+			str += fmt.Sprintf(" %s", field.gtype)
+		} else {
+			str += fmt.Sprintf(" %s %s", field.name, field.gtype)
+		}
+	}
+	return str + " }"
+}
+
+// implements Type
+func (st *StructType) size() int {
+	st.layout()
+	return st.sz
+}
+
+// implements Type
+func (st *StructType) align() int {
+	st.layout()
+	return st.al
+}
+
+// implements Type
+func (st *StructType) underlying() Type {
+	return st
+}
+
+/* ================================
+ * FuncType
+ *     implements Type
+ * ================================ */
+type FuncType struct {
+	params  []Type
+	results []Type
+}
+
+// implements Type
+func (ft *FuncType) String() string {
+	str := "func(" + typeListString(ft.params) + ")"
+	switch len(ft.results) {
+	case 0:
+	case 1:
+		str += " " + ft.results[0].String()
+	default:
+		str += " (" + typeListString(ft.results) + ")"
+	}
+	return str
+}
+
+// implements Type
+func (ft *FuncType) size() int {
+	return 8
+}
+
+// implements Type
+func (ft *FuncType) align() int {
+	return 8
+}
+
+// implements Type
+func (ft *FuncType) underlying() Type {
+	return ft
+}
+
+/* ================================
+ * InterfaceType
+ *     implements Type
+ * ================================ */
+// a value is a pair of words, the first of which is 0 for nil.
+// the first word of an empty interface is the type descriptor of the dynamic type,
+// and that of the others is the itab, which holds the type descriptor and the code of the methods.
+// the second word is the value of a pointer, and the address of a copy of any other value
+type InterfaceType struct {
+	embedded []Type // the interfaces whose methods are included
+	declared []*Method
+	methods  []*Method // sorted by the names, as the code in the itabs
+	state    int       // one of the layout states
+}
+
+type Method struct {
+	name  string
+	gtype *FuncType
+}
+
+// the embedded interfaces may be declared later
+func (it *InterfaceType) methodSet() []*Method {
+	switch it.state {
+	case layoutDone:
+		return it.methods
+	case layoutRunning:
+		putError("Invalid recursive type %s.", it)
+	}
+	it.state = layoutRunning
+	methods := append([]*Method{}, it.declared...)
+	for _, embedded := range it.embedded {
+		ei, ok := embedded.underlying().(*InterfaceType)
+		if !ok {
+			putError("Interface contains type constraints: %s.", embedded)
+		}
+		methods = append(methods, ei.methodSet()...)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].name < methods[j].name
+	})
+	for i := 1; i < len(methods); i++ {
+		if methods[i].name == methods[i-1].name && !identical(methods[i].gtype, methods[i-1].gtype) {
+			putError("Duplicate method %s.", methods[i].name)
+		}
+	}
+	it.methods = nil
+	for i, method := range methods {
+		if i == 0 || method.name != methods[i-1].name {
+			it.methods = append(it.methods, method)
+		}
+	}
+	it.state = layoutDone
+	return it.methods
+}
+
+// the index of the method in the itab, or -1
+func (it *InterfaceType) methodIndex(name string) int {
+	for i, method := range it.methodSet() {
+		if method.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// implements Type
+func (it *InterfaceType) String() string {
+	if len(it.embedded) == 0 && len(it.declared) == 0 {
+		return "interface {}"
+	}
+	str := "interface {"
+	for i, method := range it.methodSet() {
+		if i > 0 {
+			str += ";"
+		}
+		str += " " + method.name + strings.TrimPrefix(method.gtype.String(), "func")
+	}
+	return str + " }"
+}
+
+// implements Type
+func (it *InterfaceType) size() int {
+	return 16
+}
+
+// implements Type
+func (it *InterfaceType) align() int {
+	return 8
+}
+
+// implements Type
+func (it *InterfaceType) underlying() Type {
+	return it
+}
+
+/* ================================ */
+
+var (
+	tInt     = &BasicType{name: "int", kind: KIND_INTEGER, sz: 8}
+	tInt8    = &BasicType{name: "int8", kind: KIND_INTEGER, sz: 1}
+	tInt16   = &BasicType{name: "int16", kind: KIND_INTEGER, sz: 2}
+	tInt32   = &BasicType{name: "int32", kind: KIND_INTEGER, sz: 4}
+	tInt64   = &BasicType{name: "int64", kind: KIND_INTEGER, sz: 8}
+	tUint    = &BasicType{name: "uint", kind: KIND_INTEGER, sz: 8, unsigned: true}
+	tUint8   = &BasicType{name: "uint8", kind: KIND_INTEGER, sz: 1, unsigned: true}
+	tUint16  = &BasicType{name: "uint16", kind: KIND_INTEGER, sz: 2, unsigned: true}
+	tUint32  = &BasicType{name: "uint32", kind: KIND_INTEGER, sz: 4, unsigned: true}
+	tUint64  = &BasicType{name: "uint64", kind: KIND_INTEGER, sz: 8, unsigned: true}
+	tUintptr = &BasicType{name: "uintptr", kind: KIND_INTEGER, sz: 8, unsigned: true}
+	tFloat32 = &BasicType{name: "float32", kind: KIND_FLOAT, sz: 4}
+	tFloat64 = &BasicType{name: "float64", kind: KIND_FLOAT, sz: 8}
+	tBool    = &BasicType{name: "bool", kind: KIND_BOOLEAN, sz: 1}
+	tString  = &BasicType{name: "string", kind: KIND_STRING, sz: 16}
+
+	// the default type of the complex constants, which has no values
+	tComplex128 = &BasicType{name: "complex128", kind: KIND_COMPLEX, sz: 16}
+
+	tUntypedInt     = &BasicType{name: "untyped int", kind: KIND_INTEGER, sz: 8, untyped: true}
+	tUntypedRune    = &BasicType{name: "untyped rune", kind: KIND_INTEGER, sz: 8, untyped: true}
+	tUntypedFloat   = &BasicType{name: "untyped float", kind: KIND_FLOAT, sz: 8, untyped: true}
+	tUntypedComplex = &BasicType{name: "untyped complex", kind: KIND_COMPLEX, sz: 16, untyped: true}
+	tUntypedBool    = &BasicType{name: "untyped bool", kind: KIND_BOOLEAN, sz: 8, untyped: true}
+	tUntypedString  = &BasicType{name: "untyped string", kind: KIND_STRING, sz: 16, untyped: true}
+	tUntypedNil     = &BasicType{name: "untyped nil", kind: KIND_NIL, sz: 8, untyped: true}
+)
+
+// byte and rune are aliases
+var predeclaredTypes = map[string]Type{
+	"int":     tInt,
+	"int8":    tInt8,
+	"int16":   tInt16,
+	"int32":   tInt32,
+	"int64":   tInt64,
+	"uint":    tUint,
+	"uint8":   tUint8,
+	"uint16":  tUint16,
+	"uint32":  tUint32,
+	"uint64":  tUint64,
+	"uintptr": tUintptr,
+	"float32": tFloat32,
+	"float64": tFloat64,
+	"byte":    tUint8,
+	"rune":    tInt32,
+	"bool":    tBool,
+	"string":  tString,
+	"any":     tAny,
+	"error":   tError,
+}
+
+var tAny = &InterfaceType{}
+
+var tError = &NamedType{
+	name: "error",
+	base: &InterfaceType{
+		declared: []*Method{{name: "Error", gtype: &FuncType{results: []Type{tString}}}},
+	},
+}
+
+// the types declared in the scopes shadow the predeclared ones
+// a symbol declared in an inner scope shadows the types of the same name
+func lookupType(name string) Type {
+	for s := currentScope; s != nil; s = s.outer {
+		if s.symenv[name] != nil {
+			return nil
+		}
+		if gtype := s.types[name]; gtype != nil {
+			return gtype
+		}
+	}
+	return predeclaredTypes[name]
+}
+
+func alignTo(n int, align int) int {
+	return (n + align - 1) / align * align
+}
+
+func typeListString(types []Type) string {
+	str := ""
+	for i, t := range types {
+		if i > 0 {
+			str += ", "
+		}
+		str += t.String()
+	}
+	return str
+}
+
+func basicOf(t Type) *BasicType {
+	bt, _ := t.underlying().(*BasicType)
+	return bt
+}
+
+func isUntyped(t Type) bool {
+	bt, ok := t.(*BasicType)
+	return ok && bt.untyped
+}
+
+func isInteger(t Type) bool {
+	bt := basicOf(t)
+	return bt != nil && bt.kind == KIND_INTEGER
+}
+
+func isFloat(t Type) bool {
+	bt := basicOf(t)
+	return bt != nil && bt.kind == KIND_FLOAT
+}
+
+func isComplex(t Type) bool {
+	bt := basicOf(t)
+	return bt != nil && bt.kind == KIND_COMPLEX
+}
+
+// integers, floats and complex numbers
+func isNumeric(t Type) bool {
+	return isInteger(t) || isFloat(t) || isComplex(t)
+}
+
+func isBoolean(t Type) bool {
+	bt := basicOf(t)
+	return bt != nil && bt.kind == KIND_BOOLEAN
+}
+
+func isString(t Type) bool {
+	bt := basicOf(t)
+	return bt != nil && bt.kind == KIND_STRING
+}
+
+// aggregate values are pushed as their address,
+// a string is a pair of the address of its bytes and its length
+func isAggregate(t Type) bool {
+	switch u := t.underlying().(type) {
+	case *ArrayType, *SliceType, *StructType, *InterfaceType:
+		return true
+	case *BasicType:
+		return u.kind == KIND_STRING
+	}
+	return false
+}
+
+func isInterface(t Type) bool {
+	_, ok := t.underlying().(*InterfaceType)
+	return ok
+}
+
+func isEmptyInterface(t Type) bool {
+	it, ok := t.underlying().(*InterfaceType)
+	return ok && len(it.methodSet()) == 0
+}
+
+// whether a method found through the path of the embedded fields is in the method set of t,
+// a pointer receiver needs a pointer to t or an embedded pointer
+func inMethodSet(t Type, path []*Field, method *FunctionSignature) bool {
+	if !method.hasPointerReceiver() || isPointer(t) {
+		return true
+	}
+	for _, field := range path {
+		if isPointer(field.gtype) {
+			return true
+		}
+	}
+	return false
+}
+
+// the method of the interface which t does not have, or ""
+func missingMethod(t Type, it *InterfaceType) (name string, pointerReceiver bool) {
+	if ti, ok := t.underlying().(*InterfaceType); ok {
+		for _, method := range it.methodSet() {
+			i := ti.methodIndex(method.name)
+			if i < 0 || !identical(ti.methodSet()[i].gtype, method.gtype) {
+				return method.name, false
+			}
+		}
+		return "", false
+	}
+	for _, method := range it.methodSet() {
+		path, sig, imethod, ambiguous := lookupSelector(t, method.name)
+		if imethod != nil && !ambiguous && identical(imethod.gtype, method.gtype) {
+			// in the method sets of both the type and the pointer to it
+			continue
+		}
+		if sig == nil || ambiguous || !identical(sig.funcType(), method.gtype) {
+			return method.name, false
+		}
+		if !inMethodSet(t, path, sig) {
+			return method.name, true
+		}
+	}
+	return "", false
+}
+
+func implements(t Type, it *InterfaceType) bool {
+	name, _ := missingMethod(t, it)
+	return name == ""
+}
+
+func isSlice(t Type) bool {
+	_, ok := t.underlying().(*SliceType)
+	return ok
+}
+
+// the array type of an array or a pointer to an array, or nil
+func arrayOf(t Type) *ArrayType {
+	if pt, ok := t.underlying().(*PointerType); ok {
+		t = pt.elem
+	}
+	at, _ := t.underlying().(*ArrayType)
+	return at
+}
+
+// the element type of an array, a pointer to an array or a slice, or nil
+func elementOf(t Type) Type {
+	if st, ok := t.underlying().(*SliceType); ok {
+		return st.elem
+	}
+	if at := arrayOf(t); at != nil {
+		return at.elem
+	}
+	return nil
+}
+
+// predeclared types are named types too
+func isNamed(t Type) bool {
+	switch t.(type) {
+	case *NamedType, *BasicType:
+		return true
+	}
+	return false
+}
+
+func isFunc(t Type) bool {
+	_, ok := t.underlying().(*FuncType)
+	return ok
+}
+
+func mapOf(t Type) *MapType {
+	mt, _ := t.underlying().(*MapType)
+	return mt
+}
+
+func isMap(t Type) bool {
+	return mapOf(t) != nil
+}
+
+// the struct type of a struct or a pointer to a struct, or nil
+func structOf(t Type) *StructType {
+	if pt, ok := t.underlying().(*PointerType); ok {
+		t = pt.elem
+	}
+	st, _ := t.underlying().(*StructType)
+	return st
+}
+
+// the named type of a value or a pointer to it, or nil
+func namedOf(t Type) *NamedType {
+	if pt, ok := t.(*PointerType); ok {
+		t = pt.elem
+	}
+	nt, _ := t.(*NamedType)
+	return nt
+}
+
+// the field or the method of the name, in a type or a pointer to it.
+// the path is of the fields to the field, or to the receiver of the method.
+// the ones promoted from embedded structs are found at the shallowest depth,
+// and more than one at that depth is ambiguous.
+// a method of an embedded interface is imethod, and the path is to the interface field
+func lookupSelector(t Type, name string) (path []*Field, method *FunctionSignature, imethod *Method, ambiguous bool) {
+	level := [][]*Field{nil}
+	visited := make(map[*StructType]bool)
+	for len(level) > 0 {
+		var next [][]*Field
+		found := 0
+		for _, prefix := range level {
+			nodeType := t
+			if len(prefix) > 0 {
+				nodeType = prefix[len(prefix)-1].gtype
+			}
+			if nt := namedOf(nodeType); nt != nil && nt.methods[name] != nil {
+				path, method, imethod = prefix, nt.methods[name], nil
+				found++
+			}
+			if it, ok := nodeType.underlying().(*InterfaceType); ok && len(prefix) > 0 {
+				if index := it.methodIndex(name); index >= 0 {
+					path, method, imethod = prefix, nil, it.methodSet()[index]
+					found++
+				}
+				continue
+			}
+			st := structOf(nodeType)
+			if st == nil || visited[st] {
+				continue
+			}
+			visited[st] = true
+			st.layout()
+			for _, field := range st.fields {
+				fieldPath := append(append([]*Field{}, prefix...), field)
+				if field.name == name {
+					path, method, imethod = fieldPath, nil, nil
+					found++
+				} else if field.embedded {
+					next = append(next, fieldPath)
+				}
+			}
+		}
+		if found > 0 {
+			return path, method, imethod, found > 1
+		}
+		level = next
+	}
+	return nil, nil, nil, false
+}
+
+// whether the values of the type can be compared with ==,
+// comparing interface values may panic with their dynamic types
+func isComparable(t Type) bool {
+	switch u := t.underlying().(type) {
+	case *BasicType, *PointerType, *InterfaceType:
+		return true
+	case *ArrayType:
+		return isComparable(u.elem)
+	case *StructType:
+		for _, field := range u.fields {
+			if !isComparable(field.gtype) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// whether two values of the type are equal exactly when their bytes are,
+// the padding in a struct is always zero. floats are not, as 0 equals -0 and NaN does not equal itself
+func isBytewiseComparable(t Type) bool {
+	switch u := t.underlying().(type) {
+	case *BasicType:
+		return u.kind != KIND_STRING && u.kind != KIND_FLOAT
+	case *InterfaceType:
+		return false
+	case *ArrayType:
+		return isBytewiseComparable(u.elem)
+	case *StructType:
+		for _, field := range u.fields {
+			if !isBytewiseComparable(field.gtype) {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// whether a value of the type has an interface value in it
+func containsInterface(t Type) bool {
+	switch u := t.underlying().(type) {
+	case *InterfaceType:
+		return true
+	case *ArrayType:
+		return containsInterface(u.elem)
+	case *StructType:
+		for _, field := range u.fields {
+			if containsInterface(field.gtype) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isByteOrRuneSlice(t Type) bool {
+	st, ok := t.underlying().(*SliceType)
+	return ok && (st.elem.underlying() == tUint8 || st.elem.underlying() == tInt32)
+}
+
+func isPointer(t Type) bool {
+	_, ok := t.underlying().(*PointerType)
+	return ok
+}
+
+func isUnsigned(t Type) bool {
+	bt := basicOf(t)
+	return bt != nil && bt.unsigned
+}
+
+// whether an integer constant fits in the type
+func representable(value *big.Int, t Type) bool {
+	bt := basicOf(t)
+	if bt == nil || bt.kind != KIND_INTEGER {
+		return true
+	}
+	bits := uint(bt.size() * 8)
+	if bt.unsigned {
+		return value.Sign() >= 0 && value.BitLen() <= int(bits)
+	}
+	minimum := new(big.Int).Lsh(big.NewInt(-1), bits-1)
+	maximum := new(big.Int).Sub(new(big.Int).Neg(minimum), big.NewInt(1))
+	return value.Cmp(minimum) >= 0 && value.Cmp(maximum) <= 0
+}
+
+// whether a numeric constant does not overflow the float type, it is rounded to the type
+func representableFloat(value *big.Float, t Type) bool {
+	if isUntyped(t) {
+		return true
+	}
+	switch t.size() {
+	case 4:
+		f, _ := value.Float32()
+		return !math.IsInf(float64(f), 0)
+	default:
+		f, _ := value.Float64()
+		return !math.IsInf(f, 0)
+	}
+}
+
+// the type an untyped constant gets when there is no other context
+func defaultType(t Type) Type {
+	switch t {
+	case tUntypedInt:
+		return tInt
+	case tUntypedRune:
+		return tInt32
+	case tUntypedFloat:
+		return tFloat64
+	case tUntypedComplex:
+		return tComplex128
+	case tUntypedBool:
+		return tBool
+	case tUntypedString:
+		return tString
+	}
+	return t
+}
+
+func identical(a Type, b Type) bool {
+	if a == b {
+		return true
+	}
+	switch x := a.(type) {
+	case *PointerType:
+		y, ok := b.(*PointerType)
+		return ok && identical(x.elem, y.elem)
+	case *ArrayType:
+		y, ok := b.(*ArrayType)
+		return ok && x.length == y.length && identical(x.elem, y.elem)
+	case *SliceType:
+		y, ok := b.(*SliceType)
+		return ok && identical(x.elem, y.elem)
+	case *MapType:
+		y, ok := b.(*MapType)
+		return ok && identical(x.key, y.key) && identical(x.elem, y.elem)
+	case *StructType:
+		y, ok := b.(*StructType)
+		if !ok || len(x.fields) != len(y.fields) {
+			return false
+		}
+		for i, field := range x.fields {
+			other := y.fields[i]
+			if field.name != other.name || field.embedded != other.embedded || !identical(field.gtype, other.gtype) {
+				return false
+			}
+		}
+		return true
+	case *FuncType:
+		y, ok := b.(*FuncType)
+		return ok && identicalList(x.params, y.params) && identicalList(x.results, y.results)
+	case *InterfaceType:
+		y, ok := b.(*InterfaceType)
+		if !ok || len(x.methodSet()) != len(y.methodSet()) {
+			return false
+		}
+		for i, method := range x.methodSet() {
+			other := y.methodSet()[i]
+			if method.name != other.name || !identical(method.gtype, other.gtype) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func identicalList(a []Type, b []Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !identical(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// whether a value of type value can be assigned to a variable of type to
+func assignable(value Type, to Type) bool {
+	if identical(value, to) {
+		return true
+	}
+	if it, ok := to.underlying().(*InterfaceType); ok && value != tUntypedNil {
+		return implements(defaultType(value), it)
+	}
+	if !isUntyped(value) {
+		return (!isNamed(value) || !isNamed(to)) && identical(value.underlying(), to.underlying())
+	}
+	switch value.(*BasicType).kind {
+	case KIND_INTEGER, KIND_FLOAT, KIND_COMPLEX:
+		// a float constant must be an integer value, and a complex one a real value,
+		// which is checked with the value
+		return isNumeric(to)
+	case KIND_BOOLEAN:
+		return isBoolean(to)
+	case KIND_STRING:
+		return isString(to)
+	case KIND_NIL:
+		switch to.underlying().(type) {
+		case *PointerType, *SliceType, *MapType, *FuncType, *InterfaceType:
+			return true
+		}
+	}
+	return false
+}